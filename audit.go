@@ -0,0 +1,181 @@
+package netallow
+
+// This file contains an audit sink that writes access decisions in
+// formats that SIEM collectors can ingest directly.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AuditFormat selects how an AuditSink formats its records.
+type AuditFormat int
+
+const (
+	// AuditJSON writes each record as a single-line JSON object
+	// (JSON-lines).
+	AuditJSON AuditFormat = iota
+
+	// AuditCEF writes each record as an ArcSight Common Event
+	// Format line.
+	AuditCEF
+)
+
+// An AuditRecord describes a single access decision.
+type AuditRecord struct {
+	// Time is the time the decision was made. If it is zero, the
+	// sink fills in the current time.
+	Time time.Time
+
+	// Source is the client address that was checked.
+	Source net.IP
+
+	// Permitted is true if the address was allowed access.
+	Permitted bool
+
+	// Rule is the ACL entry that matched, if the ACL was able
+	// to report one.
+	Rule string
+
+	// Path is the request path, if the decision was made for an
+	// HTTP request.
+	Path string
+}
+
+func (rec AuditRecord) decision() string {
+	if rec.Permitted {
+		return "allow"
+	}
+	return "deny"
+}
+
+// An AuditSink writes audit records to an io.Writer, one record per
+// line. It is safe for concurrent use.
+type AuditSink struct {
+	lock   *sync.Mutex
+	w      io.Writer
+	format AuditFormat
+}
+
+// NewAuditSink returns a new audit sink that writes records in the
+// given format to w.
+func NewAuditSink(w io.Writer, format AuditFormat) (*AuditSink, error) {
+	if w == nil {
+		return nil, errors.New("netallow: audit writer cannot be nil")
+	}
+
+	switch format {
+	case AuditJSON, AuditCEF:
+	default:
+		return nil, errors.New("netallow: invalid audit format")
+	}
+
+	return &AuditSink{
+		lock:   new(sync.Mutex),
+		w:      w,
+		format: format,
+	}, nil
+}
+
+// Record formats the record and writes it to the sink.
+func (s *AuditSink) Record(rec AuditRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+
+	var line []byte
+	var err error
+	switch s.format {
+	case AuditCEF:
+		line = formatCEF(rec)
+	default:
+		line, err = formatJSON(rec)
+		if err != nil {
+			return err
+		}
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+type jsonAuditRecord struct {
+	Time     string `json:"time"`
+	Source   string `json:"src"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+func formatJSON(rec AuditRecord) ([]byte, error) {
+	return json.Marshal(jsonAuditRecord{
+		Time:     rec.Time.UTC().Format(time.RFC3339Nano),
+		Source:   ipString(rec.Source),
+		Decision: rec.decision(),
+		Rule:     rec.Rule,
+		Path:     rec.Path,
+	})
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`,
+		"\r", `\r`, "\n", `\n`)
+)
+
+// formatCEF renders the record as a CEF:0 line. The signature ID is
+// the decision, and the rule and path are carried in the cs1 and
+// request extension fields.
+func formatCEF(rec AuditRecord) []byte {
+	name, severity := "Access permitted", 1
+	if !rec.Permitted {
+		name, severity = "Access denied", 5
+	}
+
+	var ext = []string{
+		fmt.Sprintf("rt=%d", rec.Time.UnixNano()/int64(time.Millisecond)),
+		"src=" + cefExtensionEscaper.Replace(ipString(rec.Source)),
+		"act=" + rec.decision(),
+	}
+
+	if rec.Rule != "" {
+		ext = append(ext, "cs1Label=rule",
+			"cs1="+cefExtensionEscaper.Replace(rec.Rule))
+	}
+
+	if rec.Path != "" {
+		ext = append(ext, "request="+cefExtensionEscaper.Replace(rec.Path))
+	}
+
+	line := fmt.Sprintf("CEF:0|kisom|netallow|1|%s|%s|%d|%s",
+		rec.decision(), cefHeaderEscaper.Replace(name), severity,
+		strings.Join(ext, " "))
+	return []byte(line)
+}
+
+// ipString is like ip.String, but returns an empty string for a
+// nil address instead of "<nil>".
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// requestPath returns the path of the request, if it has one.
+func requestPath(req *http.Request) string {
+	if req.URL == nil {
+		return ""
+	}
+	return req.URL.Path
+}
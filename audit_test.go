@@ -0,0 +1,139 @@
+package netallow
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAuditTime = time.Date(2020, 3, 14, 15, 9, 26, 0, time.UTC)
+
+func TestAuditJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink, err := NewAuditSink(buf, AuditJSON)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = sink.Record(AuditRecord{
+		Time:      testAuditTime,
+		Source:    net.ParseIP("192.168.3.1"),
+		Permitted: false,
+		Path:      "/admin",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = sink.Record(AuditRecord{
+		Time:      testAuditTime,
+		Source:    net.ParseIP("10.0.0.1"),
+		Permitted: true,
+		Rule:      "10.0.0.0/8",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, have %d", len(lines))
+	}
+
+	var rec map[string]string
+	if err = json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := map[string]string{
+		"time":     "2020-03-14T15:09:26Z",
+		"src":      "192.168.3.1",
+		"decision": "deny",
+		"path":     "/admin",
+	}
+	if len(rec) != len(expected) {
+		t.Fatalf("expected %d fields, have %d: %s", len(expected), len(rec), lines[0])
+	}
+	for k, v := range expected {
+		if rec[k] != v {
+			t.Fatalf("expected %s=%s, have %s", k, v, rec[k])
+		}
+	}
+
+	rec = nil
+	if err = json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if rec["decision"] != "allow" || rec["rule"] != "10.0.0.0/8" {
+		t.Fatalf("unexpected audit record %s", lines[1])
+	}
+}
+
+func TestAuditCEF(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink, err := NewAuditSink(buf, AuditCEF)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = sink.Record(AuditRecord{
+		Time:      testAuditTime,
+		Source:    net.ParseIP("192.168.3.1"),
+		Permitted: false,
+		Rule:      "a=b",
+		Path:      "/admin",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := `CEF:0|kisom|netallow|1|deny|Access denied|5|rt=1584198566000 src=192.168.3.1 act=deny cs1Label=rule cs1=a\=b request=/admin` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\nbut have\n%s", expected, buf.String())
+	}
+}
+
+func TestAuditSinkFails(t *testing.T) {
+	if _, err := NewAuditSink(nil, AuditJSON); err == nil {
+		t.Fatal("expected NewAuditSink to fail with a nil writer")
+	}
+
+	if _, err := NewAuditSink(&bytes.Buffer{}, AuditFormat(42)); err == nil {
+		t.Fatal("expected NewAuditSink to fail with an invalid format")
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "127.0.0.0/8", t)
+
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	sink, err := NewAuditSink(buf, AuditJSON)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.SetAudit(sink)
+
+	req := httptest.NewRequest("GET", "/files/a.txt", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var rec map[string]string
+	if err = json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if rec["src"] != "127.0.0.1" || rec["decision"] != "allow" ||
+		rec["rule"] != "127.0.0.0/8" || rec["path"] != "/files/a.txt" {
+		t.Fatalf("unexpected audit record %s", buf.String())
+	}
+}
@@ -0,0 +1,192 @@
+package netallow
+
+// This file contains a loader that detects the format of an ACL
+// file from its contents.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// csvColumns are the header names LoadAuto recognises for the
+// column holding addresses in a CSV file.
+var csvColumns = map[string]bool{
+	"ip":      true,
+	"address": true,
+	"addr":    true,
+	"network": true,
+	"cidr":    true,
+}
+
+// LoadAuto reads an ACL in any of the following formats, detecting
+// the format from the content:
+//
+//   - JSON: either the quoted, comma-separated string written by
+//     MarshalJSON, or an array of strings.
+//   - CSV: a header line naming exactly one column "ip", "address",
+//     "addr", "network", or "cidr" (in any case), followed by
+//     records; only that column is used. Lines starting with '#'
+//     are ignored.
+//   - Plain text: one address or network per line. Blank lines and
+//     anything following a '#' are ignored.
+//
+// Entries may be IP addresses or networks in CIDR notation. If every
+// entry is an address, a *Basic is returned; otherwise a *BasicNet
+// is returned, with addresses treated as single-host networks.
+//
+// LoadAuto is conservative: if the input doesn't clearly match one
+// format, such as a CSV file without a recognised header, an error
+// is returned rather than a guess. The ACL is only returned once the
+// whole input has been loaded.
+func LoadAuto(r io.Reader) (ACL, error) {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	in = bytes.TrimSpace(in)
+	if len(in) == 0 {
+		return nil, errors.New("netallow: no ACL entries to load")
+	}
+
+	var entries []string
+	switch {
+	case in[0] == '"' || in[0] == '[' || in[0] == '{':
+		entries, err = autoJSON(in)
+	case bytes.Contains(firstLine(in), []byte(",")):
+		entries, err = autoCSV(in)
+	default:
+		entries = autoLines(in)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return autoACL(entries)
+}
+
+// firstLine returns the first line of in that isn't blank or a
+// comment, which is used to detect the format, so that a plain list
+// can start with a comment such as "# managed by ansible, do not
+// edit".
+func firstLine(in []byte) []byte {
+	for _, line := range bytes.Split(in, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) != 0 && line[0] != '#' {
+			return line
+		}
+	}
+	return nil
+}
+
+func autoJSON(in []byte) ([]string, error) {
+	switch in[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(in, &s); err != nil {
+			return nil, fmt.Errorf("netallow: invalid JSON ACL: %v", err)
+		}
+		return strings.Split(s, ","), nil
+	case '[':
+		var entries []string
+		if err := json.Unmarshal(in, &entries); err != nil {
+			return nil, fmt.Errorf("netallow: invalid JSON ACL: %v", err)
+		}
+		return entries, nil
+	default:
+		return nil, errors.New("netallow: JSON objects are not a supported ACL format")
+	}
+}
+
+func autoCSV(in []byte) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(in))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("netallow: invalid CSV ACL: %v", err)
+	}
+
+	column := -1
+	for i, name := range records[0] {
+		if !csvColumns[strings.ToLower(strings.TrimSpace(name))] {
+			continue
+		}
+
+		if column != -1 {
+			return nil, errors.New("netallow: ambiguous CSV ACL: more than one address column")
+		}
+		column = i
+	}
+
+	if column == -1 {
+		return nil, errors.New("netallow: ambiguous ACL: comma-separated input without a recognised CSV header")
+	}
+
+	var entries = make([]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		entries = append(entries, record[column])
+	}
+	return entries, nil
+}
+
+func autoLines(in []byte) []string {
+	var entries []string
+	for _, line := range strings.Split(string(in), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
+
+// autoACL builds a host ACL if every entry is an address, and a
+// network ACL otherwise.
+func autoACL(entries []string) (ACL, error) {
+	var hosts []net.IP
+	var nets []*net.IPNet
+	isNet := false
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		n, err := parseNet(entry)
+		if err != nil {
+			return nil, fmt.Errorf("netallow: invalid ACL entry %q", entry)
+		}
+
+		if strings.Contains(entry, "/") {
+			isNet = true
+		} else {
+			hosts = append(hosts, net.ParseIP(entry))
+		}
+		nets = append(nets, n)
+	}
+
+	if len(nets) == 0 {
+		return nil, errors.New("netallow: no ACL entries to load")
+	}
+
+	if isNet {
+		acl := NewBasicNet()
+		for _, n := range nets {
+			acl.Add(n)
+		}
+		return acl, nil
+	}
+
+	acl := NewBasic()
+	for _, ip := range hosts {
+		acl.Add(ip)
+	}
+	return acl, nil
+}
@@ -0,0 +1,71 @@
+package netallow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAuto(t *testing.T) {
+	tv := []struct {
+		name  string
+		in    string
+		isNet bool
+	}{
+		{"json string", `"10.0.0.1,192.168.1.1"`, false},
+		{"json array", `["10.0.0.1", "192.168.1.0/24"]`, true},
+		{"csv", "name,IP\nwww,10.0.0.1\ndb,192.168.1.1\n", false},
+		{"csv networks", "cidr,comment\n10.0.0.1/32,office\n192.168.1.0/24,lab\n", true},
+		{"plain hosts", "# hosts\n10.0.0.1\n\n192.168.1.1 # lab\n", false},
+		{"plain networks", "10.0.0.1\n192.168.1.0/24\n", true},
+		{"commented plain hosts", "# managed by ansible, do not edit\n10.0.0.1\n192.168.1.1\n", false},
+		{"commented plain networks", "\n# office, lab\n\n10.0.0.1/32\n192.168.1.0/24\n", true},
+		{"commented csv", "# exported, 2026\nname,IP\nwww,10.0.0.1\n# db\ndb,192.168.1.1\n", false},
+	}
+
+	for _, tc := range tv {
+		acl, err := LoadAuto(strings.NewReader(tc.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		switch acl.(type) {
+		case *Basic:
+			if tc.isNet {
+				t.Fatalf("%s: expected a network ACL", tc.name)
+			}
+		case *BasicNet:
+			if !tc.isNet {
+				t.Fatalf("%s: expected a host ACL", tc.name)
+			}
+		default:
+			t.Fatalf("%s: unexpected ACL type %T", tc.name, acl)
+		}
+
+		for _, addr := range []string{"10.0.0.1", "192.168.1.1"} {
+			if !checkIPString(acl, addr, t) {
+				t.Fatalf("%s: ACL should have permitted %s", tc.name, addr)
+			}
+		}
+
+		if checkIPString(acl, "10.0.0.2", t) {
+			t.Fatalf("%s: ACL should have denied 10.0.0.2", tc.name)
+		}
+	}
+}
+
+func TestLoadAutoFails(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"# nothing here\n",
+		`{"allowed": ["10.0.0.1"]}`,
+		`["10.0.0.1"`,
+		"10.0.0.1,10.0.0.2\n",
+		"ip,address\n10.0.0.1,10.0.0.2\n",
+		"ip\nwww\n",
+		"10.0.0.256\n",
+	} {
+		if _, err := LoadAuto(strings.NewReader(in)); err == nil {
+			t.Fatalf("LoadAuto should fail on %q", in)
+		}
+	}
+}
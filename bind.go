@@ -0,0 +1,64 @@
+package netallow
+
+// This file contains an exporter that writes a network ACL as a BIND
+// acl statement, so that an application's ACL can drive a DNS
+// server's configuration.
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BINDExportVersion is the version of the output format written by
+// ExportBIND. It is recorded in a comment in the output, and will
+// change if the format does.
+const BINDExportVersion = 1
+
+// ExportBIND returns the networks in the ACL as a BIND acl statement
+// with the given name, e.g.
+//
+//	# generated by netallow (bind export v1)
+//	acl "trusted" {
+//		10.0.0.0/8;
+//		192.0.2.1;
+//		2001:db8::/32;
+//	};
+//
+// Networks are sorted, with IPv4 before IPv6, and single hosts are
+// written as bare addresses. An empty ACL is written with the single
+// element "none" so that BIND accepts it and matches nothing. Quotes
+// and backslashes in the name are escaped.
+func ExportBIND(acl *BasicNet, name string) []byte {
+	acl.lock.RLock()
+	nets := make([]*net.IPNet, len(acl.allowed))
+	copy(nets, acl.allowed)
+	acl.lock.RUnlock()
+	sortNets(nets)
+
+	name = strings.Replace(name, `\`, `\\`, -1)
+	name = strings.Replace(name, `"`, `\"`, -1)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated by netallow (bind export v%d)\n", BINDExportVersion)
+	fmt.Fprintf(&buf, "acl \"%s\" {\n", name)
+	if len(nets) == 0 {
+		buf.WriteString("\tnone;\n")
+	}
+
+	for _, n := range nets {
+		ip, ones, bits := prefixOf(n)
+		if ip == nil {
+			continue
+		}
+
+		if ones == bits {
+			fmt.Fprintf(&buf, "\t%s;\n", ip)
+		} else {
+			fmt.Fprintf(&buf, "\t%s/%d;\n", ip, ones)
+		}
+	}
+	buf.WriteString("};\n")
+	return buf.Bytes()
+}
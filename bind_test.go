@@ -0,0 +1,36 @@
+package netallow
+
+import (
+	"testing"
+)
+
+func TestExportBIND(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "2001:db8::/32", t)
+	testAddNet(acl, "192.0.2.1/32", t)
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "2001:db9::1/128", t)
+
+	expected := `# generated by netallow (bind export v1)
+acl "trusted" {
+	10.0.0.0/8;
+	192.0.2.1;
+	2001:db8::/32;
+	2001:db9::1;
+};
+`
+	if out := string(ExportBIND(acl, "trusted")); out != expected {
+		t.Fatalf("expected\n%s\nbut have\n%s", expected, out)
+	}
+}
+
+func TestExportBINDEmpty(t *testing.T) {
+	expected := `# generated by netallow (bind export v1)
+acl "say \"hi\"" {
+	none;
+};
+`
+	if out := string(ExportBIND(NewBasicNet(), `say "hi"`)); out != expected {
+		t.Fatalf("expected\n%s\nbut have\n%s", expected, out)
+	}
+}
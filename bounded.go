@@ -0,0 +1,95 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrLimitReached is returned when adding an address to a
+// BoundedBasic that is already at its limit.
+var ErrLimitReached = errors.New("netallow: ACL is at its size limit")
+
+// BoundedBasic is a host ACL that holds at most a fixed number of
+// addresses, as a guard against unbounded growth when addresses are
+// added by scripts or other automated tools. Disabled addresses
+// count towards the limit. It is otherwise a Basic.
+type BoundedBasic struct {
+	basic *Basic
+	limit int
+}
+
+// NewBoundedBasic returns an empty host ACL that holds at most limit
+// addresses. The limit must be at least 1.
+func NewBoundedBasic(limit int) (*BoundedBasic, error) {
+	if limit < 1 {
+		return nil, errors.New("netallow: limit must be at least 1")
+	}
+
+	return &BoundedBasic{
+		basic: NewBasic(),
+		limit: limit,
+	}, nil
+}
+
+// Permitted returns true if the IP is allowed access.
+func (acl *BoundedBasic) Permitted(ip net.IP) bool {
+	return acl.basic.Permitted(ip)
+}
+
+// MatchRule returns true and the address as it is stored in the ACL
+// if the IP is allowed access.
+func (acl *BoundedBasic) MatchRule(ip net.IP) (string, bool) {
+	return acl.basic.MatchRule(ip)
+}
+
+// Add permits the IP, unless the ACL is full; see TryAdd. Adding an
+// address that is already in the ACL always succeeds.
+func (acl *BoundedBasic) Add(ip net.IP) {
+	acl.TryAdd(ip)
+}
+
+// TryAdd permits the IP, returning ErrLimitReached if the ACL is full
+// and the IP isn't already in it, or ErrInvalidIP if it isn't a valid
+// address.
+func (acl *BoundedBasic) TryAdd(ip net.IP) error {
+	if !validIP(ip) {
+		return ErrInvalidIP
+	}
+
+	b := acl.basic
+	addr := ip.String()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.allowed[addr]; !ok && len(b.allowed) >= acl.limit {
+		return ErrLimitReached
+	}
+
+	b.add(addr)
+	return nil
+}
+
+// Remove removes access by the IP, freeing space for another.
+func (acl *BoundedBasic) Remove(ip net.IP) {
+	acl.basic.Remove(ip)
+}
+
+// Count returns the number of addresses in the ACL.
+func (acl *BoundedBasic) Count() int {
+	return acl.basic.Count()
+}
+
+// Limit returns the most addresses the ACL can hold.
+func (acl *BoundedBasic) Limit() int {
+	return acl.limit
+}
+
+// entries lists the ACL's addresses for DumpMixed and the list
+// handlers.
+func (acl *BoundedBasic) entries() []string {
+	return acl.basic.entries()
+}
+
+// MarshalJSON serialises the ACL in the same form as Basic.
+func (acl *BoundedBasic) MarshalJSON() ([]byte, error) {
+	return acl.basic.MarshalJSON()
+}
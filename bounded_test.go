@@ -0,0 +1,64 @@
+package netallow
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestBoundedBasic(t *testing.T) {
+	acl, err := NewBoundedBasic(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, addr := range []string{"192.0.2.1", "2001:db8::1"} {
+		if err = acl.TryAdd(mustParseIP(t, addr)); err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+	}
+
+	if err = acl.TryAdd(mustParseIP(t, "192.0.2.3")); err != ErrLimitReached {
+		t.Fatalf("expected ErrLimitReached, but have %v", err)
+	}
+
+	acl.Add(mustParseIP(t, "192.0.2.4"))
+	if checkIPString(acl, "192.0.2.3", t) || checkIPString(acl, "192.0.2.4", t) {
+		t.Fatal("addresses beyond the limit shouldn't be permitted")
+	}
+
+	// Re-adding an address that is already present isn't growth.
+	if err = acl.TryAdd(mustParseIP(t, "192.0.2.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.Count() != 2 || acl.Limit() != 2 {
+		t.Fatalf("expected 2 of 2 addresses, but have %d of %d", acl.Count(), acl.Limit())
+	}
+
+	acl.Remove(mustParseIP(t, "192.0.2.1"))
+	if err = acl.TryAdd(mustParseIP(t, "192.0.2.3")); err != nil {
+		t.Fatalf("removing an address should make room, but have %v", err)
+	}
+
+	if !checkIPString(acl, "192.0.2.3", t) || checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("expected 192.0.2.3 to replace 192.0.2.1")
+	}
+
+	out, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != `"192.0.2.3,2001:db8::1"` {
+		t.Fatalf("unexpected JSON %s", out)
+	}
+
+	if err = acl.TryAdd(net.IP{0, 0}); err == nil {
+		t.Fatal("TryAdd should reject an invalid address")
+	}
+
+	if _, err = NewBoundedBasic(0); err == nil {
+		t.Fatal("NewBoundedBasic should reject a zero limit")
+	}
+}
@@ -0,0 +1,355 @@
+package netallow
+
+// This file contains a circuit breaker for ACLs whose decisions come
+// from a slow or unreliable source, such as a remote policy service.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A DecideFunc makes an access decision that may be slow or may
+// fail, such as asking a remote policy service.
+type DecideFunc func(ctx context.Context, ip net.IP) (bool, error)
+
+// BreakerState is the state of a Breaker's circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed means decisions are being made normally.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen means the decider has failed too often, and
+	// is not being called.
+	BreakerOpen
+
+	// BreakerHalfOpen means the breaker is letting a trial call
+	// through to see whether the decider has recovered.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures a Breaker.
+type BreakerConfig struct {
+	// Timeout bounds each call to the decider.
+	Timeout time.Duration
+
+	// TTL is how long a decision is used without asking the
+	// decider again. If it is 0, the decider is asked on every
+	// check, though stale decisions may still be served.
+	TTL time.Duration
+
+	// MaxStale is how long past its TTL a decision may still be
+	// served. Stale decisions are served while they are being
+	// revalidated in the background, and whenever the decider
+	// is failing.
+	MaxStale time.Duration
+
+	// Threshold is the number of consecutive failures that trips
+	// the breaker. It must be at least 1.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before it
+	// lets a trial call through.
+	Cooldown time.Duration
+
+	// FailOpen selects the decision for addresses without a
+	// usable cached decision when the decider can't be used:
+	// if true they are permitted, otherwise they are denied.
+	FailOpen bool
+
+	// CacheSize bounds the number of cached decisions; the least
+	// recently used is evicted to make room for a new one. If it
+	// is 0, DefaultCacheSize is used.
+	CacheSize int
+}
+
+// BreakerStats reports the state and activity of a Breaker.
+type BreakerStats struct {
+	State     BreakerState
+	Calls     uint64 // calls made to the decider
+	Failures  uint64 // calls that failed or timed out
+	Stale     uint64 // decisions served from stale cache entries
+	Defaulted uint64 // decisions that fell back to the default
+}
+
+// breakerCall is a call to the decider that every check waiting on
+// the same address shares.
+type breakerCall struct {
+	done      chan struct{}
+	permitted bool
+	err       error
+}
+
+// Breaker is an ACL that wraps a DecideFunc with a decision cache
+// and a circuit breaker, so that the request path stays responsive
+// when the decider is slow or down. Fresh decisions are served from
+// the cache; stale ones are served while being revalidated in the
+// background. When the decider fails Threshold times in a row the
+// breaker opens, and decisions come from the cache (within MaxStale)
+// or the configured default until a trial call succeeds. The cache
+// holds at most CacheSize decisions, and drops those that are too
+// old to be served.
+type Breaker struct {
+	decide DecideFunc
+	cfg    BreakerConfig
+
+	lock     *sync.Mutex
+	clock    Clock
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+	cache    *decisionCache
+	inflight map[string]*breakerCall
+	stats    BreakerStats
+}
+
+// NewBreaker returns a new Breaker in front of decide.
+func NewBreaker(decide DecideFunc, cfg BreakerConfig) (*Breaker, error) {
+	if decide == nil {
+		return nil, errors.New("netallow: decider cannot be nil")
+	}
+
+	if cfg.Timeout <= 0 || cfg.TTL < 0 || cfg.MaxStale < 0 || cfg.Cooldown <= 0 {
+		return nil, errors.New("netallow: invalid breaker timing")
+	}
+
+	if cfg.Threshold < 1 {
+		return nil, errors.New("netallow: breaker threshold must be at least 1")
+	}
+
+	if cfg.CacheSize < 0 {
+		return nil, errors.New("netallow: breaker cache size cannot be negative")
+	} else if cfg.CacheSize == 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+
+	cache := newDecisionCache(cfg.CacheSize, cfg.TTL, cfg.TTL)
+	cache.maxStale = cfg.MaxStale
+	return &Breaker{
+		decide:   decide,
+		cfg:      cfg,
+		lock:     new(sync.Mutex),
+		clock:    SystemClock,
+		cache:    cache,
+		inflight: map[string]*breakerCall{},
+	}, nil
+}
+
+// SetClock sets the clock used for cache expiry and the cooldown. A
+// nil clock selects the system clock.
+func (b *Breaker) SetClock(clock Clock) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clock = clockOrSystem(clock)
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.checkCooldown(b.clock.Now())
+	return b.state
+}
+
+// Stats returns the breaker's state and counters.
+func (b *Breaker) Stats() BreakerStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.checkCooldown(b.clock.Now())
+	stats := b.stats
+	stats.State = b.state
+	return stats
+}
+
+// CacheStats returns the decision cache's counters. Stale decisions
+// count as hits.
+func (b *Breaker) CacheStats() CacheStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.cache.stats()
+}
+
+// setCacheLimits changes the size of the decision cache and the TTLs
+// of permitted and denied decisions; see decisionCache.setLimits.
+func (b *Breaker) setCacheLimits(size int, allowTTL, denyTTL time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.cache.setLimits(size, allowTTL, denyTTL)
+}
+
+// setTimeout changes the bound on calls to the decider; calls
+// already being made keep the timeout they started with.
+func (b *Breaker) setTimeout(timeout time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.cfg.Timeout = timeout
+}
+
+// checkCooldown moves an open breaker to half-open once the cooldown
+// has passed. The caller must hold the lock.
+func (b *Breaker) checkCooldown(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.state = BreakerHalfOpen
+		b.trial = false
+	}
+}
+
+// allowCall reports whether the decider may be called, claiming the
+// trial call if the breaker is half-open. The caller must hold the
+// lock.
+func (b *Breaker) allowCall(now time.Time) bool {
+	b.checkCooldown(now)
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return false
+	}
+}
+
+// start begins a call to the decider for the IP that checks of the
+// same address can share. The caller must hold the lock.
+func (b *Breaker) start(key string, ip net.IP) *breakerCall {
+	call := &breakerCall{done: make(chan struct{})}
+	b.inflight[key] = call
+	go b.call(call, key, ip, b.cfg.Timeout)
+	return call
+}
+
+// call asks the decider for a decision, recording the outcome and
+// caching the decision if it succeeds, and wakes the checks waiting
+// on it. The call is shared, so it isn't bound to any one check's
+// context; it is only bounded by the timeout.
+func (b *Breaker) call(call *breakerCall, key string, ip net.IP, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		permitted bool
+		err       error
+	}
+
+	// The decider may not honour the context, so don't wait on
+	// it past the deadline.
+	results := make(chan result, 1)
+	go func() {
+		permitted, err := b.decide(ctx, ip)
+		results <- result{permitted, err}
+	}()
+
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+
+	b.lock.Lock()
+	delete(b.inflight, key)
+	now := b.clock.Now()
+	b.stats.Calls++
+	b.trial = false
+	if res.err != nil {
+		b.stats.Failures++
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.cfg.Threshold {
+			b.state = BreakerOpen
+			b.openedAt = now
+		}
+	} else {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.cache.put(key, res.permitted, now)
+	}
+	b.lock.Unlock()
+
+	call.permitted, call.err = res.permitted, res.err
+	close(call.done)
+}
+
+// PermittedCtx returns the decision for the IP, calling the decider
+// if no cached decision is usable. Checks of an address share a
+// single call, which runs with the configured Timeout rather than
+// ctx; ctx only bounds how long this check waits for it. An error is
+// returned only if the default decision was used because the call
+// failed or ctx was done first.
+func (b *Breaker) PermittedCtx(ctx context.Context, ip net.IP) (bool, error) {
+	if !validIP(ip) {
+		return false, errors.New("netallow: invalid IP address")
+	}
+
+	key := ip.String()
+	b.lock.Lock()
+	now := b.clock.Now()
+	permitted, fresh, cached := b.cache.lookup(key, now)
+	if cached && fresh {
+		b.lock.Unlock()
+		return permitted, nil
+	}
+
+	call, waiting := b.inflight[key]
+	if cached {
+		b.stats.Stale++
+		if !waiting && b.allowCall(now) {
+			b.start(key, ip)
+		}
+		b.lock.Unlock()
+		return permitted, nil
+	}
+
+	if !waiting {
+		if !b.allowCall(now) {
+			b.stats.Defaulted++
+			b.lock.Unlock()
+			return b.cfg.FailOpen, nil
+		}
+		call = b.start(key, ip)
+	}
+	b.lock.Unlock()
+
+	var err error
+	select {
+	case <-call.done:
+		if call.err == nil {
+			return call.permitted, nil
+		}
+		err = call.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.lock.Lock()
+	b.stats.Defaulted++
+	b.lock.Unlock()
+	return b.cfg.FailOpen, err
+}
+
+// Permitted returns the decision for the IP.
+func (b *Breaker) Permitted(ip net.IP) bool {
+	permitted, _ := b.PermittedCtx(context.Background(), ip)
+	return permitted
+}
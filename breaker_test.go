@@ -0,0 +1,251 @@
+package netallow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForCalls waits for the breaker to have made n calls to its
+// decider.
+func waitForCalls(b *Breaker, n uint64, t *testing.T) {
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Stats().Calls < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d decider calls", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testDecider permits addresses in its list, and can be made to
+// fail or hang.
+type testDecider struct {
+	lock    *sync.Mutex
+	allowed map[string]bool
+	fail    bool
+	hang    bool
+}
+
+func newTestDecider(addrs ...string) *testDecider {
+	d := &testDecider{
+		lock:    new(sync.Mutex),
+		allowed: map[string]bool{},
+	}
+	for _, addr := range addrs {
+		d.allowed[addr] = true
+	}
+	return d
+}
+
+func (d *testDecider) set(fail, hang bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.fail, d.hang = fail, hang
+}
+
+func (d *testDecider) Decide(ctx context.Context, ip net.IP) (bool, error) {
+	d.lock.Lock()
+	fail, hang := d.fail, d.hang
+	permitted := d.allowed[ip.String()]
+	d.lock.Unlock()
+
+	if hang {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+
+	if fail {
+		return false, errors.New("decider is down")
+	}
+	return permitted, nil
+}
+
+var testBreakerConfig = BreakerConfig{
+	Timeout:   20 * time.Millisecond,
+	TTL:       time.Minute,
+	MaxStale:  time.Hour,
+	Threshold: 2,
+	Cooldown:  time.Minute,
+}
+
+func newTestBreaker(d *testDecider, t *testing.T) (*Breaker, *testClock) {
+	b, err := NewBreaker(d.Decide, testBreakerConfig)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	b.SetClock(clock)
+	return b, clock
+}
+
+func TestBreakerCaches(t *testing.T) {
+	d := newTestDecider("10.0.0.1")
+	b, _ := newTestBreaker(d, t)
+
+	for i := 0; i < 3; i++ {
+		if !checkIPString(b, "10.0.0.1", t) {
+			t.Fatal("breaker should have permitted address")
+		}
+
+		if checkIPString(b, "10.0.0.2", t) {
+			t.Fatal("breaker should have denied address")
+		}
+	}
+
+	if stats := b.Stats(); stats.Calls != 2 || stats.State != BreakerClosed {
+		t.Fatalf("expected 2 calls with the breaker closed, have %+v", stats)
+	}
+}
+
+func TestBreakerTrips(t *testing.T) {
+	d := newTestDecider("10.0.0.1")
+	b, clock := newTestBreaker(d, t)
+	d.set(false, true)
+
+	// Two timeouts trip the breaker.
+	for i := 0; i < 2; i++ {
+		if checkIPString(b, "10.0.0.1", t) {
+			t.Fatal("breaker should fail closed")
+		}
+	}
+
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected breaker to be open, but it is %s", b.State())
+	}
+
+	// With the breaker open, the decider isn't called.
+	if checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should fail closed")
+	}
+
+	stats := b.Stats()
+	if stats.Calls != 2 || stats.Failures != 2 || stats.Defaulted != 3 {
+		t.Fatalf("unexpected breaker stats %+v", stats)
+	}
+
+	// After the cooldown, a successful trial call closes it.
+	d.set(false, false)
+	clock.Advance(time.Minute)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected breaker to be half-open, but it is %s", b.State())
+	}
+
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should have permitted address")
+	}
+
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected breaker to be closed, but it is %s", b.State())
+	}
+}
+
+func TestBreakerFailOpen(t *testing.T) {
+	d := newTestDecider()
+	cfg := testBreakerConfig
+	cfg.FailOpen = true
+	b, err := NewBreaker(d.Decide, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	d.set(true, false)
+	if _, err = b.PermittedCtx(context.Background(), net.ParseIP("10.0.0.1")); err == nil {
+		t.Fatal("expected the decider's error to be returned")
+	}
+
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should fail open")
+	}
+}
+
+func TestBreakerServesStale(t *testing.T) {
+	d := newTestDecider("10.0.0.1")
+	b, clock := newTestBreaker(d, t)
+
+	checkIPString(b, "10.0.0.1", t)
+
+	// The cached decision is stale; it is served while the
+	// decider is asked again in the background.
+	d.set(true, false)
+	clock.Advance(2 * time.Minute)
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should have served the stale decision")
+	}
+	waitForCalls(b, 2, t)
+
+	// The failed revalidation doesn't throw away the stale
+	// decision.
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should have served the stale decision")
+	}
+	waitForCalls(b, 3, t)
+
+	// Both revalidations failed, so the breaker is open and the
+	// stale decision is still served until it is too old.
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should have served the stale decision")
+	}
+
+	clock.Advance(time.Hour)
+	d.set(false, false)
+	if !checkIPString(b, "10.0.0.1", t) {
+		t.Fatal("breaker should have permitted address after recovery")
+	}
+
+	if stats := b.Stats(); stats.Stale != 3 || stats.State != BreakerClosed {
+		t.Fatalf("unexpected breaker stats %+v", stats)
+	}
+}
+
+func TestBreakerFails(t *testing.T) {
+	d := newTestDecider()
+	if _, err := NewBreaker(nil, testBreakerConfig); err == nil {
+		t.Fatal("NewBreaker should fail with a nil decider")
+	}
+
+	cfg := testBreakerConfig
+	cfg.Threshold = 0
+	if _, err := NewBreaker(d.Decide, cfg); err == nil {
+		t.Fatal("NewBreaker should fail with a zero threshold")
+	}
+
+	cfg = testBreakerConfig
+	cfg.Timeout = 0
+	if _, err := NewBreaker(d.Decide, cfg); err == nil {
+		t.Fatal("NewBreaker should fail with a zero timeout")
+	}
+
+	cfg = testBreakerConfig
+	cfg.CacheSize = -1
+	if _, err := NewBreaker(d.Decide, cfg); err == nil {
+		t.Fatal("NewBreaker should fail with a negative cache size")
+	}
+}
+
+func TestBreakerCacheSize(t *testing.T) {
+	d := newTestDecider("10.0.0.1")
+	cfg := testBreakerConfig
+	cfg.CacheSize = 1
+	b, err := NewBreaker(d.Decide, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	checkIPString(b, "10.0.0.1", t)
+	checkIPString(b, "10.0.0.2", t)
+	if n := b.CacheStats().Entries; n != 1 {
+		t.Fatalf("expected the cache to hold one decision, but it has %d", n)
+	}
+
+	// The older decision was evicted, so the decider is asked
+	// again.
+	checkIPString(b, "10.0.0.1", t)
+	if calls := b.Stats().Calls; calls != 3 {
+		t.Fatalf("expected 3 decider calls, have %d", calls)
+	}
+}
@@ -0,0 +1,145 @@
+package netallow
+
+// This file contains a bounded cache of access decisions, for ACLs
+// whose decisions are expensive to make.
+
+import (
+	"container/list"
+	"time"
+)
+
+// CacheStats reports the activity of a decision cache.
+type CacheStats struct {
+	Hits    uint64 // lookups answered from the cache
+	Misses  uint64 // lookups that weren't, including expired entries
+	Entries int    // decisions currently cached
+}
+
+type cacheEntry struct {
+	key       string
+	permitted bool
+	expires   time.Time
+}
+
+// DefaultCacheSize is the number of decisions a Breaker or RemoteACL
+// caches unless configured otherwise.
+const DefaultCacheSize = 10000
+
+// decisionCache is an LRU cache of access decisions, with separate
+// TTLs for permitted and denied addresses. Decisions past their TTL
+// are kept as stale for maxStale, and dropped after that. It isn't
+// safe for concurrent use; its owner must serialise access to it.
+type decisionCache struct {
+	size     int // 0 means unbounded
+	allowTTL time.Duration
+	denyTTL  time.Duration
+	maxStale time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // of *cacheEntry, most recently used first
+	hits     uint64
+	misses   uint64
+}
+
+func newDecisionCache(size int, allowTTL, denyTTL time.Duration) *decisionCache {
+	return &decisionCache{
+		size:     size,
+		allowTTL: allowTTL,
+		denyTTL:  denyTTL,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// lookup returns the cached decision for key if there is one that
+// can still be served; fresh is false if it is past its TTL and
+// only usable as a stale decision. Decisions too old to be served
+// are dropped.
+func (c *decisionCache) lookup(key string, now time.Time) (permitted, fresh, ok bool) {
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*cacheEntry)
+		if now.Before(entry.expires.Add(c.maxStale)) {
+			c.hits++
+			c.order.MoveToFront(elem)
+			return entry.permitted, now.Before(entry.expires), true
+		}
+		c.remove(elem)
+	}
+
+	c.misses++
+	return false, false, false
+}
+
+// put caches a decision for key, evicting the least recently used
+// decision if the cache is full. Decisions that couldn't be served,
+// because their TTL is zero and stale decisions aren't kept, aren't
+// cached.
+func (c *decisionCache) put(key string, permitted bool, now time.Time) {
+	ttl := c.denyTTL
+	if permitted {
+		ttl = c.allowTTL
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	if ttl+c.maxStale <= 0 {
+		return
+	}
+
+	c.prune(now)
+	c.evict(1)
+	c.entries[key] = c.order.PushFront(&cacheEntry{
+		key:       key,
+		permitted: permitted,
+		expires:   now.Add(ttl),
+	})
+}
+
+// evict removes least recently used decisions until there is room
+// for n more.
+func (c *decisionCache) evict(n int) {
+	if c.size <= 0 {
+		return
+	}
+
+	for c.order.Len() > 0 && c.order.Len()+n > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// prune drops decisions that are too old to be served from the
+// least recently used end of the cache, so that addresses that
+// aren't seen again don't hold on to their entries.
+func (c *decisionCache) prune(now time.Time) {
+	for elem := c.order.Back(); elem != nil; elem = c.order.Back() {
+		if now.Before(elem.Value.(*cacheEntry).expires.Add(c.maxStale)) {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+func (c *decisionCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// setLimits changes the cache's size and TTLs. Cached decisions keep
+// the expiry they were given, but the least recently used are
+// evicted if the cache is now too big.
+func (c *decisionCache) setLimits(size int, allowTTL, denyTTL time.Duration) {
+	c.size = size
+	c.allowTTL = allowTTL
+	c.denyTTL = denyTTL
+	c.evict(0)
+}
+
+func (c *decisionCache) stats() CacheStats {
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.order.Len(),
+	}
+}
@@ -0,0 +1,98 @@
+package netallow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecisionCacheTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newDecisionCache(0, time.Minute, time.Hour)
+	c.put("allowed", true, now)
+	c.put("denied", false, now)
+
+	if permitted, _, ok := c.lookup("allowed", now); !ok || !permitted {
+		t.Fatal("expected a cached allow decision")
+	}
+
+	if permitted, _, ok := c.lookup("denied", now); !ok || permitted {
+		t.Fatal("expected a cached deny decision")
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, ok := c.lookup("allowed", now); ok {
+		t.Fatal("allow decision should have expired")
+	}
+
+	if _, _, ok := c.lookup("denied", now); !ok {
+		t.Fatal("deny decision should outlive the allow TTL")
+	}
+
+	stats := c.stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// A zero TTL disables caching for those decisions.
+	c.setLimits(0, 0, time.Hour)
+	c.put("allowed", true, now)
+	if _, _, ok := c.lookup("allowed", now); ok {
+		t.Fatal("allow decisions shouldn't be cached with a zero TTL")
+	}
+}
+
+func TestDecisionCacheEviction(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newDecisionCache(2, time.Minute, time.Minute)
+	c.put("a", true, now)
+	c.put("b", true, now)
+
+	// Using a makes b the least recently used.
+	c.lookup("a", now)
+	c.put("c", false, now)
+
+	if _, _, ok := c.lookup("b", now); ok {
+		t.Fatal("least recently used decision should have been evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, _, ok := c.lookup(key, now); !ok {
+			t.Fatalf("expected %s to be cached", key)
+		}
+	}
+
+	c.setLimits(1, time.Minute, time.Minute)
+	if c.stats().Entries != 1 {
+		t.Fatalf("expected shrinking the cache to evict, but have %d entries", c.stats().Entries)
+	}
+
+	if _, _, ok := c.lookup("c", now); !ok {
+		t.Fatal("most recently used decision should have been kept")
+	}
+}
+
+func TestDecisionCacheStale(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newDecisionCache(0, time.Minute, time.Minute)
+	c.maxStale = time.Hour
+	c.put("a", true, now)
+	c.put("b", true, now)
+
+	now = now.Add(2 * time.Minute)
+	permitted, fresh, ok := c.lookup("a", now)
+	if !ok || fresh || !permitted {
+		t.Fatalf("expected a stale allow decision, have (%v, %v, %v)", permitted, fresh, ok)
+	}
+
+	// Decisions too old to be served are dropped, even if they
+	// aren't looked up again.
+	now = now.Add(time.Hour)
+	c.put("c", false, now)
+	if n := c.stats().Entries; n != 1 {
+		t.Fatalf("expected old decisions to have been dropped, but have %d entries", n)
+	}
+
+	if _, _, ok = c.lookup("a", now); ok {
+		t.Fatal("decision past its staleness bound shouldn't be served")
+	}
+}
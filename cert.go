@@ -0,0 +1,93 @@
+package netallow
+
+// This file contains support for gating requests on the client
+// certificate presented over mutual TLS, in addition to the client's
+// address.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CertFingerprint returns the hex-encoded SHA-256 fingerprint of the
+// leaf certificate the client presented on the request's TLS
+// connection.
+func CertFingerprint(req *http.Request) (string, error) {
+	if req == nil {
+		return "", errors.New("netallow: no request")
+	}
+
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return "", errors.New("netallow: no client certificate")
+	}
+
+	sum := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// normaliseFingerprint accepts fingerprints in either plain or
+// colon-separated hex, in either case.
+func normaliseFingerprint(fp string) string {
+	fp = strings.Replace(fp, ":", "", -1)
+	return strings.ToLower(strings.TrimSpace(fp))
+}
+
+// CertFingerprintACL stores a list of permitted client certificate
+// SHA-256 fingerprints. Fingerprints may be given as plain or
+// colon-separated hex.
+type CertFingerprintACL struct {
+	lock    *sync.Mutex
+	allowed map[string]bool
+}
+
+// NewCertFingerprintACL returns a new, empty certificate fingerprint
+// ACL.
+func NewCertFingerprintACL() *CertFingerprintACL {
+	return &CertFingerprintACL{
+		lock:    new(sync.Mutex),
+		allowed: map[string]bool{},
+	}
+}
+
+// Add permits the certificate with the fingerprint.
+func (acl *CertFingerprintACL) Add(fp string) {
+	fp = normaliseFingerprint(fp)
+	if fp == "" {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed[fp] = true
+}
+
+// Remove drops the certificate with the fingerprint from the ACL.
+func (acl *CertFingerprintACL) Remove(fp string) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.allowed, normaliseFingerprint(fp))
+}
+
+// PermittedFingerprint returns true if the certificate with the
+// fingerprint is permitted.
+func (acl *CertFingerprintACL) PermittedFingerprint(fp string) bool {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	return acl.allowed[normaliseFingerprint(fp)]
+}
+
+// PermittedRequest returns true if the request's client certificate
+// is permitted. Requests without a client certificate are never
+// permitted.
+func (acl *CertFingerprintACL) PermittedRequest(req *http.Request) bool {
+	fp, err := CertFingerprint(req)
+	if err != nil {
+		return false
+	}
+
+	return acl.PermittedFingerprint(fp)
+}
@@ -0,0 +1,119 @@
+package netallow
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testCertRaw = []byte("not really a DER certificate")
+
+func testCertRequest(withCert bool) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	if withCert {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{
+				{Raw: testCertRaw},
+			},
+		}
+	}
+	return req
+}
+
+func testCertFingerprint() string {
+	sum := sha256.Sum256(testCertRaw)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCertFingerprint(t *testing.T) {
+	if _, err := CertFingerprint(nil); err == nil {
+		t.Fatal("CertFingerprint should fail with a nil request")
+	}
+
+	if _, err := CertFingerprint(testCertRequest(false)); err == nil {
+		t.Fatal("CertFingerprint should fail without a client certificate")
+	}
+
+	fp, err := CertFingerprint(testCertRequest(true))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if fp != testCertFingerprint() {
+		t.Fatalf("expected fingerprint %s, but have %s", testCertFingerprint(), fp)
+	}
+}
+
+func TestCertFingerprintACL(t *testing.T) {
+	acl := NewCertFingerprintACL()
+	fp := testCertFingerprint()
+	if acl.PermittedFingerprint(fp) {
+		t.Fatal("ACL should have denied fingerprint")
+	}
+
+	// Add the fingerprint in the colon-separated form.
+	var pairs []string
+	for i := 0; i < len(fp); i += 2 {
+		pairs = append(pairs, strings.ToUpper(fp[i:i+2]))
+	}
+	acl.Add(strings.Join(pairs, ":"))
+
+	if !acl.PermittedFingerprint(fp) {
+		t.Fatal("ACL should have permitted fingerprint")
+	}
+
+	if acl.PermittedRequest(testCertRequest(false)) {
+		t.Fatal("ACL should have denied a request without a certificate")
+	}
+
+	acl.Remove(fp)
+	if acl.PermittedFingerprint(fp) {
+		t.Fatal("ACL should have denied fingerprint")
+	}
+}
+
+func TestHandlerRequireCert(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "127.0.0.1", t)
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	certs := NewCertFingerprintACL()
+	h.RequireCert(certs)
+
+	tv := []struct {
+		ip       string
+		withCert bool
+		allowFP  bool
+		expected string
+	}{
+		{"127.0.0.1", true, false, "NO"},
+		{"127.0.0.1", false, true, "NO"},
+		{"127.0.0.1", true, true, "OK"},
+		{"127.0.0.2", true, true, "NO"},
+	}
+
+	for _, tc := range tv {
+		if tc.allowFP {
+			certs.Add(testCertFingerprint())
+		} else {
+			certs.Remove(testCertFingerprint())
+		}
+
+		req := testCertRequest(tc.withCert)
+		req.RemoteAddr = tc.ip + ":4141"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != tc.expected {
+			t.Fatalf("Expected %s, but got %s", tc.expected, w.Body.String())
+		}
+	}
+}
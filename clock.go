@@ -0,0 +1,26 @@
+package netallow
+
+import "time"
+
+// A Clock tells the time. ACLs with time-dependent behaviour use a
+// Clock so that they can be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is a Clock backed by time.Now.
+var SystemClock Clock = systemClock{}
+
+// clockOrSystem returns c, or the system clock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
@@ -0,0 +1,31 @@
+package netallow
+
+import (
+	"sync"
+	"time"
+)
+
+// testClock is a Clock whose time only changes when it is advanced.
+type testClock struct {
+	lock *sync.Mutex
+	now  time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{
+		lock: new(sync.Mutex),
+		now:  time.Date(2020, 3, 14, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
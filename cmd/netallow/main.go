@@ -0,0 +1,383 @@
+// Command netallow manages and tests ACL files from the shell. The
+// files are in the form read by netallow.LoadMixed: one IP address
+// or CIDR network per line, with blank lines and lines starting with
+// '#' ignored, and host addresses optionally disabled with a "!"
+// prefix.
+//
+// Usage:
+//
+//	netallow lint FILE...          check files for invalid entries
+//	netallow check FILE IP...      test whether the file permits the IPs
+//	netallow add FILE ENTRY...     add addresses or networks to the file
+//	netallow remove FILE ENTRY...  remove addresses or networks from the file
+//
+// check exits with status 0 if every IP is permitted and 1 if any is
+// denied; the other commands exit with status 1 if they fail. Usage
+// errors exit with status 2. add and remove edit the file in place,
+// keeping its comments and the order of the other entries.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kisom/netallow"
+)
+
+const usage = `Usage: netallow COMMAND FILE [ARGS...]
+
+Commands:
+  lint FILE...          check files for invalid entries
+  check FILE IP...      test whether the file permits the IPs
+  add FILE ENTRY...     add addresses or networks to the file
+  remove FILE ENTRY...  remove addresses or networks from the file
+`
+
+// Exit statuses.
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command in args, writing results to stdout and
+// problems to stderr, and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("netallow", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	args = fs.Args()
+	if len(args) < 2 || (args[0] != "lint" && len(args) < 3) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var err error
+	status := exitOK
+	switch args[0] {
+	case "lint":
+		for _, path := range args[1:] {
+			var ok bool
+			ok, err = lint(path, stdout)
+			if err != nil {
+				break
+			}
+			if !ok {
+				status = exitFail
+			}
+		}
+	case "check":
+		var ok bool
+		ok, err = check(args[1], args[2:], stdout)
+		if !ok {
+			status = exitFail
+		}
+	case "add":
+		err = add(args[1], args[2:], stdout)
+	case "remove":
+		err = remove(args[1], args[2:], stdout)
+	default:
+		fmt.Fprintf(stderr, "netallow: unknown command %q\n", args[0])
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "netallow: %v\n", err)
+		return exitFail
+	}
+	return status
+}
+
+// canonicalEntry returns the canonical form of an ACL entry, as
+// netallow would store it, and a warning if the entry isn't written
+// in that form.
+func canonicalEntry(s string) (entry, warning string, err error) {
+	disabled := strings.HasPrefix(s, "!")
+	addr := strings.TrimPrefix(s, "!")
+	if strings.Contains(addr, "/") {
+		if disabled {
+			return "", "", errors.New("networks can't be disabled: " + s)
+		}
+
+		ip, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid network %s", s)
+		}
+
+		if !ip.Equal(n.IP) {
+			warning = fmt.Sprintf("%s has host bits set, and is the network %s", s, n)
+		}
+		return n.String(), warning, nil
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", "", fmt.Errorf("invalid address %s", s)
+	}
+
+	entry = ip.String()
+	if disabled {
+		entry = "!" + entry
+	}
+	return entry, "", nil
+}
+
+// isEntry returns true if line holds an entry rather than being
+// blank or a comment.
+func isEntry(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "#")
+}
+
+// readLines returns the lines of the file at path.
+func readLines(path string) ([]string, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// writeLines replaces the file at path with lines, keeping its
+// permissions. The new contents are written to a temporary file that
+// is renamed over the original, so readers never see a partial file.
+func writeLines(path string, lines []string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+
+	if err = w.Flush(); err == nil {
+		err = tmp.Chmod(info.Mode())
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lint reports invalid and duplicate entries in the file at path,
+// returning false if it found any problems. Entries that are valid
+// but not in canonical form are reported as warnings.
+func lint(path string, w io.Writer) (bool, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	var hosts, nets int
+	seen := map[string]int{}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !isEntry(line) {
+			continue
+		}
+
+		entry, warning, err := canonicalEntry(line)
+		if err != nil {
+			fmt.Fprintf(w, "%s:%d: %v\n", path, i+1, err)
+			ok = false
+			continue
+		}
+
+		if warning != "" {
+			fmt.Fprintf(w, "%s:%d: warning: %s\n", path, i+1, warning)
+		}
+
+		key := strings.TrimPrefix(entry, "!")
+		if first, dup := seen[key]; dup {
+			fmt.Fprintf(w, "%s:%d: %s duplicates line %d\n", path, i+1, line, first)
+			ok = false
+			continue
+		}
+		seen[key] = i + 1
+
+		if strings.Contains(entry, "/") {
+			nets++
+		} else {
+			hosts++
+		}
+	}
+
+	if ok {
+		fmt.Fprintf(w, "%s: ok, %d hosts and %d networks\n", path, hosts, nets)
+	}
+	return ok, nil
+}
+
+// load reads the ACL in the file at path.
+func load(path string) (*netallow.Combined, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := netallow.LoadMixed(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return acl, nil
+}
+
+// check reports whether the ACL in the file at path permits each of
+// the addresses, returning true if it permits all of them.
+func check(path string, addrs []string, w io.Writer) (bool, error) {
+	acl, err := load(path)
+	if err != nil {
+		return false, err
+	}
+
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip == nil {
+			return false, fmt.Errorf("invalid address %s", addr)
+		}
+	}
+
+	all := true
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if rule, permitted := acl.MatchRule(ip); permitted {
+			fmt.Fprintf(w, "%s: permitted by %s\n", addr, rule)
+		} else {
+			fmt.Fprintf(w, "%s: denied\n", addr)
+			all = false
+		}
+	}
+	return all, nil
+}
+
+// entryIndex returns the positions of the lines holding entry, which
+// must be in canonical form.
+func entryIndex(lines []string, entry string) []int {
+	var found []int
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !isEntry(line) {
+			continue
+		}
+
+		canonical, _, err := canonicalEntry(line)
+		if err == nil && strings.TrimPrefix(canonical, "!") == entry {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// add appends the entries that aren't already in the file at path.
+// Nothing is written, or reported as added, unless every entry is
+// valid.
+func add(path string, entries []string, w io.Writer) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+
+	var messages []string
+	var added int
+	for _, s := range entries {
+		entry, _, err := canonicalEntry(s)
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimPrefix(entry, "!")
+		if len(entryIndex(lines, key)) > 0 {
+			messages = append(messages, fmt.Sprintf("%s is already in %s", key, path))
+			continue
+		}
+
+		lines = append(lines, entry)
+		messages = append(messages, fmt.Sprintf("added %s to %s", entry, path))
+		added++
+	}
+
+	if added > 0 {
+		if err = writeLines(path, lines); err != nil {
+			return err
+		}
+	}
+
+	for _, message := range messages {
+		fmt.Fprintln(w, message)
+	}
+	return nil
+}
+
+// remove deletes the lines holding the entries from the file at
+// path. Nothing is written, or reported as removed, unless every
+// entry is found.
+func remove(path string, entries []string, w io.Writer) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+
+	var messages []string
+	for _, s := range entries {
+		entry, _, err := canonicalEntry(s)
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimPrefix(entry, "!")
+		found := entryIndex(lines, key)
+		if len(found) == 0 {
+			return fmt.Errorf("%s is not in %s", key, path)
+		}
+
+		for i := len(found) - 1; i >= 0; i-- {
+			lines = append(lines[:found[i]], lines[found[i]+1:]...)
+		}
+		messages = append(messages, fmt.Sprintf("removed %s from %s", key, path))
+	}
+
+	if err = writeLines(path, lines); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		fmt.Fprintln(w, message)
+	}
+	return nil
+}
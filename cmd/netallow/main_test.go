@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testACL = `# administrators
+127.0.0.1
+!192.0.2.7
+
+# office
+10.0.0.0/8
+`
+
+// writeTestFile writes contents to a file in a new temporary
+// directory, returning its path and a function that removes it.
+func writeTestFile(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "netallow")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	path := filepath.Join(dir, "acl.txt")
+	if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("%v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func runTest(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func readTestFile(t *testing.T, path string) string {
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return string(out)
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"check"},
+		{"check", "acl.txt"},
+		{"frob", "acl.txt", "10.0.0.1"},
+	} {
+		status, _, stderr := runTest(args...)
+		if status != exitUsage {
+			t.Fatalf("%v: expected status %d, have %d", args, exitUsage, status)
+		}
+
+		if !strings.Contains(stderr, "Usage:") {
+			t.Fatalf("%v: expected usage message, have %q", args, stderr)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path, cleanup := writeTestFile(t, testACL)
+	defer cleanup()
+
+	status, stdout, _ := runTest("check", path, "10.0.0.5")
+	if status != exitOK {
+		t.Fatalf("expected 10.0.0.5 to be permitted, have status %d", status)
+	}
+
+	if stdout != "10.0.0.5: permitted by 10.0.0.0/8\n" {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+
+	for _, addr := range []string{"192.0.2.7", "192.168.1.1"} {
+		status, stdout, _ = runTest("check", path, "127.0.0.1", addr)
+		if status != exitFail {
+			t.Fatalf("expected %s to be denied, have status %d", addr, status)
+		}
+
+		if !strings.Contains(stdout, addr+": denied\n") {
+			t.Fatalf("unexpected output %q", stdout)
+		}
+	}
+
+	status, _, stderr := runTest("check", path, "not-an-ip")
+	if status != exitFail || !strings.Contains(stderr, "invalid address") {
+		t.Fatalf("expected an invalid address to fail, have status %d and %q", status, stderr)
+	}
+
+	status, _, _ = runTest("check", path+".missing", "10.0.0.5")
+	if status != exitFail {
+		t.Fatalf("expected a missing file to fail, have status %d", status)
+	}
+}
+
+func TestLint(t *testing.T) {
+	path, cleanup := writeTestFile(t, testACL)
+	defer cleanup()
+
+	status, stdout, _ := runTest("lint", path)
+	if status != exitOK {
+		t.Fatalf("expected %s to pass, have status %d: %s", path, status, stdout)
+	}
+
+	if !strings.Contains(stdout, "ok, 2 hosts and 1 networks") {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+
+	bad, cleanupBad := writeTestFile(t, testACL+"10.0.0.0/33\n127.0.0.1\n192.168.1.5/24\n")
+	defer cleanupBad()
+
+	status, stdout, _ = runTest("lint", path, bad)
+	if status != exitFail {
+		t.Fatalf("expected %s to fail, have status %d", bad, status)
+	}
+
+	for _, problem := range []string{
+		bad + ":7: invalid network 10.0.0.0/33",
+		bad + ":8: 127.0.0.1 duplicates line 2",
+		bad + ":9: warning: 192.168.1.5/24 has host bits set",
+	} {
+		if !strings.Contains(stdout, problem) {
+			t.Fatalf("expected %q in %q", problem, stdout)
+		}
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	path, cleanup := writeTestFile(t, testACL)
+	defer cleanup()
+
+	status, _, stderr := runTest("add", path, "192.168.1.5/24", "::1", "127.0.0.1")
+	if status != exitOK {
+		t.Fatalf("add failed with status %d: %s", status, stderr)
+	}
+
+	expected := testACL + "192.168.1.0/24\n::1\n"
+	if have := readTestFile(t, path); have != expected {
+		t.Fatalf("expected file\n%s\nhave\n%s", expected, have)
+	}
+
+	status, _, _ = runTest("check", path, "192.168.1.20", "::1")
+	if status != exitOK {
+		t.Fatalf("expected added entries to be permitted, have status %d", status)
+	}
+
+	status, _, stderr = runTest("remove", path, "10.0.0.0/8", "192.0.2.7")
+	if status != exitOK {
+		t.Fatalf("remove failed with status %d: %s", status, stderr)
+	}
+
+	expected = "# administrators\n127.0.0.1\n\n# office\n192.168.1.0/24\n::1\n"
+	if have := readTestFile(t, path); have != expected {
+		t.Fatalf("expected file\n%s\nhave\n%s", expected, have)
+	}
+
+	// A missing entry fails the whole command without writing.
+	status, _, stderr = runTest("remove", path, "::1", "10.0.0.0/8")
+	if status != exitFail || !strings.Contains(stderr, "10.0.0.0/8 is not in") {
+		t.Fatalf("expected removing a missing entry to fail, have status %d and %q", status, stderr)
+	}
+
+	if have := readTestFile(t, path); have != expected {
+		t.Fatalf("expected file to be unchanged, have\n%s", have)
+	}
+
+	status, _, _ = runTest("add", path, "!10.0.0.0/8")
+	if status != exitFail {
+		t.Fatalf("expected a disabled network to be rejected, have status %d", status)
+	}
+}
+
+func TestAddRemoveInvalid(t *testing.T) {
+	path, cleanup := writeTestFile(t, testACL)
+	defer cleanup()
+
+	for _, args := range [][]string{
+		{"add", path, "10.0.0.2", "bogus"},
+		{"add", path, "192.168.1.0/24", "10.0.0.0/33"},
+		{"remove", path, "127.0.0.1", "10.9.9.9"},
+		{"remove", path, "10.0.0.0/8", "bogus"},
+	} {
+		status, stdout, stderr := runTest(args...)
+		if status != exitFail {
+			t.Fatalf("%v: expected status %d, have %d", args, exitFail, status)
+		}
+
+		if stdout != "" {
+			t.Fatalf("%v: nothing should be reported as changed, have %q", args, stdout)
+		}
+
+		if stderr == "" {
+			t.Fatalf("%v: expected an error message", args)
+		}
+
+		if have := readTestFile(t, path); have != testACL {
+			t.Fatalf("%v: expected file to be unchanged, have\n%s", args, have)
+		}
+	}
+
+	status, stdout, _ := runTest("add", path, "10.0.0.2", "127.0.0.1")
+	if status != exitOK {
+		t.Fatalf("expected add to succeed, have status %d", status)
+	}
+
+	expected := "added 10.0.0.2 to " + path + "\n127.0.0.1 is already in " + path + "\n"
+	if stdout != expected {
+		t.Fatalf("expected output %q, have %q", expected, stdout)
+	}
+}
@@ -0,0 +1,234 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// Combined is an ACL made of a host ACL and a network ACL; an
+// address is permitted if either of them permits it. It is intended
+// for the common case of a few individual addresses, such as
+// administrators' hosts, alongside a few networks.
+type Combined struct {
+	host HostACL
+	net  NetACL
+}
+
+// NewCombined returns an ACL permitting the addresses permitted by
+// either host or netACL.
+func NewCombined(host HostACL, netACL NetACL) *Combined {
+	return &Combined{
+		host: host,
+		net:  netACL,
+	}
+}
+
+// Permitted returns true if either the host or the network ACL
+// permits the IP.
+func (c *Combined) Permitted(ip net.IP) bool {
+	return c.host.Permitted(ip) || c.net.Permitted(ip)
+}
+
+// MatchRule returns true and the matching entry if either ACL
+// permits the IP. The host ACL is checked first.
+func (c *Combined) MatchRule(ip net.IP) (string, bool) {
+	if permitted, rule := matchRule(c.host, ip); permitted {
+		return rule, true
+	}
+
+	permitted, rule := matchRule(c.net, ip)
+	return rule, permitted
+}
+
+// Source identifies which of a Combined ACL's lists permitted an
+// address.
+type Source int
+
+const (
+	// SourceNone means that neither list permitted the address.
+	SourceNone Source = iota
+
+	// SourceHost means that the host ACL permitted the address.
+	SourceHost
+
+	// SourceNet means that the network ACL permitted the address.
+	SourceNet
+)
+
+// String returns the name of the source.
+func (s Source) String() string {
+	switch s {
+	case SourceNone:
+		return "none"
+	case SourceHost:
+		return "host"
+	case SourceNet:
+		return "net"
+	default:
+		return "unknown"
+	}
+}
+
+// netExplainer is implemented by network ACLs that can report the
+// network that permitted an address.
+type netExplainer interface {
+	Explain(net.IP) (bool, *net.IPNet)
+}
+
+// Explain returns true if the IP is permitted, along with the list
+// that permitted it and the matching entry, for diagnosing why an
+// address was or wasn't let in. As with MatchRule, the host ACL is
+// checked first. If the network ACL can explain its decisions, as
+// BasicNet can, the most specific matching network is reported.
+func (c *Combined) Explain(ip net.IP) (permitted bool, source Source, rule string) {
+	if permitted, rule = matchRule(c.host, ip); permitted {
+		return true, SourceHost, rule
+	}
+
+	if ex, ok := c.net.(netExplainer); ok {
+		if permitted, n := ex.Explain(ip); permitted {
+			return true, SourceNet, n.String()
+		}
+		return false, SourceNone, ""
+	}
+
+	if permitted, rule = matchRule(c.net, ip); permitted {
+		return true, SourceNet, rule
+	}
+	return false, SourceNone, ""
+}
+
+// AddIP adds the IP to the host ACL.
+func (c *Combined) AddIP(ip net.IP) {
+	c.host.Add(ip)
+}
+
+// RemoveIP removes the IP from the host ACL. It doesn't affect the
+// network ACL, which may still permit the IP.
+func (c *Combined) RemoveIP(ip net.IP) {
+	c.host.Remove(ip)
+}
+
+// AddNet adds the network to the network ACL.
+func (c *Combined) AddNet(n *net.IPNet) {
+	c.net.Add(n)
+}
+
+// RemoveNet removes the network from the network ACL.
+func (c *Combined) RemoveNet(n *net.IPNet) {
+	c.net.Remove(n)
+}
+
+// parseMixed parses s as either a network in CIDR notation or an IP
+// address; exactly one of n and ip is set if err is nil.
+func parseMixed(s string) (n *net.IPNet, ip net.IP, err error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, n, err = net.ParseCIDR(s)
+		return n, nil, err
+	}
+
+	ip = net.ParseIP(s)
+	if ip == nil {
+		return nil, nil, errors.New("netallow: invalid address " + s)
+	}
+	return nil, ip, nil
+}
+
+// AddString adds s to the network ACL if it is a network in CIDR
+// notation, or to the host ACL if it is an IP address. An error is
+// returned if it is neither, so input such as a form field can be
+// added without first working out what it holds.
+func (c *Combined) AddString(s string) error {
+	n, ip, err := parseMixed(s)
+	if err != nil {
+		return err
+	}
+
+	if n != nil {
+		c.AddNet(n)
+	} else {
+		c.AddIP(ip)
+	}
+	return nil
+}
+
+// RemoveString removes s from the network ACL if it is a network in
+// CIDR notation, or from the host ACL if it is an IP address.
+func (c *Combined) RemoveString(s string) error {
+	n, ip, err := parseMixed(s)
+	if err != nil {
+		return err
+	}
+
+	if n != nil {
+		c.RemoveNet(n)
+	} else {
+		c.RemoveIP(ip)
+	}
+	return nil
+}
+
+// LoadMixed loads a combined ACL from a byte slice where each line is
+// either an IP address, which is added to a Basic host ACL, or a
+// network in CIDR notation, which is added to a BasicNet. Blank lines
+// and lines starting with '#' are skipped. Host addresses may be
+// disabled with a "!" prefix, as in DumpBasic.
+func LoadMixed(in []byte) (*Combined, error) {
+	hosts := NewBasic()
+	nets := NewBasicNet()
+	for _, line := range strings.Split(string(in), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.Contains(line, "/") {
+			_, n, err := net.ParseCIDR(line)
+			if err != nil {
+				return nil, err
+			}
+			nets.Add(n)
+			continue
+		}
+
+		ip, enabled := parseEntry(line)
+		if ip == nil {
+			return nil, errors.New("netallow: invalid address " + line)
+		}
+		hosts.Add(ip)
+		if !enabled {
+			hosts.Disable(ip)
+		}
+	}
+	return NewCombined(hosts, nets), nil
+}
+
+// LoadFromEnv loads a combined ACL from the named environment
+// variable, which holds a comma-separated list of entries in the form
+// read by LoadMixed, such as "10.0.0.0/8,127.0.0.1". If the variable
+// is unset or empty, an empty ACL is returned.
+func LoadFromEnv(key string) (*Combined, error) {
+	return LoadMixed([]byte(strings.Replace(os.Getenv(key), ",", "\n", -1)))
+}
+
+// DumpMixed returns a combined ACL in the format read by LoadMixed:
+// the sorted host addresses, followed by the sorted networks. Both
+// of the combined ACLs must be able to list their entries, as Basic
+// and BasicNet can.
+func DumpMixed(c *Combined) ([]byte, error) {
+	hosts, ok := c.host.(entryLister)
+	if !ok {
+		return nil, errors.New("netallow: host ACL can't be listed")
+	}
+
+	nets, ok := c.net.(entryLister)
+	if !ok {
+		return nil, errors.New("netallow: network ACL can't be listed")
+	}
+
+	entries := append(hosts.entries(), nets.entries()...)
+	return []byte(strings.Join(entries, "\n")), nil
+}
@@ -0,0 +1,259 @@
+package netallow
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCombined(t *testing.T) {
+	acl := NewCombined(NewBasic(), NewBasicNet())
+	acl.AddIP(mustParseIP(t, "203.0.113.5"))
+	acl.AddNet(mustParseNet(t, "192.168.0.0/16"))
+
+	for addr, expected := range map[string]bool{
+		"203.0.113.5": true,
+		"203.0.113.6": false,
+		"192.168.1.1": true,
+		"10.0.0.1":    false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	rule, _ := acl.MatchRule(mustParseIP(t, "192.168.1.1"))
+	if rule != "192.168.0.0/16" {
+		t.Fatalf("expected match with 192.168.0.0/16, but have %q", rule)
+	}
+
+	// Removing a host doesn't affect a network containing it.
+	acl.AddIP(mustParseIP(t, "192.168.1.1"))
+	acl.RemoveIP(mustParseIP(t, "192.168.1.1"))
+	if !checkIPString(acl, "192.168.1.1", t) {
+		t.Fatal("network ACL should still permit the address")
+	}
+
+	acl.RemoveNet(mustParseNet(t, "192.168.0.0/16"))
+	acl.RemoveIP(mustParseIP(t, "203.0.113.5"))
+	if checkIPString(acl, "192.168.1.1", t) || checkIPString(acl, "203.0.113.5", t) {
+		t.Fatal("ACL should be empty")
+	}
+}
+
+func TestCombinedHandler(t *testing.T) {
+	acl := NewCombined(NewBasic(), NewBasicNet())
+	acl.AddIP(mustParseIP(t, "127.0.0.1"))
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+}
+
+var testMixed = `# hosts
+203.0.113.5
+2001:db8::1
+!203.0.113.6
+
+# networks
+192.168.0.0/16
+  2001:db8:1::/48  
+10.0.0.0/8
+`
+
+func TestLoadMixed(t *testing.T) {
+	acl, err := LoadMixed([]byte(testMixed))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"203.0.113.5":   true,
+		"203.0.113.6":   false,
+		"2001:db8::1":   true,
+		"2001:db8::2":   false,
+		"2001:db8:1::5": true,
+		"192.168.7.7":   true,
+		"10.1.2.3":      true,
+		"172.16.0.1":    false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	out, err := DumpMixed(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "!203.0.113.6\n2001:db8::1\n203.0.113.5\n10.0.0.0/8\n192.168.0.0/16\n2001:db8:1::/48"
+	if string(out) != expected {
+		t.Fatalf("expected\n%s\nbut have\n%s", expected, out)
+	}
+
+	reloaded, err := LoadMixed(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	again, err := DumpMixed(reloaded)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(again) != string(out) {
+		t.Fatalf("dump isn't stable: have\n%s", again)
+	}
+}
+
+func TestLoadMixedFails(t *testing.T) {
+	for _, in := range []string{
+		"192.168.0.0/33",
+		"203.0.113.256",
+		"10.0.0.1\nnot an address",
+	} {
+		if _, err := LoadMixed([]byte(in)); err == nil {
+			t.Fatalf("LoadMixed should fail on %q", in)
+		}
+	}
+
+	if _, err := DumpMixed(NewCombined(NewHostStub(), NewBasicNet())); err == nil {
+		t.Fatal("DumpMixed should fail when the host ACL can't be listed")
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	const key = "NETALLOW_TEST_IPS"
+	defer os.Unsetenv(key)
+
+	os.Setenv(key, " 10.0.0.0/8, 127.0.0.1,,2001:db8::/32,::1 ")
+	acl, err := LoadFromEnv(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"127.0.0.1":   true,
+		"127.0.0.2":   false,
+		"2001:db8::5": true,
+		"::1":         true,
+		"192.0.2.1":   false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	for _, value := range []string{"", " , "} {
+		os.Setenv(key, value)
+		acl, err = LoadFromEnv(key)
+		if err != nil {
+			t.Fatalf("%q: %v", value, err)
+		}
+
+		if checkIPString(acl, "127.0.0.1", t) {
+			t.Fatalf("%q: expected an empty ACL", value)
+		}
+	}
+
+	os.Unsetenv(key)
+	if _, err = LoadFromEnv(key); err != nil {
+		t.Fatalf("an unset variable should give an empty ACL, but have %v", err)
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "127.0.0.1,999.1.1.1", "10.0.0.0/8;127.0.0.1"} {
+		os.Setenv(key, value)
+		if _, err = LoadFromEnv(key); err == nil {
+			t.Fatalf("LoadFromEnv should reject %q", value)
+		}
+	}
+}
+
+func TestCombinedAddString(t *testing.T) {
+	acl := NewCombined(NewBasic(), NewBasicNet())
+	for _, s := range []string{"192.0.2.1", " 2001:db8::1 ", "10.0.0.0/8", "2001:db8:1::/48"} {
+		if err := acl.AddString(s); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":     true,
+		"192.0.2.2":     false,
+		"2001:db8::1":   true,
+		"2001:db8::2":   false,
+		"10.9.8.7":      true,
+		"2001:db8:1::5": true,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	// Hosts and networks went to the right ACLs.
+	if acl.host.(*Basic).Count() != 2 || acl.net.(*BasicNet).Count() != 2 {
+		t.Fatal("entries were added to the wrong ACL")
+	}
+
+	for _, s := range []string{"", "example.com", "10.0.0.0/33", "999.0.0.1", "192.0.2.1/", "/8"} {
+		if err := acl.AddString(s); err == nil {
+			t.Fatalf("AddString should reject %q", s)
+		}
+
+		if err := acl.RemoveString(s); err == nil {
+			t.Fatalf("RemoveString should reject %q", s)
+		}
+	}
+
+	for _, s := range []string{"192.0.2.1", "10.0.0.0/8"} {
+		if err := acl.RemoveString(s); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+
+	if checkIPString(acl, "192.0.2.1", t) || checkIPString(acl, "10.9.8.7", t) {
+		t.Fatal("entries should have been removed")
+	}
+}
+
+func TestCombinedExplain(t *testing.T) {
+	acl := NewCombined(NewBasic(), NewBasicNet())
+	acl.AddIP(mustParseIP(t, "10.1.2.3"))
+	acl.AddNet(mustParseNet(t, "10.0.0.0/8"))
+	acl.AddNet(mustParseNet(t, "192.168.0.0/16"))
+
+	for addr, expected := range map[string]struct {
+		source Source
+		rule   string
+	}{
+		"10.1.2.3":    {SourceHost, "10.1.2.3"},
+		"10.1.2.4":    {SourceNet, "10.0.0.0/8"},
+		"192.168.1.1": {SourceNet, "192.168.0.0/16"},
+		"203.0.113.1": {SourceNone, ""},
+	} {
+		permitted, source, rule := acl.Explain(mustParseIP(t, addr))
+		if permitted != (expected.source != SourceNone) || source != expected.source || rule != expected.rule {
+			t.Fatalf("expected Explain(%s) to be (%v, %s, %q), have (%v, %s, %q)",
+				addr, expected.source != SourceNone, expected.source, expected.rule,
+				permitted, source, rule)
+		}
+	}
+
+	// Network ACLs that can't explain themselves fall back to MatchRule.
+	stubbed := NewCombined(NewBasic(), NewNetStubWithLogger(log.New(ioutil.Discard, "", 0)))
+	if permitted, source, _ := stubbed.Explain(mustParseIP(t, "192.0.2.1")); !permitted || source != SourceNet {
+		t.Fatalf("expected the stub to permit the address, have (%v, %s)", permitted, source)
+	}
+}
@@ -0,0 +1,127 @@
+package netallow
+
+// This file contains support for inspecting a Handler's running
+// configuration.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// entryLister is implemented by ACLs that can list their entries.
+type entryLister interface {
+	entries() []string
+}
+
+// HandlerConfig is a snapshot of a Handler's configuration, for
+// debugging and detecting configuration drift. Secrets, such as
+// client certificate fingerprints and the destination of audit
+// records, are not included.
+type HandlerConfig struct {
+	// ACL is the type of the handler's ACL, e.g. "*netallow.Basic".
+	ACL string `json:"acl"`
+
+	// Entries lists the ACL's entries in sorted order, if the ACL
+	// is able to list them.
+	Entries []string `json:"entries,omitempty"`
+
+	// Lookup is the type of the handler's Lookup.
+	Lookup string `json:"lookup"`
+
+	// DenyStatus is the status returned to denied clients when
+	// there is no deny handler.
+	DenyStatus int `json:"deny_status"`
+
+	// LookupErrorStatus is the status returned when the client's
+	// address can't be found.
+	LookupErrorStatus int `json:"lookup_error_status"`
+
+	// LookupErrorPolicy is the name of the handler's
+	// LookupErrorPolicy.
+	LookupErrorPolicy string `json:"lookup_error_policy"`
+
+	// Family is the name of the handler's Family: "any",
+	// "ipv4", or "ipv6".
+	Family string `json:"family"`
+
+	// DenyHandler is true if denied requests are passed to a
+	// deny handler rather than getting the default response.
+	DenyHandler bool `json:"deny_handler"`
+
+	// DenyPage is true if a custom deny page has been set with
+	// SetDenyPage.
+	DenyPage bool `json:"deny_page"`
+
+	// Audit is true if access decisions are recorded to an
+	// AuditSink.
+	Audit bool `json:"audit"`
+
+	// Observer is true if access decisions are reported to an
+	// Observer.
+	Observer bool `json:"observer"`
+
+	// Bypass is true if the ACL bypass is on, so that every
+	// request is permitted; see SetBypass.
+	Bypass bool `json:"bypass"`
+
+	// Sessions is true if requests must come from the network
+	// their session was established from; see BindSessions.
+	Sessions bool `json:"session_binding"`
+
+	// ClientCerts is the number of permitted client certificates
+	// if a client certificate is required, and -1 otherwise.
+	ClientCerts int `json:"client_certs"`
+}
+
+// Config returns a snapshot of the handler's current configuration.
+func (h *Handler) Config() *HandlerConfig {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	cfg := &HandlerConfig{
+		ACL:               fmt.Sprintf("%T", h.allowed),
+		Lookup:            fmt.Sprintf("%T", h.lookup),
+		DenyStatus:        h.denyStatus,
+		LookupErrorStatus: h.lookupErrorStatus,
+		LookupErrorPolicy: h.lookupPolicy.String(),
+		Family:            h.family.String(),
+		DenyHandler:       h.denyHandler != nil,
+		DenyPage:          h.denyPage != nil,
+		Audit:             h.audit != nil,
+		Observer:          h.observer != nil,
+		Bypass:            h.Bypassed(),
+		Sessions:          h.sessions != nil,
+		ClientCerts:       -1,
+	}
+
+	if lister, ok := h.allowed.(entryLister); ok {
+		cfg.Entries = lister.entries()
+	}
+
+	if h.certs != nil {
+		h.certs.lock.Lock()
+		cfg.ClientCerts = len(h.certs.allowed)
+		h.certs.lock.Unlock()
+	}
+
+	return cfg
+}
+
+// ConfigHandler returns a handler that serves the handler's
+// configuration as JSON, for mounting on an admin route such as
+// /config. It doesn't check who is asking; it should be wrapped in
+// the caller's own access control.
+func ConfigHandler(h *Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		out, err := json.Marshal(h.Config())
+		if err != nil {
+			status := http.StatusInternalServerError
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	})
+}
@@ -0,0 +1,137 @@
+package netallow
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+// fixedLookup is a Lookup that always returns the same address.
+type fixedLookup struct {
+	ip net.IP
+}
+
+func (l fixedLookup) Address(args ...interface{}) (net.IP, error) {
+	if l.ip == nil {
+		return nil, errors.New("no address")
+	}
+	return l.ip, nil
+}
+
+func TestHandlerConfig(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	h, err := NewACLHandler(testAllowHandler, nil, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cfg := h.Config()
+	if cfg.ACL != "*netallow.Basic" || cfg.Lookup != "netallow.HTTPLookup" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	if len(cfg.Entries) != 1 || cfg.Entries[0] != "10.0.0.1" {
+		t.Fatalf("unexpected entries %v", cfg.Entries)
+	}
+
+	if cfg.DenyStatus != 401 || cfg.DenyHandler || cfg.ClientCerts != -1 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	netACL := NewBasicNet()
+	testAddNet(netACL, "192.168.0.0/16", t)
+	if err = h.SetACL(netACL); err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.SetLookup(fixedLookup{net.ParseIP("192.168.1.1")})
+
+	certs := NewCertFingerprintACL()
+	certs.Add("ab:cd")
+	h.RequireCert(certs)
+	h.SetFamily(V4Only)
+
+	cfg = h.Config()
+	if cfg.ACL != "*netallow.BasicNet" || cfg.Lookup != "netallow.fixedLookup" {
+		t.Fatalf("config doesn't reflect runtime changes: %+v", cfg)
+	}
+
+	if len(cfg.Entries) != 1 || cfg.Entries[0] != "192.168.0.0/16" {
+		t.Fatalf("unexpected entries %v", cfg.Entries)
+	}
+
+	if cfg.ClientCerts != 1 || cfg.Family != "ipv4" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	w := httptest.NewRecorder()
+	ConfigHandler(h).ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("invalid config response %s", w.Body.String())
+	}
+
+	var served HandlerConfig
+	if err = json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if served.ACL != cfg.ACL || len(served.Entries) != 1 {
+		t.Fatalf("unexpected served config %+v", served)
+	}
+}
+
+func TestHandlerSetLookup(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.168.1.1", t)
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "NO" {
+		t.Fatalf("Expected NO, but got %s", w.Body.String())
+	}
+
+	h.SetLookup(fixedLookup{net.ParseIP("192.168.1.1")})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+
+	h.SetLookup(nil)
+	if h.Config().Lookup != "netallow.HTTPLookup" {
+		t.Fatal("SetLookup(nil) should restore the default lookup")
+	}
+
+	if err = h.SetACL(nil); err == nil {
+		t.Fatal("SetACL should fail with a nil ACL")
+	}
+}
+
+func TestLookupTypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	ip, err := HTTPLookup{}.Address(req)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("unexpected address %s", ip)
+	}
+
+	if _, err = (HTTPLookup{}).Address(); err == nil {
+		t.Fatal("HTTPLookup should fail without a request")
+	}
+
+	if _, err = (ConnLookup{}).Address(req); err == nil {
+		t.Fatal("ConnLookup should fail without a connection")
+	}
+}
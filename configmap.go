@@ -0,0 +1,47 @@
+package netallow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoadConfigMap builds a network ACL from key-value data, such as
+// the data section of a Kubernetes ConfigMap or a set of
+// annotations. Each key is a label for its value, which is a list of
+// networks in CIDR notation separated by commas or whitespace; bare
+// IP addresses are treated as single-host networks. In multi-line
+// values, anything following a '#' on a line is a comment. The
+// networks from every key are merged into one ACL.
+//
+// If an entry fails to parse, the error names the key it came from.
+func LoadConfigMap(data map[string]string) (*BasicNet, error) {
+	var keys = make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	acl := NewBasicNet()
+	for _, key := range keys {
+		for _, line := range strings.Split(data[key], "\n") {
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+
+			fields := strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t' || r == '\r'
+			})
+
+			for _, field := range fields {
+				n, err := parseNet(field)
+				if err != nil {
+					return nil, fmt.Errorf("netallow: invalid network %q in key %s", field, key)
+				}
+				acl.Add(n)
+			}
+		}
+	}
+
+	return acl, nil
+}
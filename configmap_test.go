@@ -0,0 +1,56 @@
+package netallow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigMap(t *testing.T) {
+	data := map[string]string{
+		"office": "192.168.1.0/24, 192.168.2.0/24",
+		"vpn": `# managed by the network team
+10.8.0.0/16
+2001:db8::/32   # v6 range
+`,
+		"bastion": "203.0.113.10",
+		"empty":   "",
+	}
+
+	acl, err := LoadConfigMap(data)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(acl.allowed) != 5 {
+		t.Fatalf("expected 5 networks, but have %d", len(acl.allowed))
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.168.2.7":  true,
+		"10.8.3.4":     true,
+		"2001:db8::1":  true,
+		"203.0.113.10": true,
+		"203.0.113.11": false,
+		"172.16.0.1":   false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+}
+
+func TestLoadConfigMapFails(t *testing.T) {
+	data := map[string]string{
+		"office":  "192.168.1.0/24",
+		"partner": "10.0.0.0/8, 172.16.0.0/33",
+	}
+
+	_, err := LoadConfigMap(data)
+	if err == nil {
+		t.Fatal("LoadConfigMap should fail with an invalid network")
+	}
+
+	if !strings.Contains(err.Error(), "partner") || !strings.Contains(err.Error(), "172.16.0.0/33") {
+		t.Fatalf("error should name the key and entry, but is %v", err)
+	}
+}
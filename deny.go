@@ -0,0 +1,188 @@
+package netallow
+
+// This file contains the responses sent to clients that are denied
+// access by a Handler without a deny handler.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DenyPageData is passed to a deny page template.
+type DenyPageData struct {
+	// IP is the client's address.
+	IP string
+
+	// Reference identifies the denial. It is logged along with
+	// the client's address, so that a user who quotes it to
+	// support can be matched to the log entry.
+	Reference string
+}
+
+// A DenyPage is a custom response served to denied clients, such as
+// a branded HTML page.
+type DenyPage struct {
+	contentType string
+	body        []byte
+	tmpl        *template.Template
+}
+
+// NewDenyPage returns a deny page that serves body with the given
+// content type.
+func NewDenyPage(contentType string, body []byte) *DenyPage {
+	return &DenyPage{
+		contentType: contentType,
+		body:        body,
+	}
+}
+
+// NewDenyPageTemplate returns a deny page that executes tmpl with a
+// DenyPageData for each denial and serves the result as HTML.
+func NewDenyPageTemplate(tmpl *template.Template) *DenyPage {
+	return &DenyPage{
+		contentType: "text/html; charset=utf-8",
+		tmpl:        tmpl,
+	}
+}
+
+// newReference returns a random reference for a denial.
+func newReference() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// serve writes the deny page with the given status.
+func (p *DenyPage) serve(w http.ResponseWriter, ip net.IP, status int) {
+	body := p.body
+	if p.tmpl != nil {
+		data := DenyPageData{
+			IP:        ipString(ip),
+			Reference: newReference(),
+		}
+		log.Printf("netallow: denied %s (reference %s)", data.IP, data.Reference)
+
+		var buf bytes.Buffer
+		if err := p.tmpl.Execute(&buf, data); err != nil {
+			log.Printf("failed to render deny page: %v", err)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		body = buf.Bytes()
+	}
+
+	w.Header().Set("Content-Type", p.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Media types that deny responses can be written in, in order of
+// preference when a client accepts several equally.
+var denyMediaTypes = []string{"text/plain", "text/html", "application/json"}
+
+// acceptQuality returns the quality the Accept header gives the
+// media type, using the most specific matching range. A missing
+// header accepts everything.
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+
+	slash := strings.Index(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var s int
+		switch mediaRange {
+		case mediaType:
+			s = 2
+		case mediaType[:slash] + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s < specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
+
+// negotiateDeny returns the media type for a deny response. Plain
+// text is used if the header is missing or nothing acceptable is
+// available.
+func negotiateDeny(accept string) string {
+	best, bestQuality := "text/plain", 0.0
+	for _, mediaType := range denyMediaTypes {
+		if q := acceptQuality(accept, mediaType); q > bestQuality {
+			best, bestQuality = mediaType, q
+		}
+	}
+	return best
+}
+
+const denyHTML = `<!DOCTYPE html>
+<html><head><title>%[1]d %[2]s</title></head>
+<body><h1>%[1]d %[2]s</h1></body></html>
+`
+
+// writeDeny writes the built-in deny response, choosing JSON, HTML,
+// or plain text from the request's Accept header. A deny page, if
+// there is one, is used for clients that don't ask for JSON.
+func writeDeny(w http.ResponseWriter, req *http.Request, ip net.IP, page *DenyPage, status int) {
+	mediaType := negotiateDeny(req.Header.Get("Accept"))
+	if mediaType == "application/json" {
+		out, _ := json.Marshal(map[string]interface{}{
+			"status": status,
+			"error":  http.StatusText(status),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		w.Write(out)
+		return
+	}
+
+	if page != nil {
+		page.serve(w, ip, status)
+		return
+	}
+
+	if mediaType == "text/html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, denyHTML, status, http.StatusText(status))
+		return
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
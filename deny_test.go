@@ -0,0 +1,161 @@
+package netallow
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func testDenied(h http.Handler, t *testing.T) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, but have %d", http.StatusUnauthorized, w.Code)
+	}
+	return w
+}
+
+func TestDenyPageDefault(t *testing.T) {
+	h, err := NewHandler(testAllowHandler, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w := testDenied(h, t)
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+}
+
+func TestDenyPageStatic(t *testing.T) {
+	h, err := NewACLHandler(testAllowHandler, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	body := "<h1>Access denied</h1>"
+	h.SetDenyPage(NewDenyPage("text/html", []byte(body)))
+	w := testDenied(h, t)
+	if ct := w.Header().Get("Content-Type"); ct != "text/html" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	if w.Body.String() != body {
+		t.Fatalf("expected %s, but got %s", body, w.Body.String())
+	}
+
+	// The deny handler takes precedence over the deny page.
+	h, err = NewACLHandler(testAllowHandler, testDenyHandler, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.SetDenyPage(NewDenyPage("text/html", []byte(body)))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "NO" {
+		t.Fatalf("expected NO, but got %s", w.Body.String())
+	}
+}
+
+func TestDenyPageTemplate(t *testing.T) {
+	h, err := NewACLHandler(testAllowHandler, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tmpl := template.Must(template.New("deny").Parse(
+		`<p>{{.IP}} is not permitted; quote {{.Reference}}.</p>`))
+	h.SetDenyPage(NewDenyPageTemplate(tmpl))
+
+	w := testDenied(h, t)
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	expected := regexp.MustCompile(`^<p>192\.0\.2\.1 is not permitted; quote [0-9a-f]{16}\.</p>$`)
+	if !expected.MatchString(w.Body.String()) {
+		t.Fatalf("unexpected deny page %s", w.Body.String())
+	}
+
+	h.SetDenyPage(nil)
+	if w = testDenied(h, t); w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatal("clearing the deny page should restore the default")
+	}
+}
+
+func TestNegotiateDeny(t *testing.T) {
+	tv := map[string]string{
+		"":                 "text/plain",
+		"*/*":              "text/plain",
+		"application/json": "application/json",
+		"application/*":    "application/json",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": "text/html",
+		"application/json;q=0.5, text/html":                               "text/html",
+		"text/*;q=0.1, application/json":                                  "application/json",
+		"image/png":                                                       "text/plain",
+		"text/plain;q=0, */*":                                             "text/html",
+	}
+
+	for accept, expected := range tv {
+		if mediaType := negotiateDeny(accept); mediaType != expected {
+			t.Fatalf("Accept %q: expected %s, but have %s", accept, expected, mediaType)
+		}
+	}
+}
+
+func TestDenyAccept(t *testing.T) {
+	h, err := NewACLHandler(testAllowHandler, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "text/plain; charset=utf-8", "Unauthorized\n"},
+		{"application/json", "application/json", `{"error":"Unauthorized","status":401}`},
+		{"text/html", "text/html; charset=utf-8", ""},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:4141"
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Accept %q: expected status %d, but have %d",
+				tc.accept, http.StatusUnauthorized, w.Code)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != tc.contentType {
+			t.Fatalf("Accept %q: unexpected content type %s", tc.accept, ct)
+		}
+
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Fatalf("Accept %q: unexpected body %s", tc.accept, w.Body.String())
+		}
+	}
+
+	// JSON clients get JSON even with a deny page.
+	h.SetDenyPage(NewDenyPage("text/html", []byte("<h1>Go away</h1>")))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+}
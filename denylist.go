@@ -0,0 +1,98 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Denylist is a host ACL with the opposite sense to Basic: it stores
+// addresses that are blocked, and permits every other address.
+// Invalid addresses are never permitted. Like Basic, it is a set of
+// string addresses guarded by a mutex.
+type Denylist struct {
+	lock   *sync.Mutex
+	denied map[string]bool
+}
+
+// NewDenylist returns a new, empty denylist, which permits every
+// valid address.
+func NewDenylist() *Denylist {
+	return &Denylist{
+		lock:   new(sync.Mutex),
+		denied: map[string]bool{},
+	}
+}
+
+// Permitted returns true if the IP is valid and isn't in the
+// denylist.
+func (acl *Denylist) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	return !acl.denied[ip.String()]
+}
+
+// Add blocks the IP.
+func (acl *Denylist) Add(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.denied[ip.String()] = true
+}
+
+// Remove unblocks the IP.
+func (acl *Denylist) Remove(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.denied, ip.String())
+}
+
+// DumpDenylist returns a denylist as a byte slice where each IP is on
+// its own line.
+func DumpDenylist(acl *Denylist) []byte {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+
+	var addrs = make([]string, 0, len(acl.denied))
+	for ip := range acl.denied {
+		addrs = append(addrs, ip)
+	}
+
+	sort.Strings(addrs)
+	return []byte(strings.Join(addrs, "\n"))
+}
+
+// LoadDenylist loads a denylist from a byte slice. As with LoadBasic,
+// surrounding whitespace is ignored, as are blank lines and lines
+// starting with '#'.
+func LoadDenylist(in []byte) (*Denylist, error) {
+	acl := NewDenylist()
+	addrs := strings.Split(string(in), "\n")
+
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || strings.HasPrefix(addr, "#") {
+			continue
+		}
+
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, errors.New("netallow: invalid address " + addr)
+		}
+		acl.Add(ip)
+	}
+	return acl, nil
+}
@@ -0,0 +1,100 @@
+package netallow
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDenylist(t *testing.T) {
+	acl := NewDenylist()
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("empty denylist should permit everything")
+	}
+
+	addIPString(acl, "192.0.2.1", t)
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("denylist should have denied listed address")
+	}
+
+	if !checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("denylist should have permitted unlisted address")
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("denylist should not permit an invalid address")
+	}
+
+	delIPString(acl, "192.0.2.1", t)
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("denylist should have permitted removed address")
+	}
+}
+
+func TestDenylistDumpLoad(t *testing.T) {
+	acl := NewDenylist()
+	addIPString(acl, "192.0.2.2", t)
+	addIPString(acl, "192.0.2.1", t)
+
+	out := DumpDenylist(acl)
+	if string(out) != "192.0.2.1\n192.0.2.2" {
+		t.Fatalf("unexpected dump %q", out)
+	}
+
+	loaded, err := LoadDenylist(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if checkIPString(loaded, "192.0.2.1", t) || !checkIPString(loaded, "192.0.2.3", t) {
+		t.Fatal("loaded denylist doesn't match the original")
+	}
+
+	if _, err = LoadDenylist([]byte("192.0.2.256")); err == nil {
+		t.Fatal("LoadDenylist should fail with an invalid address")
+	}
+}
+
+func TestDenylistLoadBlank(t *testing.T) {
+	// An empty denylist round-trips.
+	loaded, err := LoadDenylist(DumpDenylist(NewDenylist()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(DumpDenylist(loaded)) != 0 {
+		t.Fatalf("expected an empty denylist, have %q", DumpDenylist(loaded))
+	}
+
+	// A trailing newline, blank lines, comments, and surrounding
+	// whitespace are ignored.
+	loaded, err = LoadDenylist([]byte("# scanners\n 10.0.0.1 \n\n10.0.0.2\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(DumpDenylist(loaded)) != "10.0.0.1\n10.0.0.2" {
+		t.Fatalf("unexpected dump %q", DumpDenylist(loaded))
+	}
+}
+
+func TestDenylistHandler(t *testing.T) {
+	acl := NewDenylist()
+	addIPString(acl, "192.0.2.1", t)
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for remote, expected := range map[string]string{
+		"192.0.2.1:4141": "NO",
+		"192.0.2.2:4141": "OK",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("%s: expected %s, but got %s", remote, expected, w.Body.String())
+		}
+	}
+}
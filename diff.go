@@ -0,0 +1,85 @@
+package netallow
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// permittedSet returns the addresses the ACL permits, keyed by their
+// string form.
+func (acl *Basic) permittedSet() map[string]bool {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	var set = make(map[string]bool, len(acl.allowed))
+	for addr, enabled := range acl.allowed {
+		if enabled {
+			set[addr] = true
+		}
+	}
+	return set
+}
+
+// onlyIn returns the addresses in a but not in b, sorted.
+func onlyIn(a, b map[string]bool) []net.IP {
+	var ips []net.IP
+	for addr := range a {
+		if !b[addr] {
+			ips = append(ips, net.ParseIP(addr))
+		}
+	}
+
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// DiffBasic compares two versions of a host ACL, returning the
+// addresses newACL permits that oldACL didn't, and those oldACL
+// permitted that newACL doesn't. Enabling an address counts as adding
+// it, and disabling it as removing it. Both lists are sorted.
+func DiffBasic(oldACL, newACL *Basic) (added, removed []net.IP) {
+	oldSet := oldACL.permittedSet()
+	newSet := newACL.permittedSet()
+	return onlyIn(newSet, oldSet), onlyIn(oldSet, newSet)
+}
+
+// netSet returns the networks in the ACL, keyed by their string form.
+func (acl *BasicNet) netSet() map[string]*net.IPNet {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	var set = make(map[string]*net.IPNet, len(acl.allowed))
+	for _, n := range acl.allowed {
+		if n != nil {
+			set[n.String()] = n
+		}
+	}
+	return set
+}
+
+// onlyInNets returns the networks in a but not in b, sorted.
+func onlyInNets(a, b map[string]*net.IPNet) []*net.IPNet {
+	var nets []*net.IPNet
+	for s, n := range a {
+		if _, ok := b[s]; !ok {
+			nets = append(nets, n)
+		}
+	}
+
+	sortNets(nets)
+	return nets
+}
+
+// DiffBasicNet compares two versions of a network ACL, returning the
+// networks in newACL that aren't in oldACL, and those in oldACL that
+// aren't in newACL. Networks are compared by their CIDR notation, so
+// replacing 10.0.0.0/16 with 10.0.0.0/8 is reported as adding one
+// and removing the other. Both lists are sorted.
+func DiffBasicNet(oldACL, newACL *BasicNet) (added, removed []*net.IPNet) {
+	oldSet := oldACL.netSet()
+	newSet := newACL.netSet()
+	return onlyInNets(newSet, oldSet), onlyInNets(oldSet, newSet)
+}
@@ -0,0 +1,65 @@
+package netallow
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func ipStrings(ips []net.IP) string {
+	return fmt.Sprint(ips)
+}
+
+func netStrings(nets []*net.IPNet) string {
+	return fmt.Sprint(nets)
+}
+
+func TestDiffBasic(t *testing.T) {
+	oldACL := NewBasic()
+	addIPString(oldACL, "192.0.2.1", t)
+	addIPString(oldACL, "192.0.2.2", t)
+	addIPString(oldACL, "192.0.2.3", t)
+	addIPString(oldACL, "192.0.2.4", t)
+	oldACL.Disable(mustParseIP(t, "192.0.2.4"))
+
+	newACL := NewBasic()
+	addIPString(newACL, "192.0.2.1", t)
+	addIPString(newACL, "2001:db8::1", t)
+	addIPString(newACL, "192.0.2.4", t)
+	addIPString(newACL, "192.0.2.3", t)
+	newACL.Disable(mustParseIP(t, "192.0.2.3"))
+
+	added, removed := DiffBasic(oldACL, newACL)
+	if have := ipStrings(added); have != "[192.0.2.4 2001:db8::1]" {
+		t.Fatalf("unexpected added addresses %s", have)
+	}
+
+	if have := ipStrings(removed); have != "[192.0.2.2 192.0.2.3]" {
+		t.Fatalf("unexpected removed addresses %s", have)
+	}
+
+	added, removed = DiffBasic(newACL, newACL)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatal("an ACL should have no differences from itself")
+	}
+}
+
+func TestDiffBasicNet(t *testing.T) {
+	oldACL := NewBasicNet()
+	testAddNet(oldACL, "10.0.0.0/16", t)
+	testAddNet(oldACL, "192.168.1.0/24", t)
+
+	newACL := NewBasicNet()
+	testAddNet(newACL, "10.0.0.0/8", t)
+	testAddNet(newACL, "192.168.1.0/24", t)
+	testAddNet(newACL, "2001:db8::/32", t)
+
+	added, removed := DiffBasicNet(oldACL, newACL)
+	if have := netStrings(added); have != "[10.0.0.0/8 2001:db8::/32]" {
+		t.Fatalf("unexpected added networks %s", have)
+	}
+
+	if have := netStrings(removed); have != "[10.0.0.0/16]" {
+		t.Fatalf("unexpected removed networks %s", have)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -17,7 +16,10 @@ func addIP(w http.ResponseWriter, r *http.Request) {
 	addr := r.FormValue("ip")
 
 	ip := net.ParseIP(addr)
-	acl.Add(ip)
+	if err := acl.AddChecked(ip); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid address %q.\n", addr), http.StatusBadRequest)
+		return
+	}
 	log.Printf("request to add %s to the ACL", addr)
 	w.Write([]byte(fmt.Sprintf("Added %s to ACL.\n", addr)))
 }
@@ -26,20 +28,14 @@ func delIP(w http.ResponseWriter, r *http.Request) {
 	addr := r.FormValue("ip")
 
 	ip := net.ParseIP(addr)
-	acl.Remove(ip)
+	if err := acl.RemoveChecked(ip); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid address %q.\n", addr), http.StatusBadRequest)
+		return
+	}
 	log.Printf("request to remove %s from the ACL", addr)
 	w.Write([]byte(fmt.Sprintf("Removed %s from ACL.\n", ip)))
 }
 
-func dumpACL(w http.ResponseWriter, r *http.Request) {
-	out, err := json.Marshal(acl)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	} else {
-		w.Write(out)
-	}
-}
-
 func main() {
 	root := flag.String("root", "files/", "file server root")
 	flag.Parse()
@@ -49,8 +45,7 @@ func main() {
 	acl.Add(net.IP{127, 0, 0, 1})
 
 	adminACL := netallow.NewBasic()
-	adminACL.Add(net.IP{127, 0, 0, 1})
-	adminACL.Add(net.ParseIP("::1"))
+	netallow.AddLoopback(adminACL)
 
 	protFiles, err := netallow.NewHandler(fileServer, nil, acl)
 	if err != nil {
@@ -67,7 +62,7 @@ func main() {
 		log.Fatalf("%v", err)
 	}
 
-	dumpHandler, err := netallow.NewHandlerFunc(dumpACL, nil, adminACL)
+	dumpHandler, err := netallow.NewHandler(netallow.DumpHandler(acl), nil, adminACL)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
@@ -0,0 +1,207 @@
+package netallow
+
+// This file contains a host ACL whose entries can expire, such as
+// temporary access granted after an authentication challenge.
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExpiringBasic is a host ACL whose entries may be given a time to
+// live. Expired addresses are denied, and are dropped when they are
+// next checked or by Expire, which may be run periodically with
+// StartReaper.
+type ExpiringBasic struct {
+	lock    *sync.Mutex
+	clock   Clock
+	allowed map[string]time.Time // zero if the entry doesn't expire
+}
+
+// NewExpiringBasic returns a new, empty expiring host ACL.
+func NewExpiringBasic() *ExpiringBasic {
+	return &ExpiringBasic{
+		lock:    new(sync.Mutex),
+		clock:   SystemClock,
+		allowed: map[string]time.Time{},
+	}
+}
+
+// SetClock sets the clock used to expire entries. A nil clock
+// selects the system clock.
+func (acl *ExpiringBasic) SetClock(clock Clock) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.clock = clockOrSystem(clock)
+}
+
+// expired returns true if an entry with the expiry has expired at
+// now.
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// Add permits the IP without an expiry. If the IP is already in the
+// ACL, its expiry is removed.
+func (acl *ExpiringBasic) Add(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed[ip.String()] = time.Time{}
+}
+
+// AddWithTTL permits the IP for d. If the IP is already in the ACL,
+// its expiry is replaced.
+func (acl *ExpiringBasic) AddWithTTL(ip net.IP, d time.Duration) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed[ip.String()] = acl.clock.Now().Add(d)
+}
+
+// Remove drops the IP from the ACL.
+func (acl *ExpiringBasic) Remove(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.allowed, ip.String())
+}
+
+// Permitted returns true if the IP is in the ACL and hasn't expired.
+// An expired IP is dropped from the ACL.
+func (acl *ExpiringBasic) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	addr := ip.String()
+	expires, ok := acl.allowed[addr]
+	if !ok {
+		return false
+	}
+
+	if expired(expires, acl.clock.Now()) {
+		delete(acl.allowed, addr)
+		return false
+	}
+	return true
+}
+
+// Expire removes expired addresses from the ACL, returning the
+// number removed.
+func (acl *ExpiringBasic) Expire() int {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	now := acl.clock.Now()
+	removed := 0
+	for addr, expires := range acl.allowed {
+		if expired(expires, now) {
+			delete(acl.allowed, addr)
+			removed++
+		}
+	}
+	return removed
+}
+
+// DefaultReapInterval is the interval used by StartReaper when it is
+// given an interval that isn't positive.
+const DefaultReapInterval = time.Minute
+
+// reapInterval returns interval if it is positive, and
+// DefaultReapInterval otherwise.
+func reapInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return DefaultReapInterval
+	}
+	return interval
+}
+
+// StartReaper calls Expire every interval in a new goroutine, until
+// the returned stop function is called. An interval that isn't
+// positive is replaced by DefaultReapInterval.
+func (acl *ExpiringBasic) StartReaper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(reapInterval(interval))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				acl.Expire()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// DumpExpiringBasic returns the ACL as a byte slice where each IP is
+// on its own line, followed by its expiry in RFC 3339 format if it
+// has one. Expired addresses are left out.
+func DumpExpiringBasic(acl *ExpiringBasic) []byte {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+
+	now := acl.clock.Now()
+	var lines = make([]string, 0, len(acl.allowed))
+	for addr, expires := range acl.allowed {
+		switch {
+		case expires.IsZero():
+			lines = append(lines, addr)
+		case !expired(expires, now):
+			lines = append(lines, addr+" "+expires.UTC().Format(time.RFC3339Nano))
+		}
+	}
+
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// LoadExpiringBasic loads an ACL written by DumpExpiringBasic.
+// Addresses that have expired since the dump was written are
+// dropped when they are next checked.
+func LoadExpiringBasic(in []byte) (*ExpiringBasic, error) {
+	acl := NewExpiringBasic()
+	for _, line := range strings.Split(string(in), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil || len(fields) > 2 {
+			return nil, errors.New("netallow: invalid entry " + line)
+		}
+
+		var expires time.Time
+		if len(fields) == 2 {
+			var err error
+			expires, err = time.Parse(time.RFC3339Nano, fields[1])
+			if err != nil {
+				return nil, errors.New("netallow: invalid expiry in entry " + line)
+			}
+		}
+		acl.allowed[ip.String()] = expires
+	}
+	return acl, nil
+}
@@ -0,0 +1,169 @@
+package netallow
+
+// This file contains a network ACL whose entries can expire, for
+// temporary grants such as a partner's office range for a week.
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type expiringNetEntry struct {
+	net     *net.IPNet
+	expires time.Time // zero if the entry doesn't expire
+}
+
+// ExpiringNet is a network ACL whose entries may be given a time to
+// live. Expired networks are skipped by Permitted as soon as they
+// expire, and are removed from memory by Expire, which may be run
+// periodically with StartReaper.
+type ExpiringNet struct {
+	lock    *sync.Mutex
+	clock   Clock
+	allowed []expiringNetEntry
+}
+
+// NewExpiringNet returns a new, empty expiring network ACL.
+func NewExpiringNet() *ExpiringNet {
+	return &ExpiringNet{
+		lock:  new(sync.Mutex),
+		clock: SystemClock,
+	}
+}
+
+// SetClock sets the clock used to expire entries. A nil clock
+// selects the system clock.
+func (acl *ExpiringNet) SetClock(clock Clock) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.clock = clockOrSystem(clock)
+}
+
+// expired returns true if the entry has expired at now.
+func (e expiringNetEntry) expired(now time.Time) bool {
+	return expired(e.expires, now)
+}
+
+// set adds the canonical network with the given expiry, replacing
+// the expiry of an existing entry for the same network.
+func (acl *ExpiringNet) set(n *net.IPNet, expires time.Time) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for i := range acl.allowed {
+		if acl.allowed[i].net.String() == n.String() {
+			acl.allowed[i].expires = expires
+			return
+		}
+	}
+
+	acl.allowed = append(acl.allowed, expiringNetEntry{net: n, expires: expires})
+}
+
+// Add permits the network without an expiry. If the network is
+// already in the ACL, its expiry is removed. As with BasicNet, the
+// network address is stored, so 10.0.0.5/24 is the same network as
+// 10.0.0.0/24.
+func (acl *ExpiringNet) Add(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	acl.set(n, time.Time{})
+}
+
+// AddWithTTL permits the network for d. If the network is already in
+// the ACL, its expiry is replaced.
+func (acl *ExpiringNet) AddWithTTL(n *net.IPNet, d time.Duration) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	acl.lock.Lock()
+	expires := acl.clock.Now().Add(d)
+	acl.lock.Unlock()
+	acl.set(n, expires)
+}
+
+// Remove drops the network from the ACL. Any host bits set in the
+// network's address are ignored, as they are by Add.
+func (acl *ExpiringNet) Remove(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for i := range acl.allowed {
+		if acl.allowed[i].net.String() == n.String() {
+			acl.allowed = append(acl.allowed[:i], acl.allowed[i+1:]...)
+			return
+		}
+	}
+}
+
+// Permitted returns true if the IP is in a network that hasn't
+// expired.
+func (acl *ExpiringNet) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	now := acl.clock.Now()
+	for _, e := range acl.allowed {
+		if e.net.Contains(ip) && !e.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expire removes expired networks from the ACL, returning the
+// number removed.
+func (acl *ExpiringNet) Expire() int {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	now := acl.clock.Now()
+	kept := acl.allowed[:0]
+	for _, e := range acl.allowed {
+		if !e.expired(now) {
+			kept = append(kept, e)
+		}
+	}
+
+	removed := len(acl.allowed) - len(kept)
+	for i := len(kept); i < len(acl.allowed); i++ {
+		acl.allowed[i] = expiringNetEntry{}
+	}
+	acl.allowed = kept
+	return removed
+}
+
+// StartReaper calls Expire every interval in a new goroutine, until
+// the returned stop function is called. As with ExpiringBasic, an
+// interval that isn't positive is replaced by DefaultReapInterval.
+func (acl *ExpiringNet) StartReaper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(reapInterval(interval))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				acl.Expire()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
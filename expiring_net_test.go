@@ -0,0 +1,123 @@
+package netallow
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExpiringNet(t *testing.T) {
+	acl := NewExpiringNet()
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	testAddNet(acl, "10.0.0.0/8", t)
+	acl.AddWithTTL(mustParseNet(t, "192.168.1.0/24"), time.Hour)
+
+	if !checkIPString(acl, "192.168.1.5", t) {
+		t.Fatal("ACL should have permitted address in temporary network")
+	}
+
+	clock.Advance(time.Hour)
+	if checkIPString(acl, "192.168.1.5", t) {
+		t.Fatal("ACL should have denied address in expired network")
+	}
+
+	if !checkIPString(acl, "10.1.2.3", t) {
+		t.Fatal("ACL should have permitted address in permanent network")
+	}
+
+	if n := acl.Expire(); n != 1 {
+		t.Fatalf("expected 1 network to be expired, but have %d", n)
+	}
+
+	if n := acl.Expire(); n != 0 {
+		t.Fatalf("expected no networks to be expired, but have %d", n)
+	}
+
+	testDelNet(acl, "10.0.0.0/8", t)
+	if checkIPString(acl, "10.1.2.3", t) {
+		t.Fatal("ACL should have denied address in removed network")
+	}
+}
+
+func TestExpiringNetRenew(t *testing.T) {
+	acl := NewExpiringNet()
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	n := mustParseNet(t, "192.168.1.0/24")
+	acl.AddWithTTL(n, time.Hour)
+	clock.Advance(30 * time.Minute)
+	acl.AddWithTTL(n, time.Hour)
+	clock.Advance(45 * time.Minute)
+	if !checkIPString(acl, "192.168.1.5", t) {
+		t.Fatal("renewed network should not have expired")
+	}
+
+	// Adding without a TTL makes the grant permanent.
+	acl.Add(n)
+	clock.Advance(24 * time.Hour)
+	if !checkIPString(acl, "192.168.1.5", t) {
+		t.Fatal("permanent network should not have expired")
+	}
+}
+
+func TestExpiringNetReaper(t *testing.T) {
+	acl := NewExpiringNet()
+	acl.AddWithTTL(mustParseNet(t, "192.168.1.0/24"), time.Millisecond)
+
+	stop := acl.StartReaper(time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		acl.lock.Lock()
+		remaining := len(acl.allowed)
+		acl.lock.Unlock()
+		if remaining == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the reaper")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+}
+
+func TestExpiringNetReaperInterval(t *testing.T) {
+	// A bad interval is replaced rather than panicking.
+	stop := NewExpiringNet().StartReaper(-time.Second)
+	stop()
+}
+
+func TestExpiringNetCanonical(t *testing.T) {
+	acl := NewExpiringNet()
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	// The same network with and without host bits is one entry.
+	acl.AddWithTTL(&net.IPNet{IP: net.IP{10, 0, 0, 5}, Mask: net.CIDRMask(24, 32)}, time.Hour)
+	acl.Add(mustParseNet(t, "10.0.0.0/24"))
+	if len(acl.allowed) != 1 || acl.allowed[0].net.String() != "10.0.0.0/24" {
+		t.Fatalf("expected a single 10.0.0.0/24 entry, have %v", acl.allowed)
+	}
+
+	// Add removed the expiry.
+	clock.Advance(2 * time.Hour)
+	if !checkIPString(acl, "10.0.0.200", t) {
+		t.Fatal("the network should no longer expire")
+	}
+
+	acl.Remove(&net.IPNet{IP: net.IP{10, 0, 0, 77}, Mask: net.CIDRMask(24, 32)})
+	if len(acl.allowed) != 0 || checkIPString(acl, "10.0.0.200", t) {
+		t.Fatal("the network should have been removed")
+	}
+
+	acl.Add(&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}})
+	if len(acl.allowed) != 0 {
+		t.Fatal("a network with a non-contiguous mask shouldn't be added")
+	}
+}
@@ -0,0 +1,125 @@
+package netallow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiringBasic(t *testing.T) {
+	acl := NewExpiringBasic()
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	addIPString(acl, "10.0.0.1", t)
+	acl.AddWithTTL(mustParseIP(t, "10.0.0.2"), time.Minute)
+	acl.AddWithTTL(mustParseIP(t, "10.0.0.3"), time.Hour)
+
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if !checkIPString(acl, addr, t) {
+			t.Fatalf("ACL should have permitted %s", addr)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	if checkIPString(acl, "10.0.0.2", t) {
+		t.Fatal("ACL should have denied expired address")
+	}
+
+	// The expired address was dropped when it was checked.
+	if _, ok := acl.allowed["10.0.0.2"]; ok {
+		t.Fatal("expired address should have been dropped")
+	}
+
+	clock.Advance(time.Hour)
+	if n := acl.Expire(); n != 1 {
+		t.Fatalf("expected 1 address to be expired, but have %d", n)
+	}
+
+	if !checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("ACL should have permitted permanent address")
+	}
+
+	delIPString(acl, "10.0.0.1", t)
+	if checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("ACL should have denied removed address")
+	}
+}
+
+func TestExpiringBasicDumpLoad(t *testing.T) {
+	acl := NewExpiringBasic()
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	addIPString(acl, "10.0.0.1", t)
+	acl.AddWithTTL(mustParseIP(t, "10.0.0.2"), time.Hour)
+	acl.AddWithTTL(mustParseIP(t, "10.0.0.3"), time.Minute)
+	clock.Advance(time.Minute)
+
+	out := DumpExpiringBasic(acl)
+	expected := "10.0.0.1\n10.0.0.2 2020-03-14T01:00:00Z"
+	if string(out) != expected {
+		t.Fatalf("expected dump %q, but have %q", expected, out)
+	}
+
+	loaded, err := LoadExpiringBasic(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	loaded.SetClock(clock)
+
+	if !checkIPString(loaded, "10.0.0.1", t) || !checkIPString(loaded, "10.0.0.2", t) {
+		t.Fatal("loaded ACL should have permitted both addresses")
+	}
+
+	// The expiry survived the round trip.
+	clock.Advance(time.Hour)
+	if checkIPString(loaded, "10.0.0.2", t) || !checkIPString(loaded, "10.0.0.1", t) {
+		t.Fatal("loaded ACL should have expired 10.0.0.2")
+	}
+
+	for _, in := range []string{"10.0.0.256", "10.0.0.1 tomorrow", "10.0.0.1 a b"} {
+		if _, err = LoadExpiringBasic([]byte(in)); err == nil {
+			t.Fatalf("LoadExpiringBasic should fail on %q", in)
+		}
+	}
+}
+
+func TestExpiringBasicReaper(t *testing.T) {
+	acl := NewExpiringBasic()
+	acl.AddWithTTL(mustParseIP(t, "10.0.0.1"), time.Millisecond)
+
+	stop := acl.StartReaper(time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		acl.lock.Lock()
+		remaining := len(acl.allowed)
+		acl.lock.Unlock()
+		if remaining == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the reaper")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExpiringBasicReaperInterval(t *testing.T) {
+	for interval, expected := range map[time.Duration]time.Duration{
+		-time.Second: DefaultReapInterval,
+		0:            DefaultReapInterval,
+		time.Second:  time.Second,
+	} {
+		if have := reapInterval(interval); have != expected {
+			t.Fatalf("expected interval %v for %v, have %v", expected, interval, have)
+		}
+	}
+
+	// A bad interval is replaced rather than panicking.
+	stop := NewExpiringBasic().StartReaper(0)
+	stop()
+	stop()
+}
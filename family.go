@@ -0,0 +1,103 @@
+package netallow
+
+// This file contains support for restricting access to a single
+// address family.
+
+import (
+	"net"
+	"net/http"
+)
+
+// Family selects which address families are permitted.
+//
+// IPv4-mapped IPv6 addresses (::ffff:a.b.c.d), which dual-stack
+// sockets report for IPv4 clients, are treated as IPv4: they are
+// denied by V6Only and permitted by V4Only. This matches how the
+// rest of the package stores them.
+type Family int
+
+const (
+	// AnyFamily permits both IPv4 and IPv6 addresses.
+	AnyFamily Family = iota
+
+	// V4Only permits only IPv4 addresses.
+	V4Only
+
+	// V6Only permits only IPv6 addresses.
+	V6Only
+)
+
+// String returns the name of the family.
+func (f Family) String() string {
+	switch f {
+	case AnyFamily:
+		return "any"
+	case V4Only:
+		return "ipv4"
+	case V6Only:
+		return "ipv6"
+	default:
+		return "unknown"
+	}
+}
+
+// Permits returns true if the IP belongs to a permitted family.
+func (f Family) Permits(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	switch f {
+	case AnyFamily:
+		return true
+	case V4Only:
+		return ip.To4() != nil
+	case V6Only:
+		return ip.To4() == nil
+	default:
+		return false
+	}
+}
+
+// FamilyACL denies addresses of the wrong family before consulting
+// the ACL it wraps.
+type FamilyACL struct {
+	family Family
+	acl    ACL
+}
+
+// NewFamilyACL returns an ACL that only permits addresses in the
+// family that acl also permits.
+func NewFamilyACL(acl ACL, family Family) *FamilyACL {
+	return &FamilyACL{
+		family: family,
+		acl:    acl,
+	}
+}
+
+// MatchRule returns true and the entry that matched if the IP is in
+// the permitted family and the wrapped ACL permits it.
+func (acl *FamilyACL) MatchRule(ip net.IP) (string, bool) {
+	if !acl.family.Permits(ip) {
+		return "", false
+	}
+
+	permitted, rule := matchRule(acl.acl, ip)
+	return rule, permitted
+}
+
+// Permitted returns true if the IP is in the permitted family and
+// the wrapped ACL permits it.
+func (acl *FamilyACL) Permitted(ip net.IP) bool {
+	return acl.family.Permits(ip) && acl.acl.Permitted(ip)
+}
+
+// checkRequest checks the family before passing the request to the
+// wrapped ACL.
+func (acl *FamilyACL) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	if !acl.family.Permits(ip) {
+		return req, false, ""
+	}
+
+	return checkRequest(acl.acl, req, ip)
+}
@@ -0,0 +1,80 @@
+package netallow
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFamilyACL(t *testing.T) {
+	inner := NewHostStub()
+
+	tv := []struct {
+		family   Family
+		addr     string
+		expected bool
+	}{
+		{AnyFamily, "192.168.1.1", true},
+		{AnyFamily, "2001:db8::1", true},
+		{V4Only, "192.168.1.1", true},
+		{V4Only, "::ffff:192.168.1.1", true},
+		{V4Only, "2001:db8::1", false},
+		{V6Only, "192.168.1.1", false},
+		{V6Only, "::ffff:192.168.1.1", false},
+		{V6Only, "2001:db8::1", true},
+	}
+
+	for _, tc := range tv {
+		acl := NewFamilyACL(inner, tc.family)
+		if checkIPString(acl, tc.addr, t) != tc.expected {
+			t.Fatalf("%s: expected Permitted(%s) to be %v",
+				tc.family, tc.addr, tc.expected)
+		}
+	}
+
+	acl := NewFamilyACL(NewBasic(), V4Only)
+	if checkIPString(acl, "192.168.1.1", t) {
+		t.Fatal("ACL should have denied address missing from the wrapped ACL")
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("ACL should have denied invalid address")
+	}
+}
+
+func TestFamilyHandler(t *testing.T) {
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, NewHostStub())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		family   Family
+		remote   string
+		expected string
+	}{
+		{AnyFamily, "127.0.0.1:4141", "OK"},
+		{AnyFamily, "[::1]:4141", "OK"},
+		{V4Only, "127.0.0.1:4141", "OK"},
+		{V4Only, "[::1]:4141", "NO"},
+		{V6Only, "127.0.0.1:4141", "NO"},
+		{V6Only, "[::ffff:127.0.0.1]:4141", "NO"},
+		{V6Only, "[::1]:4141", "OK"},
+
+		// Without a family, the ACL decides on addresses that
+		// aren't valid IPs.
+		{AnyFamily, "localhost:4141", "OK"},
+		{V4Only, "localhost:4141", "NO"},
+	}
+
+	for _, tc := range tv {
+		h.SetFamily(tc.family)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != tc.expected {
+			t.Fatalf("%s from %s: expected %s, but got %s",
+				tc.family, tc.remote, tc.expected, w.Body.String())
+		}
+	}
+}
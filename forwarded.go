@@ -0,0 +1,91 @@
+package netallow
+
+// This file contains a Lookup for services behind reverse proxies,
+// which pass the client's address in the X-Forwarded-For header.
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ForwardedHTTPLookup is a Lookup that finds the client's address in
+// the X-Forwarded-For header set by trusted reverse proxies. A
+// single *http.Request should be passed to Address.
+//
+// The header is walked from right to left, skipping the addresses of
+// trusted proxies, and the first untrusted address is returned. If
+// every address is trusted, the leftmost one is returned. If the
+// header is absent, the request's remote address is used. Because a
+// client can set the header itself, it is only believed if the
+// request came directly from a trusted proxy; otherwise Address
+// returns an error.
+type ForwardedHTTPLookup struct {
+	trusted []*net.IPNet
+}
+
+// NewForwardedHTTPLookup returns a lookup that trusts proxies in the
+// networks, which are given in CIDR notation or as bare addresses.
+func NewForwardedHTTPLookup(trusted ...string) (*ForwardedHTTPLookup, error) {
+	lookup := &ForwardedHTTPLookup{}
+	for _, s := range trusted {
+		n, err := parseNet(s)
+		if err != nil {
+			return nil, errors.New("netallow: invalid trusted proxy " + s)
+		}
+		lookup.trusted = append(lookup.trusted, n)
+	}
+	return lookup, nil
+}
+
+// isTrusted returns true if the IP is a trusted proxy.
+func (lookup *ForwardedHTTPLookup) isTrusted(ip net.IP) bool {
+	for _, n := range lookup.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Address returns the client address of the *http.Request.
+func (lookup *ForwardedHTTPLookup) Address(args ...interface{}) (net.IP, error) {
+	if len(args) != 1 {
+		return nil, errors.New("netallow: lookup requires an *http.Request")
+	}
+
+	req, ok := args[0].(*http.Request)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires an *http.Request")
+	}
+
+	peer, err := HTTPRequestLookup(req)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := req.Header["X-Forwarded-For"]
+	if len(headers) == 0 {
+		return peer, nil
+	}
+
+	if peer == nil || !lookup.isTrusted(peer) {
+		return nil, errors.New("netallow: X-Forwarded-For from untrusted peer " + ipString(peer))
+	}
+
+	hops := strings.Split(strings.Join(headers, ","), ",")
+	var ip net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip = net.ParseIP(hop)
+		if ip == nil {
+			return nil, errors.New("netallow: invalid X-Forwarded-For address " + hop)
+		}
+
+		if !lookup.isTrusted(ip) {
+			return ip, nil
+		}
+	}
+	return ip, nil
+}
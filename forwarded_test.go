@@ -0,0 +1,105 @@
+package netallow
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedHTTPLookup(t *testing.T) {
+	lookup, err := NewForwardedHTTPLookup("127.0.0.1", "10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		remote   string
+		xff      []string
+		expected string
+	}{
+		{"127.0.0.1:4141", nil, "127.0.0.1"},
+		{"203.0.113.9:4141", nil, "203.0.113.9"},
+		{"127.0.0.1:4141", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"127.0.0.1:4141", []string{"203.0.113.9, 10.1.1.1"}, "203.0.113.9"},
+		// The client prepended its own entry; the first untrusted
+		// address from the right is the real client.
+		{"127.0.0.1:4141", []string{"192.0.2.66, 203.0.113.9, 10.1.1.1"}, "203.0.113.9"},
+		{"127.0.0.1:4141", []string{"192.0.2.66", "203.0.113.9"}, "203.0.113.9"},
+		{"127.0.0.1:4141", []string{"10.2.2.2, 10.1.1.1"}, "10.2.2.2"},
+		{"[::1]:4141", nil, "::1"},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		for _, h := range tc.xff {
+			req.Header.Add("X-Forwarded-For", h)
+		}
+
+		ip, err := lookup.Address(req)
+		if err != nil {
+			t.Fatalf("%s %v: %v", tc.remote, tc.xff, err)
+		}
+
+		if ip.String() != tc.expected {
+			t.Fatalf("%s %v: expected %s, but have %s", tc.remote, tc.xff, tc.expected, ip)
+		}
+	}
+}
+
+func TestForwardedHTTPLookupFails(t *testing.T) {
+	lookup, err := NewForwardedHTTPLookup("127.0.0.1")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		remote string
+		xff    string
+	}{
+		// A spoofed header from a client that isn't a proxy.
+		{"203.0.113.9:4141", "127.0.0.1"},
+		{"127.0.0.1:4141", "not-an-address"},
+		{"127.0.0.1", "203.0.113.9"},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-For", tc.xff)
+		if _, err = lookup.Address(req); err == nil {
+			t.Fatalf("%s %s: lookup should fail", tc.remote, tc.xff)
+		}
+	}
+
+	if _, err = lookup.Address("127.0.0.1"); err == nil {
+		t.Fatal("lookup should fail without a request")
+	}
+
+	if _, err = NewForwardedHTTPLookup("10.0.0.0/33"); err == nil {
+		t.Fatal("NewForwardedHTTPLookup should fail with an invalid network")
+	}
+}
+
+func TestForwardedHTTPLookupHandler(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "203.0.113.9", t)
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	lookup, err := NewForwardedHTTPLookup("127.0.0.1")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.SetLookup(lookup)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,56 @@
+package netallow
+
+import (
+	"net"
+)
+
+// frozenBasic is an immutable copy of a Basic. Since it never
+// changes, it can be read without a lock.
+type frozenBasic struct {
+	allowed map[string]bool
+	single  net.IP
+}
+
+// Freeze returns a read-only copy of the ACL's current contents, for
+// allow-lists that stop changing after startup. Checks against the
+// copy don't take a lock, which saves the cost of the Basic's lock
+// on a busy request path. Changes made to acl afterwards aren't seen
+// by the copy. The copy has no Add or Remove methods, and so can't be
+// used as a HostACL; freeze the Basic again to pick up changes.
+func Freeze(acl *Basic) ACL {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	frozen := &frozenBasic{
+		allowed: make(map[string]bool, len(acl.allowed)),
+		single:  acl.single,
+	}
+	for addr, enabled := range acl.allowed {
+		if enabled {
+			frozen.allowed[addr] = true
+		}
+	}
+	return frozen
+}
+
+// Permitted returns true if the IP was allowed access when the ACL
+// was frozen.
+func (acl *frozenBasic) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	if acl.single != nil {
+		return equalSingle(acl.single, ip)
+	}
+	return acl.allowed[ip.String()]
+}
+
+// MatchRule returns true and the address as it is stored in the ACL
+// if the IP is allowed access.
+func (acl *frozenBasic) MatchRule(ip net.IP) (string, bool) {
+	if !acl.Permitted(ip) {
+		return "", false
+	}
+	return ip.String(), true
+}
@@ -0,0 +1,91 @@
+package netallow
+
+import (
+	"net"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{"127.0.0.1", "::1", "192.0.2.7"} {
+		addIPString(acl, addr, t)
+	}
+	acl.Disable(mustParseIP(t, "192.0.2.7"))
+
+	frozen := Freeze(acl)
+	if _, ok := frozen.(HostACL); ok {
+		t.Fatal("a frozen ACL shouldn't be modifiable")
+	}
+
+	for addr, expected := range map[string]bool{
+		"127.0.0.1":        true,
+		"::ffff:127.0.0.1": true,
+		"::1":              true,
+		"192.0.2.7":        false,
+		"192.0.2.8":        false,
+	} {
+		if checkIPString(frozen, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if frozen.Permitted(nil) {
+		t.Fatal("an invalid IP shouldn't be permitted")
+	}
+
+	permitted, rule := matchRule(frozen, mustParseIP(t, "::1"))
+	if !permitted || rule != "::1" {
+		t.Fatalf("expected match with ::1, have %q", rule)
+	}
+
+	// Later changes to the Basic don't affect the frozen copy.
+	delIPString(acl, "127.0.0.1", t)
+	addIPString(acl, "192.0.2.8", t)
+	if !checkIPString(frozen, "127.0.0.1", t) || checkIPString(frozen, "192.0.2.8", t) {
+		t.Fatal("the frozen ACL should not change")
+	}
+}
+
+func TestFreezeSingle(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	frozen := Freeze(acl)
+
+	// Clearing the Basic replaces its single-entry fast path rather
+	// than modifying it, so the frozen copy keeps the address.
+	acl.Clear()
+	if !checkIPString(frozen, "10.0.0.1", t) || checkIPString(frozen, "10.0.0.2", t) {
+		t.Fatal("the frozen ACL should permit only its one address")
+	}
+}
+
+// benchmarkParallel checks an address against a 1000-entry ACL from
+// many goroutines at once.
+func benchmarkParallel(b *testing.B, acl ACL) {
+	ip := net.IP{127, 0, 0, 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if !acl.Permitted(ip) {
+				b.Fatal("address should have been permitted")
+			}
+		}
+	})
+}
+
+func benchmarkFreezeACL() *Basic {
+	acl := NewBasic()
+	for i := 0; i < 1000; i++ {
+		acl.Add(net.IPv4(127, 0, byte(i>>8), byte(i+1)))
+	}
+	return acl
+}
+
+func BenchmarkFreezeBasic(b *testing.B) {
+	benchmarkParallel(b, benchmarkFreezeACL())
+}
+
+func BenchmarkFreezeFrozen(b *testing.B) {
+	benchmarkParallel(b, Freeze(benchmarkFreezeACL()))
+}
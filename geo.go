@@ -0,0 +1,139 @@
+package netallow
+
+// This file contains an ACL that permits clients by the country or
+// autonomous system their address belongs to.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// GeoInfo describes where an address is located.
+type GeoInfo struct {
+	// Country is the ISO 3166-1 alpha-2 country code.
+	Country string
+
+	// ASN is the number of the autonomous system that
+	// originates the address.
+	ASN uint32
+}
+
+// A GeoResolver looks up location information for an address; it
+// will usually be backed by a GeoIP database.
+type GeoResolver interface {
+	Resolve(net.IP) (GeoInfo, error)
+}
+
+// geoPermitter is implemented by ACLs that resolve location
+// information while making a decision. The Handler stores the
+// resolved information in the request context so that the allow
+// handler doesn't have to resolve it again.
+type geoPermitter interface {
+	PermittedGeo(net.IP) (bool, *GeoInfo)
+}
+
+// GeoACL permits addresses located in an allowed country or
+// autonomous system. Addresses that can't be resolved are denied.
+type GeoACL struct {
+	lock      *sync.Mutex
+	resolver  GeoResolver
+	countries map[string]bool
+	asns      map[uint32]bool
+}
+
+// NewGeoACL returns a new, empty GeoACL that resolves addresses with
+// r.
+func NewGeoACL(r GeoResolver) (*GeoACL, error) {
+	if r == nil {
+		return nil, errors.New("netallow: resolver cannot be nil")
+	}
+
+	return &GeoACL{
+		lock:      new(sync.Mutex),
+		resolver:  r,
+		countries: map[string]bool{},
+		asns:      map[uint32]bool{},
+	}, nil
+}
+
+// AddCountry permits addresses in the country.
+func (acl *GeoACL) AddCountry(country string) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.countries[strings.ToUpper(country)] = true
+}
+
+// RemoveCountry stops permitting addresses in the country.
+func (acl *GeoACL) RemoveCountry(country string) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.countries, strings.ToUpper(country))
+}
+
+// AddASN permits addresses in the autonomous system.
+func (acl *GeoACL) AddASN(asn uint32) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.asns[asn] = true
+}
+
+// RemoveASN stops permitting addresses in the autonomous system.
+func (acl *GeoACL) RemoveASN(asn uint32) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.asns, asn)
+}
+
+// PermittedGeo returns true if the IP is permitted, along with the
+// location information resolved for it. The information is nil if
+// the address couldn't be resolved.
+func (acl *GeoACL) PermittedGeo(ip net.IP) (bool, *GeoInfo) {
+	if !validIP(ip) {
+		return false, nil
+	}
+
+	info, err := acl.resolver.Resolve(ip)
+	if err != nil {
+		return false, nil
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	permitted := acl.countries[strings.ToUpper(info.Country)] || acl.asns[info.ASN]
+	return permitted, &info
+}
+
+// Permitted returns true if the IP is permitted.
+func (acl *GeoACL) Permitted(ip net.IP) bool {
+	permitted, _ := acl.PermittedGeo(ip)
+	return permitted
+}
+
+type geoContextKey struct{}
+
+func withGeoInfo(ctx context.Context, info *GeoInfo) context.Context {
+	return context.WithValue(ctx, geoContextKey{}, info)
+}
+
+// CountryFromContext returns the country resolved for the client
+// address by a Handler whose ACL is a GeoACL.
+func CountryFromContext(ctx context.Context) (string, bool) {
+	info, ok := ctx.Value(geoContextKey{}).(*GeoInfo)
+	if !ok {
+		return "", false
+	}
+	return info.Country, true
+}
+
+// ASNFromContext returns the autonomous system number resolved for
+// the client address by a Handler whose ACL is a GeoACL.
+func ASNFromContext(ctx context.Context) (uint32, bool) {
+	info, ok := ctx.Value(geoContextKey{}).(*GeoInfo)
+	if !ok {
+		return 0, false
+	}
+	return info.ASN, true
+}
@@ -0,0 +1,111 @@
+package netallow
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testGeoResolver map[string]GeoInfo
+
+func (r testGeoResolver) Resolve(ip net.IP) (GeoInfo, error) {
+	info, ok := r[ip.String()]
+	if !ok {
+		return GeoInfo{}, errors.New("no location for " + ip.String())
+	}
+	return info, nil
+}
+
+var testGeo = testGeoResolver{
+	"192.0.2.1":    {Country: "NZ", ASN: 64500},
+	"198.51.100.1": {Country: "US", ASN: 64501},
+	"203.0.113.1":  {Country: "US", ASN: 64502},
+}
+
+func TestGeoACL(t *testing.T) {
+	if _, err := NewGeoACL(nil); err == nil {
+		t.Fatal("NewGeoACL should fail with a nil resolver")
+	}
+
+	acl, err := NewGeoACL(testGeo)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	acl.AddCountry("nz")
+	acl.AddASN(64502)
+
+	tv := map[string]bool{
+		"192.0.2.1":    true,
+		"198.51.100.1": false,
+		"203.0.113.1":  true,
+		"10.0.0.1":     false,
+	}
+	for addr, expected := range tv {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	acl.RemoveCountry("NZ")
+	acl.RemoveASN(64502)
+	if checkIPString(acl, "192.0.2.1", t) || checkIPString(acl, "203.0.113.1", t) {
+		t.Fatal("ACL should have denied address")
+	}
+}
+
+func TestGeoContext(t *testing.T) {
+	acl, err := NewGeoACL(testGeo)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	acl.AddCountry("NZ")
+
+	geoHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		country, ok := CountryFromContext(r.Context())
+		if !ok {
+			w.Write([]byte("none"))
+			return
+		}
+
+		asn, _ := ASNFromContext(r.Context())
+		fmt.Fprintf(w, "%s AS%d", country, asn)
+	})
+
+	h, err := NewHandler(geoHandler, geoHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := map[string]string{
+		"192.0.2.1":    "NZ AS64500",
+		"198.51.100.1": "US AS64501",
+		"10.0.0.1":     "none",
+	}
+	for addr, expected := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr + ":4141"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("Expected %s, but got %s", expected, w.Body.String())
+		}
+	}
+
+	// Handlers with other ACLs don't populate the context.
+	h, err = NewHandler(geoHandler, geoHandler, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "none" {
+		t.Fatalf("Expected none, but got %s", w.Body.String())
+	}
+}
@@ -2,4 +2,7 @@ module github.com/kisom/netallow
 
 go 1.14
 
-require golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
+require (
+	github.com/fsnotify/fsnotify v1.4.9
+	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
+)
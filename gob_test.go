@@ -0,0 +1,124 @@
+package netallow
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "127.0.0.1", t)
+	addIPString(acl, "192.0.2.1", t)
+	addIPString(acl, "2001:db8::1", t)
+	addIPString(acl, "::ffff:10.0.0.1", t)
+	acl.Disable(mustParseIP(t, "192.0.2.1"))
+
+	out, err := DumpGob(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded, err := LoadGob(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(DumpBasic(loaded)) != string(DumpBasic(acl)) {
+		t.Fatalf("expected\n%s\nbut have\n%s", DumpBasic(acl), DumpBasic(loaded))
+	}
+
+	if checkIPString(loaded, "192.0.2.1", t) {
+		t.Fatal("disabled address should still be disabled")
+	}
+
+	if _, err = LoadGob([]byte("garbage")); err == nil {
+		t.Fatal("LoadGob should fail on invalid input")
+	}
+}
+
+func TestGobSingle(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+
+	out, err := DumpGob(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded, err := LoadGob(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(loaded, "192.0.2.1", t) || checkIPString(loaded, "192.0.2.2", t) {
+		t.Fatal("loaded ACL doesn't match the original")
+	}
+}
+
+func TestNetGobRoundTrip(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "192.168.3.0/24", t)
+	testAddNet(acl, "2001:db8::/32", t)
+
+	out, err := DumpNetGob(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded, err := LoadNetGob(out)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := strings.Join(testNetList(acl), ",")
+	if have := strings.Join(testNetList(loaded), ","); have != expected {
+		t.Fatalf("expected %s, but have %s", expected, have)
+	}
+
+	if !checkIPString(loaded, "192.168.3.1", t) || checkIPString(loaded, "192.168.4.1", t) {
+		t.Fatal("loaded ACL doesn't match the original")
+	}
+
+	if _, err = LoadNetGob([]byte("garbage")); err == nil {
+		t.Fatal("LoadNetGob should fail on invalid input")
+	}
+}
+
+// benchmarkCorpus returns a Basic with n distinct IPv4 addresses.
+func benchmarkCorpus(n int) *Basic {
+	acl := NewBasic()
+	for i := 0; i < n; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(0x0a000000+i))
+		acl.Add(ip)
+	}
+	return acl
+}
+
+func BenchmarkLoadBasic(b *testing.B) {
+	in := DumpBasic(benchmarkCorpus(100000))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadBasic(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadGob(b *testing.B) {
+	in, err := DumpGob(benchmarkCorpus(100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadGob(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
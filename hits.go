@@ -0,0 +1,117 @@
+package netallow
+
+// This file contains per-entry hit counting, so that unused ACL
+// entries can be found and pruned.
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A StatsSnapshot records how many times each ACL entry permitted an
+// address. Snapshots from several replicas can be merged to find
+// which entries are used across a whole fleet. It is serialised to
+// JSON as
+//
+//	{"replicas": 2, "hits": {"10.0.0.0/8": 12, "192.168.1.5": 0}}
+//
+// for transmission to an aggregator.
+type StatsSnapshot struct {
+	// Replicas is the number of replicas whose counts are
+	// included in the snapshot.
+	Replicas int `json:"replicas"`
+
+	// Hits maps each entry, as reported by the ACL's MatchRule
+	// method, to the number of times it permitted an address.
+	Hits map[string]uint64 `json:"hits"`
+}
+
+// MergeStats adds the counts in other to the snapshot. Entries that
+// only appear in one of the snapshots are kept.
+func (s *StatsSnapshot) MergeStats(other StatsSnapshot) {
+	if s.Hits == nil {
+		s.Hits = map[string]uint64{}
+	}
+
+	s.Replicas += other.Replicas
+	for entry, hits := range other.Hits {
+		s.Hits[entry] += hits
+	}
+}
+
+// HitCounter is an ACL that counts how often each entry of the
+// wrapped ACL permits an address. Its snapshots include unused
+// entries of ACLs that can list their entries; see Snapshot.
+type HitCounter struct {
+	acl  RuleMatcher
+	lock *sync.Mutex
+	hits map[string]uint64
+}
+
+// NewHitCounter returns a HitCounter wrapping acl.
+func NewHitCounter(acl RuleMatcher) *HitCounter {
+	return &HitCounter{
+		acl:  acl,
+		lock: new(sync.Mutex),
+		hits: map[string]uint64{},
+	}
+}
+
+// MatchRule checks the IP against the wrapped ACL, counting a hit for
+// the matching entry if it is permitted.
+func (hc *HitCounter) MatchRule(ip net.IP) (string, bool) {
+	rule, permitted := hc.acl.MatchRule(ip)
+	if permitted {
+		hc.lock.Lock()
+		hc.hits[rule]++
+		hc.lock.Unlock()
+	}
+	return rule, permitted
+}
+
+// Permitted returns true if the wrapped ACL permits the IP.
+func (hc *HitCounter) Permitted(ip net.IP) bool {
+	_, permitted := hc.MatchRule(ip)
+	return permitted
+}
+
+// checkRequest passes the request to the wrapped ACL, counting a hit
+// for the matching entry if it is permitted and the ACL reported one.
+func (hc *HitCounter) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	req, permitted, rule := checkRequest(hc.acl, req, ip)
+	if permitted && rule != "" {
+		hc.lock.Lock()
+		hc.hits[rule]++
+		hc.lock.Unlock()
+	}
+	return req, permitted, rule
+}
+
+// Snapshot returns the current hit counts as a single-replica
+// snapshot. If the wrapped ACL can list its entries, as Basic and
+// BasicNet can, entries that have never permitted an address are
+// included with a count of zero, so that unused entries can be
+// found; otherwise, only entries that have been hit are included.
+func (hc *HitCounter) Snapshot() StatsSnapshot {
+	var entries []string
+	if lister, ok := hc.acl.(entryLister); ok {
+		entries = lister.entries()
+	}
+
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	s := StatsSnapshot{Replicas: 1, Hits: make(map[string]uint64, len(hc.hits)+len(entries))}
+	for _, entry := range entries {
+		// Disabled host entries are listed with a "!" prefix,
+		// but can't be hit.
+		s.Hits[strings.TrimPrefix(entry, "!")] = 0
+	}
+
+	for entry, hits := range hc.hits {
+		s.Hits[entry] = hits
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package netallow
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHitCounter(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "192.168.1.0/24", t)
+
+	hc := NewHitCounter(acl)
+	for _, addr := range []string{"10.0.0.1", "10.1.1.1", "192.168.1.1", "172.16.0.1"} {
+		checkIPString(hc, addr, t)
+	}
+
+	s := hc.Snapshot()
+	if s.Replicas != 1 || len(s.Hits) != 2 || s.Hits["10.0.0.0/8"] != 2 || s.Hits["192.168.1.0/24"] != 1 {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+}
+
+func TestHitCounterUnused(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		addIPString(acl, addr, t)
+	}
+	acl.Disable(mustParseIP(t, "10.0.0.3"))
+
+	hc := NewHitCounter(acl)
+	checkIPString(hc, "10.0.0.1", t)
+	checkIPString(hc, "10.0.0.3", t)
+
+	s := hc.Snapshot()
+	expected := map[string]uint64{"10.0.0.1": 1, "10.0.0.2": 0, "10.0.0.3": 0}
+	if len(s.Hits) != len(expected) {
+		t.Fatalf("expected %v, have %v", expected, s.Hits)
+	}
+
+	for entry, hits := range expected {
+		if have, ok := s.Hits[entry]; !ok || have != hits {
+			t.Fatalf("expected %v, have %v", expected, s.Hits)
+		}
+	}
+
+	// ACLs that can't list their entries only report hits.
+	hc = NewHitCounter(NewLayeredACL(true))
+	checkIPString(hc, "10.0.0.1", t)
+	if s = hc.Snapshot(); len(s.Hits) != 1 || s.Hits["default"] != 1 {
+		t.Fatalf("expected only the default rule's hit, have %v", s.Hits)
+	}
+}
+
+func TestMergeStats(t *testing.T) {
+	a := StatsSnapshot{
+		Replicas: 1,
+		Hits:     map[string]uint64{"10.0.0.0/8": 3, "192.168.1.0/24": 1},
+	}
+
+	// Round trip b through JSON, as an aggregator would receive it.
+	out, err := json.Marshal(StatsSnapshot{
+		Replicas: 2,
+		Hits:     map[string]uint64{"10.0.0.0/8": 4, "172.16.0.0/12": 2},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var b StatsSnapshot
+	if err = json.Unmarshal(out, &b); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var total StatsSnapshot
+	total.MergeStats(a)
+	total.MergeStats(b)
+
+	expected := map[string]uint64{
+		"10.0.0.0/8":     7,
+		"192.168.1.0/24": 1,
+		"172.16.0.0/12":  2,
+	}
+
+	if total.Replicas != 3 || len(total.Hits) != len(expected) {
+		t.Fatalf("unexpected merged snapshot %+v", total)
+	}
+
+	for entry, hits := range expected {
+		if total.Hits[entry] != hits {
+			t.Fatalf("expected %d hits for %s, but have %d", hits, entry, total.Hits[entry])
+		}
+	}
+}
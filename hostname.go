@@ -0,0 +1,254 @@
+package netallow
+
+// This file contains an ACL of hostnames, such as an office's
+// dynamic DNS name, which are resolved to the addresses they permit.
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Resolver looks up the addresses of a hostname, giving up when
+// ctx is done. *net.Resolver is a Resolver.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DefaultHostnameInterval is the refresh interval used by
+// NewHostnameACL when it is given an interval that isn't positive.
+const DefaultHostnameInterval = 5 * time.Minute
+
+// DefaultHostnameTimeout bounds each background refresh of a
+// HostnameACL, unless changed with SetTimeout.
+const DefaultHostnameTimeout = 30 * time.Second
+
+// HostnameACL permits the addresses that its hostnames resolve to.
+// Every A and AAAA record of each hostname is permitted.
+//
+// Resolved addresses are kept for the refresh interval. Once it has
+// passed, the next check starts resolving the hostnames again in the
+// background and is answered from the addresses already resolved,
+// as are checks made while the refresh runs; the new addresses are
+// used once it finishes. If a hostname can't be resolved, its
+// previous addresses are kept until a later refresh succeeds, so a
+// DNS outage doesn't lock clients out. The interval is the only TTL:
+// the TTLs of the DNS records aren't used.
+//
+// A new HostnameACL has resolved nothing and permits nothing until
+// its first refresh finishes; call Refresh before using it to
+// resolve the hostnames up front.
+type HostnameACL struct {
+	lock       *sync.Mutex
+	resolver   Resolver
+	clock      Clock
+	interval   time.Duration
+	timeout    time.Duration
+	hosts      map[string][]net.IP // last addresses each host resolved to
+	resolved   *Basic
+	refreshed  time.Time
+	refreshing bool
+	generation uint64 // incremented whenever a hostname is added
+}
+
+// NewHostnameACL returns an ACL permitting the addresses of the
+// hostnames, which are resolved again every interval. An interval
+// that isn't positive is replaced by DefaultHostnameInterval.
+func NewHostnameACL(interval time.Duration, hostnames ...string) *HostnameACL {
+	if interval <= 0 {
+		interval = DefaultHostnameInterval
+	}
+
+	acl := &HostnameACL{
+		lock:     new(sync.Mutex),
+		resolver: net.DefaultResolver,
+		clock:    SystemClock,
+		interval: interval,
+		timeout:  DefaultHostnameTimeout,
+		hosts:    map[string][]net.IP{},
+		resolved: NewBasic(),
+	}
+
+	for _, host := range hostnames {
+		acl.hosts[canonicalHostname(host)] = nil
+	}
+	return acl
+}
+
+// canonicalHostname lowercases host and removes any trailing dot.
+func canonicalHostname(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// SetResolver sets the resolver used to look up the hostnames. A nil
+// resolver selects net.DefaultResolver.
+func (acl *HostnameACL) SetResolver(r Resolver) {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.resolver = r
+}
+
+// SetClock sets the clock used to decide when to refresh. A nil
+// clock selects the system clock.
+func (acl *HostnameACL) SetClock(clock Clock) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.clock = clockOrSystem(clock)
+}
+
+// SetTimeout bounds each background refresh, which must take a
+// positive time, so that a resolver that never answers doesn't stop
+// the hostnames from being refreshed. Refreshes started with Refresh
+// are bounded by their context instead.
+func (acl *HostnameACL) SetTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("netallow: hostname refresh timeout must be positive")
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.timeout = timeout
+	return nil
+}
+
+// AddHostname permits the addresses of host. It is resolved by the
+// next refresh, which the next check will start.
+func (acl *HostnameACL) AddHostname(host string) {
+	host = canonicalHostname(host)
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	if _, ok := acl.hosts[host]; !ok {
+		acl.hosts[host] = nil
+		acl.refreshed = time.Time{}
+		acl.generation++
+	}
+}
+
+// RemoveHostname stops permitting the addresses of host, unless
+// another hostname also resolves to them.
+func (acl *HostnameACL) RemoveHostname(host string) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.hosts, canonicalHostname(host))
+	acl.rebuild()
+}
+
+// Hostnames returns the ACL's hostnames, sorted.
+func (acl *HostnameACL) Hostnames() []string {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+
+	hosts := make([]string, 0, len(acl.hosts))
+	for host := range acl.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// rebuild replaces the resolved addresses with those of the current
+// hosts. The caller must hold the lock.
+func (acl *HostnameACL) rebuild() {
+	resolved := NewBasic()
+	for _, ips := range acl.hosts {
+		for _, ip := range ips {
+			resolved.Add(ip)
+		}
+	}
+	acl.resolved = resolved
+}
+
+// Refresh resolves every hostname now, waiting for the lookups to
+// finish. Hostnames that fail to resolve keep their previous
+// addresses, and the first failure is returned. Hostnames added
+// while the refresh runs aren't resolved by it, so the next check
+// starts another refresh.
+func (acl *HostnameACL) Refresh(ctx context.Context) error {
+	acl.lock.Lock()
+	resolver := acl.resolver
+	generation := acl.generation
+	hosts := make([]string, 0, len(acl.hosts))
+	for host := range acl.hosts {
+		hosts = append(hosts, host)
+	}
+	acl.lock.Unlock()
+
+	var err error
+	results := map[string][]net.IP{}
+	for _, host := range hosts {
+		addrs, lookupErr := resolver.LookupIPAddr(ctx, host)
+		if lookupErr == nil && len(addrs) == 0 {
+			lookupErr = errors.New("netallow: no addresses for " + host)
+		}
+
+		if lookupErr != nil {
+			if err == nil {
+				err = lookupErr
+			}
+			continue
+		}
+
+		ips := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+		results[host] = ips
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for host, ips := range results {
+		// Skip hosts removed while they were being resolved.
+		if _, ok := acl.hosts[host]; ok {
+			acl.hosts[host] = ips
+		}
+	}
+	acl.rebuild()
+	if acl.generation == generation {
+		acl.refreshed = acl.clock.Now()
+	}
+	return err
+}
+
+// Permitted returns true if one of the hostnames resolved to the IP.
+// If the addresses are older than the refresh interval, a refresh is
+// started in the background.
+func (acl *HostnameACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	resolved := acl.resolved
+	if !acl.refreshing && acl.clock.Now().Sub(acl.refreshed) >= acl.interval {
+		acl.refreshing = true
+		go acl.backgroundRefresh(acl.timeout)
+	}
+	acl.lock.Unlock()
+
+	return resolved.Permitted(ip)
+}
+
+// backgroundRefresh refreshes the hostnames for a check, giving up
+// after timeout.
+func (acl *HostnameACL) backgroundRefresh(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := acl.Refresh(ctx); err != nil {
+		log.Printf("netallow: failed to resolve hostnames: %v", err)
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.refreshing = false
+}
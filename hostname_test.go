@@ -0,0 +1,197 @@
+package netallow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testResolver answers lookups from a map that can be changed
+// between refreshes. Hostnames that aren't in the map fail. If block
+// is set, lookups wait until it is closed.
+type testResolver struct {
+	lock    sync.Mutex
+	records map[string][]string
+	lookups int
+	block   chan struct{}
+}
+
+func (r *testResolver) set(host string, addrs ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if addrs == nil {
+		delete(r.records, host)
+		return
+	}
+	r.records[host] = addrs
+}
+
+func (r *testResolver) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lookups
+}
+
+func (r *testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lock.Lock()
+	r.lookups++
+	block := r.block
+	r.lock.Unlock()
+
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	records, ok := r.records[host]
+	if !ok {
+		return nil, errors.New("no such host " + host)
+	}
+
+	var addrs []net.IPAddr
+	for _, record := range records {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(record)})
+	}
+	return addrs, nil
+}
+
+func TestHostnameACL(t *testing.T) {
+	resolver := &testResolver{records: map[string][]string{}}
+	resolver.set("office.example.com", "192.0.2.1", "2001:db8::1")
+	resolver.set("vpn.example.com", "192.0.2.2")
+
+	clock := newTestClock()
+	acl := NewHostnameACL(time.Minute, "Office.Example.com.", "vpn.example.com")
+	acl.SetResolver(resolver)
+	acl.SetClock(clock)
+
+	if err := acl.Refresh(context.Background()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":   true,
+		"2001:db8::1": true,
+		"192.0.2.2":   true,
+		"192.0.2.3":   false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	// Nothing is resolved again within the interval.
+	if resolver.count() != 2 {
+		t.Fatalf("expected 2 lookups, but have %d", resolver.count())
+	}
+
+	// Once the interval passes, the stale addresses are still used
+	// while the refresh runs.
+	resolver.set("office.example.com", "192.0.2.10")
+	clock.Advance(time.Minute)
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("stale addresses should be used until the refresh finishes")
+	}
+
+	waitFor(t, "the refresh", func() bool { return checkIPString(acl, "192.0.2.10", t) })
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("old address should have been dropped by the refresh")
+	}
+
+	// A failed lookup keeps the previous addresses.
+	resolver.set("vpn.example.com")
+	if err := acl.Refresh(context.Background()); err == nil {
+		t.Fatal("expected an error when a hostname fails to resolve")
+	}
+
+	if !checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("addresses should be kept when DNS fails")
+	}
+
+	acl.RemoveHostname("vpn.example.com")
+	if checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("removed hostname's addresses shouldn't be permitted")
+	}
+
+	acl.AddHostname("new.example.com")
+	resolver.set("new.example.com", "192.0.2.20")
+	waitFor(t, "the new hostname", func() bool { return checkIPString(acl, "192.0.2.20", t) })
+
+	hosts := acl.Hostnames()
+	if len(hosts) != 2 || hosts[0] != "new.example.com" || hosts[1] != "office.example.com" {
+		t.Fatalf("unexpected hostnames %v", hosts)
+	}
+}
+
+func TestHostnameACLAddDuringRefresh(t *testing.T) {
+	resolver := &testResolver{records: map[string][]string{}, block: make(chan struct{})}
+	resolver.set("office.example.com", "192.0.2.1")
+	resolver.set("new.example.com", "192.0.2.20")
+
+	acl := NewHostnameACL(time.Minute, "office.example.com")
+	acl.SetResolver(resolver)
+	acl.SetClock(newTestClock())
+
+	// The first check starts a refresh, which is held up until a
+	// hostname has been added.
+	checkIPString(acl, "192.0.2.1", t)
+	waitFor(t, "the refresh to start", func() bool { return resolver.count() > 0 })
+	acl.AddHostname("new.example.com")
+
+	resolver.lock.Lock()
+	close(resolver.block)
+	resolver.block = nil
+	resolver.lock.Unlock()
+
+	// The refresh didn't cover the new hostname, so the next check
+	// resolves it without waiting for the interval.
+	waitFor(t, "the new hostname", func() bool { return checkIPString(acl, "192.0.2.20", t) })
+}
+
+func TestHostnameACLTimeout(t *testing.T) {
+	resolver := &testResolver{records: map[string][]string{}, block: make(chan struct{})}
+	resolver.set("office.example.com", "192.0.2.1")
+
+	// A bad interval is replaced rather than refreshing on every
+	// check.
+	clock := newTestClock()
+	acl := NewHostnameACL(0, "office.example.com")
+	acl.SetResolver(resolver)
+	acl.SetClock(clock)
+	if err := acl.SetTimeout(0); err == nil {
+		t.Fatal("expected an error for a zero timeout")
+	}
+
+	if err := acl.SetTimeout(10 * time.Millisecond); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The hung lookup is given up on, so that a later refresh can
+	// be started.
+	checkIPString(acl, "192.0.2.1", t)
+	waitFor(t, "the refresh to give up", func() bool {
+		acl.lock.Lock()
+		defer acl.lock.Unlock()
+		return !acl.refreshing
+	})
+
+	resolver.lock.Lock()
+	resolver.block = nil
+	resolver.lock.Unlock()
+
+	checkIPString(acl, "192.0.2.1", t)
+	if n := resolver.count(); n != 1 {
+		t.Fatalf("expected no refresh within the default interval, but have %d lookups", n)
+	}
+
+	clock.Advance(DefaultHostnameInterval)
+	waitFor(t, "the next refresh", func() bool { return checkIPString(acl, "192.0.2.1", t) })
+}
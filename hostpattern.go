@@ -0,0 +1,157 @@
+package netallow
+
+// This file contains an ACL that matches addresses by a bit pattern,
+// rather than by network prefix.
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// A HostPattern matches addresses whose bits selected by Mask are
+// the same as those in Template. Unlike a network, the mask needn't
+// be a prefix: a mask of 0.0.0.255 selects the host portion of an
+// address in any /24, so the pattern x.x.x.1/0.0.0.255 matches every
+// address ending in .1 regardless of its network.
+type HostPattern struct {
+	Template net.IP
+	Mask     net.IPMask
+}
+
+// ParseHostPattern parses a pattern written as a template address
+// and a mask address separated by a slash. In an IPv4 template, an
+// octet may be written as "x" to show that it isn't matched; it must
+// also be zero in the mask. For example, "x.x.x.1/0.0.0.255" and
+// "::1/::ffff" are valid patterns.
+func ParseHostPattern(s string) (HostPattern, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return HostPattern{}, errors.New("netallow: host pattern must be template/mask")
+	}
+
+	tmpl := parts[0]
+	if strings.Contains(tmpl, ".") {
+		octets := strings.Split(tmpl, ".")
+		for i := range octets {
+			if octets[i] == "x" || octets[i] == "X" {
+				octets[i] = "0"
+			}
+		}
+		tmpl = strings.Join(octets, ".")
+	}
+
+	template := net.ParseIP(tmpl)
+	mask := net.ParseIP(parts[1])
+	if template == nil || mask == nil {
+		return HostPattern{}, errors.New("netallow: invalid host pattern " + s)
+	}
+
+	if (template.To4() == nil) != (mask.To4() == nil) {
+		return HostPattern{}, errors.New("netallow: host pattern template and mask must be the same address family")
+	}
+
+	if mask.To4() != nil {
+		template, mask = template.To4(), mask.To4()
+	}
+
+	return HostPattern{
+		Template: template.Mask(net.IPMask(mask)),
+		Mask:     net.IPMask(mask),
+	}, nil
+}
+
+// Matches returns true if the IP matches the pattern.
+func (p HostPattern) Matches(ip net.IP) bool {
+	// IPv4 patterns only match IPv4 addresses, and IPv6 patterns
+	// only match IPv6 addresses.
+	if ip4 := ip.To4(); len(p.Mask) == net.IPv4len {
+		ip = ip4
+	} else if ip4 != nil {
+		return false
+	}
+
+	if ip == nil || len(ip) != len(p.Mask) || len(p.Template) != len(p.Mask) {
+		return false
+	}
+
+	for i := range ip {
+		if ip[i]&p.Mask[i] != p.Template[i]&p.Mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern in the form read by ParseHostPattern.
+func (p HostPattern) String() string {
+	return p.Template.String() + "/" + net.IP(p.Mask).String()
+}
+
+// HostPatternACL permits addresses matching any of its patterns. It
+// is meant for the unusual policies that key on the host portion of
+// an address regardless of its network, such as allowing every
+// gateway at .1; use a network ACL for ordinary prefix matching.
+type HostPatternACL struct {
+	lock     *sync.Mutex
+	patterns []HostPattern
+}
+
+// NewHostPatternACL returns a new, empty host pattern ACL.
+func NewHostPatternACL() *HostPatternACL {
+	return &HostPatternACL{
+		lock: new(sync.Mutex),
+	}
+}
+
+// Add permits addresses matching the pattern.
+func (acl *HostPatternACL) Add(p HostPattern) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for i := range acl.patterns {
+		if acl.patterns[i].String() == p.String() {
+			return
+		}
+	}
+	acl.patterns = append(acl.patterns, p)
+}
+
+// AddPattern parses the pattern and adds it to the ACL.
+func (acl *HostPatternACL) AddPattern(s string) error {
+	p, err := ParseHostPattern(s)
+	if err != nil {
+		return err
+	}
+
+	acl.Add(p)
+	return nil
+}
+
+// Remove drops the pattern from the ACL.
+func (acl *HostPatternACL) Remove(p HostPattern) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for i := range acl.patterns {
+		if acl.patterns[i].String() == p.String() {
+			acl.patterns = append(acl.patterns[:i], acl.patterns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Permitted returns true if the IP matches any of the patterns.
+func (acl *HostPatternACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for i := range acl.patterns {
+		if acl.patterns[i].Matches(ip) {
+			return true
+		}
+	}
+	return false
+}
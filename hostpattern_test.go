@@ -0,0 +1,62 @@
+package netallow
+
+import (
+	"testing"
+)
+
+func TestHostPatternACL(t *testing.T) {
+	acl := NewHostPatternACL()
+	if err := acl.AddPattern("x.x.x.1/0.0.0.255"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := acl.AddPattern("::1/::ffff"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":        true,
+		"192.168.77.1":    true,
+		"172.16.3.1":      true,
+		"10.0.0.2":        false,
+		"10.0.1.0":        false,
+		"2001:db8::1":     true,
+		"2001:db8:1::1":   true,
+		"2001:db8::1:1":   true,
+		"2001:db8::2":     false,
+		"2001:db8::1:2":   false,
+		"::ffff:10.0.0.1": true,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	p, err := ParseHostPattern("x.x.x.1/0.0.0.255")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if p.String() != "0.0.0.1/0.0.0.255" {
+		t.Fatalf("unexpected pattern %s", p)
+	}
+
+	acl.Remove(p)
+	if checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("ACL should have denied address")
+	}
+}
+
+func TestParseHostPatternFails(t *testing.T) {
+	for _, s := range []string{
+		"10.0.0.1",
+		"x.x.x.1/0.0.0.256",
+		"y.x.x.1/0.0.0.255",
+		"::1/0.0.0.255",
+		"1/2/3",
+	} {
+		if _, err := ParseHostPattern(s); err == nil {
+			t.Fatalf("ParseHostPattern should fail on %q", s)
+		}
+	}
+}
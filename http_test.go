@@ -1,7 +1,9 @@
 package netallow
 
 import (
+	"context"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -39,13 +41,26 @@ func testHTTPResponse(url string, t *testing.T) string {
 }
 
 func testWorker(url string, t *testing.T, wg *sync.WaitGroup) {
+	defer wg.Done()
 	for i := 0; i < 100; i++ {
-		response := testHTTPResponse(url, t)
-		if response != "NO" {
-			t.Fatalf("Expected NO, but got %s", response)
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Errorf("%v", err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%v", err)
+			return
+		}
+
+		if string(body) != "NO" {
+			t.Errorf("Expected NO, but got %s", body)
+			return
 		}
 	}
-	wg.Done()
 }
 
 func TestHostStubHTTP(t *testing.T) {
@@ -415,3 +430,258 @@ func TestHandlerFunc(t *testing.T) {
 		t.Fatal("Expected error with nil allow handler.")
 	}
 }
+
+func TestHandlerWithLookup(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+
+	h, err := NewHandlerWithLookup(testAllowHandler, testDenyHandler, acl, fixedLookup{net.ParseIP("192.0.2.1")})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	hf, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hf.SetLookup(fixedLookup{net.ParseIP("192.0.2.1")})
+
+	// The lookup's address is used rather than the request's.
+	for _, handler := range []http.Handler{h, hf} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.2:4141"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Body.String() != "OK" {
+			t.Fatalf("%T: expected the lookup's address to be permitted", handler)
+		}
+	}
+
+	// A nil lookup selects the default.
+	h, err = NewHandlerWithLookup(testAllowHandler, testDenyHandler, acl, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hf.SetLookup(nil)
+
+	for _, handler := range []http.Handler{h, hf} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.2:4141"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Body.String() != "NO" {
+			t.Fatalf("%T: expected the request's address to be denied", handler)
+		}
+	}
+
+	if _, err = NewHandlerWithLookup(testAllowHandler, nil, nil, HTTPLookup{}); err == nil {
+		t.Fatal("NewHandlerWithLookup should reject a nil ACL")
+	}
+}
+
+func TestHandlerBypass(t *testing.T) {
+	acl := NewBasic()
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	response := testHTTPResponse(srv.URL, t)
+	if response != "NO" {
+		t.Fatalf("Expected NO, but got %s", response)
+	}
+
+	h.SetBypass(true)
+	if !h.Bypassed() {
+		t.Fatal("handler should be bypassed")
+	}
+
+	for i := 0; i < 3; i++ {
+		response = testHTTPResponse(srv.URL, t)
+		if response != "OK" {
+			t.Fatalf("Expected OK, but got %s", response)
+		}
+	}
+
+	addIPString(acl, "127.0.0.1", t)
+	response = testHTTPResponse(srv.URL, t)
+	if response != "OK" {
+		t.Fatalf("Expected OK, but got %s", response)
+	}
+
+	if h.ShadowDenied() != 3 {
+		t.Fatalf("Expected 3 shadow denials, but have %d", h.ShadowDenied())
+	}
+
+	delIPString(acl, "127.0.0.1", t)
+	h.SetBypass(false)
+	response = testHTTPResponse(srv.URL, t)
+	if response != "NO" {
+		t.Fatalf("Expected NO, but got %s", response)
+	}
+
+	if h.ShadowDenied() != 3 {
+		t.Fatalf("Expected 3 shadow denials, but have %d", h.ShadowDenied())
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+	h, err := NewACLHandler(testAllowHandler, nil, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	status := func(remote string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := status("192.0.2.2:4141"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the default deny status, but have %d", code)
+	}
+
+	if code := status(""); code != http.StatusInternalServerError {
+		t.Fatalf("expected the default lookup error status, but have %d", code)
+	}
+
+	if err = h.SetDenyStatus(http.StatusForbidden); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = h.SetLookupErrorStatus(http.StatusBadRequest); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if code := status("192.0.2.2:4141"); code != http.StatusForbidden {
+		t.Fatalf("expected status %d, but have %d", http.StatusForbidden, code)
+	}
+
+	if code := status(""); code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, but have %d", http.StatusBadRequest, code)
+	}
+
+	if code := status("192.0.2.1:4141"); code != http.StatusOK {
+		t.Fatalf("expected permitted requests to succeed, but have %d", code)
+	}
+
+	for _, code := range []int{0, 200, 302, 600} {
+		if h.SetDenyStatus(code) == nil {
+			t.Fatalf("SetDenyStatus should reject %d", code)
+		}
+
+		if h.SetLookupErrorStatus(code) == nil {
+			t.Fatalf("SetLookupErrorStatus should reject %d", code)
+		}
+	}
+
+	cfg := h.Config()
+	if cfg.DenyStatus != http.StatusForbidden || cfg.LookupErrorStatus != http.StatusBadRequest {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
+
+func TestHandlerLookupErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy LookupErrorPolicy
+		deny   http.Handler
+		code   int
+		body   string
+	}{
+		{FailError, nil, http.StatusInternalServerError, ""},
+		{FailOpen, nil, http.StatusOK, "OK"},
+		{FailClosed, nil, http.StatusUnauthorized, ""},
+		{FailClosed, testDenyHandler, http.StatusOK, "NO"},
+	} {
+		h, err := NewACLHandler(testAllowHandler, tc.deny, NewBasic())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		h.OnLookupError(tc.policy)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected status %d, but have %d", tc.policy, tc.code, w.Code)
+		}
+
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Fatalf("%s: expected %q, but have %q", tc.policy, tc.body, w.Body.String())
+		}
+
+		if h.Config().LookupErrorPolicy != tc.policy.String() {
+			t.Fatalf("unexpected config %+v", h.Config())
+		}
+	}
+}
+
+type ctxKey struct{}
+
+// ctxACL permits requests whose context carries its key. When the
+// context is done it fails, returning failOpen as the decision.
+type ctxACL struct {
+	calls    int
+	failOpen bool
+}
+
+func (acl *ctxACL) Permitted(ip net.IP) bool {
+	return false
+}
+
+func (acl *ctxACL) PermittedCtx(ctx context.Context, ip net.IP) (bool, error) {
+	acl.calls++
+	if err := ctx.Err(); err != nil {
+		return acl.failOpen, err
+	}
+	return ctx.Value(ctxKey{}) != nil, nil
+}
+
+func TestHandlerContextACL(t *testing.T) {
+	acl := &ctxACL{}
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	serve := func(ctx context.Context) string {
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	if body := serve(context.Background()); body != "NO" {
+		t.Fatalf("expected NO, but got %s", body)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	if body := serve(ctx); body != "OK" {
+		t.Fatalf("expected the request's context to be passed to the ACL, but got %s", body)
+	}
+
+	// On an error, the ACL's fallback decision is used.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if body := serve(ctx); body != "NO" {
+		t.Fatalf("expected the ACL to fail closed, but got %s", body)
+	}
+
+	acl.failOpen = true
+	if body := serve(ctx); body != "OK" {
+		t.Fatalf("expected the ACL to fail open, but got %s", body)
+	}
+
+	if acl.calls != 4 {
+		t.Fatalf("expected PermittedCtx to be called 4 times, but have %d", acl.calls)
+	}
+}
@@ -0,0 +1,141 @@
+package netallow
+
+// This file contains an ACL of ordered rules where the first match
+// wins, as used by nginx and many firewalls.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// LayeredACL is an ACL of ordered allow and deny rules. Rules are
+// checked in order and the first rule containing an address decides
+// whether it is permitted, regardless of how specific later rules
+// are; this differs from a RuleSet, where the most specific rule
+// wins. Addresses that no rule contains get the default decision.
+type LayeredACL struct {
+	lock         *sync.Mutex
+	rules        []Rule
+	defaultAllow bool
+}
+
+// NewLayeredACL returns a new, empty layered ACL. If defaultAllow
+// is true, addresses that no rule matches are permitted.
+func NewLayeredACL(defaultAllow bool) *LayeredACL {
+	return &LayeredACL{
+		lock:         new(sync.Mutex),
+		defaultAllow: defaultAllow,
+	}
+}
+
+// Append adds a rule after the existing rules.
+func (acl *LayeredACL) Append(r Rule) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.rules = append(acl.rules, r)
+}
+
+// Rules returns a copy of the rules, in the order they're checked.
+func (acl *LayeredACL) Rules() []Rule {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	rules := make([]Rule, len(acl.rules))
+	copy(rules, acl.rules)
+	return rules
+}
+
+// MatchRule returns true and the first rule containing the IP if it
+// is permitted. If the IP is permitted by default, the rule is
+// "default".
+func (acl *LayeredACL) MatchRule(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, r := range acl.rules {
+		if r.contains(ip) {
+			if !r.Allow {
+				return "", false
+			}
+			return r.String(), true
+		}
+	}
+
+	if acl.defaultAllow {
+		return "default", true
+	}
+	return "", false
+}
+
+// Permitted returns true if the first rule containing the IP allows
+// it, or if no rule contains it and the default is to allow.
+func (acl *LayeredACL) Permitted(ip net.IP) bool {
+	_, permitted := acl.MatchRule(ip)
+	return permitted
+}
+
+// LoadNginx builds a layered ACL from nginx access module
+// directives, e.g.
+//
+//	deny  192.168.1.1;
+//	allow 192.168.1.0/24;
+//	allow 2001:0db8::/32;
+//	deny  all;
+//
+// Each directive is "allow" or "deny" followed by an address, a
+// network in CIDR notation, or "all", and is terminated by a
+// semicolon. Comments run from '#' to the end of the line. Like
+// nginx, the directives are checked in order and the first match
+// wins; addresses that don't match any directive are permitted.
+// Other directives, and unix: sockets, aren't supported.
+func LoadNginx(in []byte) (*LayeredACL, error) {
+	var lines []string
+	for _, line := range strings.Split(string(in), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+
+	statements := strings.Split(strings.Join(lines, " "), ";")
+	if last := strings.TrimSpace(statements[len(statements)-1]); last != "" {
+		return nil, fmt.Errorf("netallow: unterminated nginx directive %q", last)
+	}
+
+	acl := NewLayeredACL(true)
+	for _, stmt := range statements[:len(statements)-1] {
+		fields := strings.Fields(stmt)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("netallow: invalid nginx directive %q", strings.TrimSpace(stmt))
+		}
+
+		var r Rule
+		switch fields[0] {
+		case "allow":
+			r.Allow = true
+		case "deny":
+		default:
+			return nil, fmt.Errorf("netallow: unsupported nginx directive %q", fields[0])
+		}
+
+		if fields[1] != "all" {
+			n, err := parseNet(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("netallow: invalid nginx address %q", fields[1])
+			}
+			r.Net = n
+		}
+
+		acl.Append(r)
+	}
+
+	return acl, nil
+}
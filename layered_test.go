@@ -0,0 +1,76 @@
+package netallow
+
+import (
+	"testing"
+)
+
+// This is the example from the nginx ngx_http_access_module
+// documentation.
+var testNginxRules = []byte(`
+    deny  192.168.1.1;
+    allow 192.168.1.0/24;
+    allow 10.1.1.0/16;   # office
+    allow 2001:0db8::/32;
+    deny  all;
+`)
+
+func TestLoadNginx(t *testing.T) {
+	acl, err := LoadNginx(testNginxRules)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(acl.Rules()) != 5 {
+		t.Fatalf("expected 5 rules, but have %d", len(acl.Rules()))
+	}
+
+	// 192.168.1.1 is denied even though the following, broader
+	// rule allows it, because the first match wins.
+	for addr, expected := range map[string]bool{
+		"192.168.1.1": false,
+		"192.168.1.2": true,
+		"10.1.200.1":  true,
+		"2001:db8::1": true,
+		"172.16.0.1":  false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	rule, _ := acl.MatchRule(mustParseIP(t, "10.1.200.1"))
+	if rule != "allow 10.1.0.0/16" {
+		t.Fatalf("expected match with allow 10.1.0.0/16, but have %q", rule)
+	}
+}
+
+func TestLoadNginxDefault(t *testing.T) {
+	acl, err := LoadNginx([]byte("deny 10.0.0.0/8; allow 10.1.0.0/16;"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Without a final deny all, unmatched addresses are allowed.
+	if !checkIPString(acl, "192.168.1.1", t) {
+		t.Fatal("ACL should have permitted unmatched address")
+	}
+
+	if checkIPString(acl, "10.1.0.1", t) {
+		t.Fatal("ACL should have denied address matching the first rule")
+	}
+}
+
+func TestLoadNginxFails(t *testing.T) {
+	for _, in := range []string{
+		"location / {",
+		"allow 10.0.0.0/8",
+		"allow;",
+		"allow unix:;",
+		"allow 10.0.0.0/33;",
+		"permit all;",
+	} {
+		if _, err := LoadNginx([]byte(in)); err == nil {
+			t.Fatalf("LoadNginx should fail on %q", in)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package netallow
+
+// This file contains HTTP handlers for paging through, dumping, and
+// loading the contents of an ACL from an administrative interface.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	// DefaultListLimit is the number of entries returned in a
+	// page when the request doesn't give a limit.
+	DefaultListLimit = 100
+
+	// MaxListLimit is the largest page that will be returned.
+	MaxListLimit = 1000
+
+	// MaxLoadSize is the largest request body, in bytes, that a
+	// load handler will read.
+	MaxLoadSize = 16 << 20
+)
+
+// A ListPage is a page of ACL entries returned by a list handler.
+// Next is the cursor for the following page, and is empty on the
+// last page.
+type ListPage struct {
+	Entries []string `json:"entries"`
+	Total   int      `json:"total"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// entries returns a sorted copy of the addresses in the ACL, with
+// disabled addresses prefixed with "!".
+func (acl *Basic) entries() []string {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	var addrs = make([]string, 0, len(acl.allowed))
+	for addr, enabled := range acl.allowed {
+		addrs = append(addrs, entryString(addr, enabled))
+	}
+
+	sort.Strings(addrs)
+	return addrs
+}
+
+// entries returns a sorted copy of the networks in the ACL.
+func (acl *BasicNet) entries() []string {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	var nets = make([]string, 0, len(acl.allowed))
+	for _, n := range acl.allowed {
+		if n != nil {
+			nets = append(nets, n.String())
+		}
+	}
+
+	sort.Strings(nets)
+	return nets
+}
+
+// ListHandler returns a handler that serves the addresses in the ACL
+// as JSON-encoded ListPages. The limit query parameter sets the page
+// size, and the cursor parameter is taken from the previous page's
+// Next field. The handler doesn't check who is asking; it should be
+// wrapped in the caller's own access control.
+//
+// The cursor records the last entry returned rather than a position,
+// so paging is stable while the ACL changes: entries that are
+// present for the whole walk are returned exactly once, in sorted
+// order. Each page and its total are taken from a snapshot of the
+// ACL made when the page is requested.
+func ListHandler(acl *Basic) http.Handler {
+	return listHandler(acl.entries)
+}
+
+// NetListHandler returns a handler that serves the networks in the
+// ACL in the same way as ListHandler.
+func NetListHandler(acl *BasicNet) http.Handler {
+	return listHandler(acl.entries)
+}
+
+func listHandler(entries func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit := DefaultListLimit
+		if s := req.FormValue("limit"); s != "" {
+			var err error
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+
+			if limit > MaxListLimit {
+				limit = MaxListLimit
+			}
+		}
+
+		var after string
+		if cursor := req.FormValue("cursor"); cursor != "" {
+			last, err := base64.RawURLEncoding.DecodeString(cursor)
+			if err != nil || len(last) == 0 {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			after = string(last)
+		}
+
+		all := entries()
+		start := 0
+		if after != "" {
+			start = sort.Search(len(all), func(i int) bool {
+				return all[i] > after
+			})
+		}
+
+		end := start + limit
+		if end > len(all) {
+			end = len(all)
+		}
+
+		page := ListPage{
+			Entries: all[start:end],
+			Total:   len(all),
+		}
+		if end < len(all) {
+			page.Next = base64.RawURLEncoding.EncodeToString([]byte(all[end-1]))
+		}
+
+		out, err := json.Marshal(page)
+		if err != nil {
+			status := http.StatusInternalServerError
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	})
+}
+
+// DumpHandler returns a handler that serves the addresses in the ACL
+// as plain text, one per line, in the format written by DumpBasic and
+// read by LoadBasic. Like ListHandler, it should be wrapped in the
+// caller's own access control.
+func DumpHandler(acl *Basic) http.Handler {
+	return dumpHandler(acl.entries)
+}
+
+// NetDumpHandler returns a handler that serves the networks in the
+// ACL as plain text, one per line, in the same way as DumpHandler.
+func NetDumpHandler(acl *BasicNet) http.Handler {
+	return dumpHandler(acl.entries)
+}
+
+func dumpHandler(entries func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, entry := range entries() {
+			w.Write([]byte(entry + "\n"))
+		}
+	})
+}
+
+// LoadHandler returns a handler that replaces the contents of the ACL
+// with the addresses in the body of a POST or PUT request, which is in
+// the format read by LoadBasic. The body is parsed before the ACL is
+// touched and the new contents are swapped in at once, as with
+// ReloadFromFile: an invalid body is rejected with 400 Bad Request
+// and leaves the ACL unchanged. Like ListHandler, it should be
+// wrapped in the caller's own access control.
+func LoadHandler(acl *Basic) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			status := http.StatusMethodNotAllowed
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		in, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, MaxLoadSize))
+		if err != nil {
+			http.Error(w, "unable to read request body", http.StatusBadRequest)
+			return
+		}
+
+		fresh, err := LoadBasic(in)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		count := fresh.Count()
+		acl.replace(fresh)
+		fmt.Fprintf(w, "Loaded %d addresses.\n", count)
+	})
+}
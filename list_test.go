@@ -0,0 +1,217 @@
+package netallow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testListPage(h http.Handler, query string, t *testing.T) *ListPage {
+	req := httptest.NewRequest("GET", "/list?"+query, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list request %q failed with status %d", query, w.Code)
+	}
+
+	var page ListPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return &page
+}
+
+func TestListHandler(t *testing.T) {
+	const count = 10000
+	acl := NewBasic()
+	for i := 0; i < count; i++ {
+		acl.Add(net.IPv4(10, 0, byte(i>>8), byte(i)))
+	}
+
+	h := ListHandler(acl)
+	seen := map[string]bool{}
+	var last string
+	cursor := ""
+	pages := 0
+	for {
+		page := testListPage(h, "limit=333&cursor="+url.QueryEscape(cursor), t)
+		pages++
+		if page.Total != count {
+			t.Fatalf("expected a total of %d, but have %d", count, page.Total)
+		}
+
+		for _, addr := range page.Entries {
+			if seen[addr] {
+				t.Fatalf("%s was returned twice", addr)
+			}
+			if addr <= last {
+				t.Fatalf("%s was returned out of order", addr)
+			}
+			seen[addr] = true
+			last = addr
+		}
+
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+
+	if len(seen) != count {
+		t.Fatalf("expected %d entries, but have %d", count, len(seen))
+	}
+
+	if pages != (count+332)/333 {
+		t.Fatalf("unexpected number of pages %d", pages)
+	}
+}
+
+func TestListHandlerMutation(t *testing.T) {
+	acl := NewBasic()
+	for i := 1; i <= 9; i++ {
+		addIPString(acl, fmt.Sprintf("10.0.0.%d", i), t)
+	}
+
+	h := ListHandler(acl)
+	page := testListPage(h, "limit=3", t)
+	if len(page.Entries) != 3 || page.Entries[2] != "10.0.0.3" {
+		t.Fatalf("unexpected first page %v", page.Entries)
+	}
+
+	// Removing an entry that has already been returned doesn't
+	// cause later entries to be skipped.
+	delIPString(acl, "10.0.0.2", t)
+	page = testListPage(h, "limit=3&cursor="+page.Next, t)
+	if len(page.Entries) != 3 || page.Entries[0] != "10.0.0.4" {
+		t.Fatalf("unexpected second page %v", page.Entries)
+	}
+
+	if page.Total != 8 {
+		t.Fatalf("expected a total of 8, but have %d", page.Total)
+	}
+}
+
+func TestNetListHandler(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "192.168.0.0/16", t)
+
+	page := testListPage(NetListHandler(acl), "", t)
+	if len(page.Entries) != 2 || page.Next != "" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	if page.Entries[0] != "10.0.0.0/8" || page.Entries[1] != "192.168.0.0/16" {
+		t.Fatalf("unexpected entries %v", page.Entries)
+	}
+}
+
+func TestListHandlerFails(t *testing.T) {
+	h := ListHandler(NewBasic())
+	for _, query := range []string{"limit=0", "limit=x", "cursor=!!"} {
+		req := httptest.NewRequest("GET", "/list?"+query, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, but have %d",
+				query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestDumpHandler(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{"127.0.0.1", "192.0.2.7", "::1"} {
+		addIPString(acl, addr, t)
+	}
+	acl.Disable(mustParseIP(t, "192.0.2.7"))
+
+	req := httptest.NewRequest("GET", "/dump", nil)
+	w := httptest.NewRecorder()
+	DumpHandler(acl).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dump request failed with status %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	if w.Body.String() != "!192.0.2.7\n127.0.0.1\n::1\n" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	loaded, err := LoadBasic(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(DumpBasic(loaded)) != string(DumpBasic(acl)) {
+		t.Fatalf("expected loaded ACL %s to match %s", loaded, acl)
+	}
+}
+
+func TestNetDumpHandler(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "192.168.0.0/16", t)
+	testAddNet(acl, "10.0.0.0/8", t)
+
+	w := httptest.NewRecorder()
+	NetDumpHandler(acl).ServeHTTP(w, httptest.NewRequest("GET", "/dump", nil))
+	if w.Body.String() != "10.0.0.0/8\n192.168.0.0/16\n" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	// An empty ACL has an empty dump.
+	w = httptest.NewRecorder()
+	NetDumpHandler(NewBasicNet()).ServeHTTP(w, httptest.NewRequest("GET", "/dump", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("expected an empty dump, have %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestLoadHandler(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "127.0.0.1", t)
+	h := LoadHandler(acl)
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/load", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post("# office\n192.0.2.1\n!192.0.2.2\n::1\n"); code != http.StatusOK {
+		t.Fatalf("expected a valid list to load, have status %d", code)
+	}
+
+	expected := "!192.0.2.2\n192.0.2.1\n::1"
+	if string(DumpBasic(acl)) != expected {
+		t.Fatalf("expected ACL %q, have %q", expected, DumpBasic(acl))
+	}
+
+	// A bad entry anywhere in the list rejects all of it.
+	if code := post("203.0.113.1\nnot-an-address\n"); code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid list to be rejected, have status %d", code)
+	}
+
+	if string(DumpBasic(acl)) != expected {
+		t.Fatalf("invalid list changed the ACL to %q", DumpBasic(acl))
+	}
+
+	if checkIPString(acl, "203.0.113.1", t) {
+		t.Fatal("invalid list shouldn't have been partially applied")
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/load", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be refused, have status %d", w.Code)
+	}
+}
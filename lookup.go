@@ -5,18 +5,102 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
+// A Lookup extracts the client's IP address from the arguments it is
+// given, such as a connection or a request. Each Lookup documents the
+// arguments it expects.
+type Lookup interface {
+	Address(args ...interface{}) (net.IP, error)
+}
+
+// ConnLookup is a Lookup that extracts an IP from the remote address
+// of a net.Conn. A single net.Conn should be passed to Address.
+type ConnLookup struct{}
+
+// Address returns the remote IP address of the net.Conn.
+func (ConnLookup) Address(args ...interface{}) (net.IP, error) {
+	if len(args) != 1 {
+		return nil, errors.New("netallow: lookup requires a net.Conn")
+	}
+
+	conn, ok := args[0].(net.Conn)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires a net.Conn")
+	}
+
+	return NetConnLookup(conn)
+}
+
+// HTTPLookup is a Lookup that extracts an IP from the remote address
+// of a *http.Request. A single *http.Request should be passed to
+// Address. It is the default Lookup for a Handler.
+type HTTPLookup struct{}
+
+// Address returns the remote IP address of the *http.Request.
+func (HTTPLookup) Address(args ...interface{}) (net.IP, error) {
+	if len(args) != 1 {
+		return nil, errors.New("netallow: lookup requires an *http.Request")
+	}
+
+	req, ok := args[0].(*http.Request)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires an *http.Request")
+	}
+
+	return HTTPRequestLookup(req)
+}
+
+// AddrLookup is a Lookup that extracts an IP from a net.Addr, such
+// as the source address ReadFrom returns for each packet read from a
+// net.PacketConn. A single net.Addr should be passed to Address.
+type AddrLookup struct{}
+
+// Address returns the IP address of the net.Addr.
+func (AddrLookup) Address(args ...interface{}) (net.IP, error) {
+	if len(args) != 1 {
+		return nil, errors.New("netallow: lookup requires a net.Addr")
+	}
+
+	addr, ok := args[0].(net.Addr)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires a net.Addr")
+	}
+
+	return NetAddrLookup(addr)
+}
+
 // NetConnLookup extracts an IP from the remote address in the
-// net.Conn. A single net.Conn should be passed to Address.
+// net.Conn, as NetAddrLookup does.
 func NetConnLookup(conn net.Conn) (net.IP, error) {
 	if conn == nil {
 		return nil, errors.New("netallow: no connection")
 	}
 
-	netAddr := conn.RemoteAddr()
-	if netAddr == nil {
+	return NetAddrLookup(conn.RemoteAddr())
+}
+
+// NetAddrLookup extracts an IP from a net.Addr. The IP is taken
+// directly from TCP, UDP, and IP addresses; other addresses, and
+// those without an IP, are parsed from their string form.
+func NetAddrLookup(netAddr net.Addr) (net.IP, error) {
+	switch addr := netAddr.(type) {
+	case nil:
 		return nil, errors.New("netallow: no address returned")
+	case *net.TCPAddr:
+		if addr != nil && len(addr.IP) != 0 {
+			return addr.IP, nil
+		}
+	case *net.UDPAddr:
+		if addr != nil && len(addr.IP) != 0 {
+			return addr.IP, nil
+		}
+	case *net.IPAddr:
+		if addr != nil && len(addr.IP) != 0 {
+			return addr.IP, nil
+		}
 	}
 
 	addr, _, err := net.SplitHostPort(netAddr.String())
@@ -47,16 +131,46 @@ func HTTPRequestLookup(req *http.Request) (net.IP, error) {
 
 // Handler wraps an HTTP handler with anIP ACL.
 type Handler struct {
+	shadowDenied uint64 // accessed atomically; keep 64-bit aligned
+	bypass       int32  // accessed atomically
+
+	lock         *sync.RWMutex
 	allowHandler http.Handler
 	denyHandler  http.Handler
 	allowed      ACL
+	lookup       Lookup
+	family       Family
+	audit        *AuditSink
+	certs        *CertFingerprintACL
+	sessions     *SessionBinding
+	denyPage     *DenyPage
+	observer     Observer
+	onAllow      func(net.IP, *http.Request)
+	onDeny       func(net.IP, *http.Request)
+
+	denyStatus        int
+	lookupErrorStatus int
+	lookupPolicy      LookupErrorPolicy
 }
 
 // NewHandler returns a new ACL-wrapped HTTP handler. The
 // allow handler should contain a handler that will be called if the
 // request is permitted; the deny handler should contain a handler
-// that will be called in the request is not permitted.
+// that will be called in the request is not permitted. If the deny
+// handler is nil, denied clients get a response in JSON, HTML, or
+// plain text, depending on their Accept header.
 func NewHandler(allow, deny http.Handler, acl ACL) (http.Handler, error) {
+	h, err := NewACLHandler(allow, deny, acl)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// NewACLHandler returns a new ACL-wrapped HTTP handler, as NewHandler
+// does, as a *Handler, so that it can be configured further.
+func NewACLHandler(allow, deny http.Handler, acl ACL) (*Handler, error) {
 	if allow == nil {
 		return nil, errors.New("netallow: allow cannot be nil")
 	}
@@ -66,31 +180,370 @@ func NewHandler(allow, deny http.Handler, acl ACL) (http.Handler, error) {
 	}
 
 	return &Handler{
+		lock:         new(sync.RWMutex),
 		allowHandler: allow,
 		denyHandler:  deny,
 		allowed:      acl,
+		lookup:       HTTPLookup{},
+
+		denyStatus:        http.StatusUnauthorized,
+		lookupErrorStatus: http.StatusInternalServerError,
 	}, nil
 }
 
+// NewHandlerWithLookup returns a new ACL-wrapped HTTP handler, as
+// NewHandler does, that finds the client's address with lookup. The
+// Lookup is passed the *http.Request; a nil Lookup selects
+// HTTPLookup.
+func NewHandlerWithLookup(allow, deny http.Handler, acl ACL, lookup Lookup) (*Handler, error) {
+	h, err := NewACLHandler(allow, deny, acl)
+	if err != nil {
+		return nil, err
+	}
+
+	h.SetLookup(lookup)
+	return h, nil
+}
+
+// SetACL replaces the handler's ACL. It may be called while the
+// handler is serving requests.
+func (h *Handler) SetACL(acl ACL) error {
+	if acl == nil {
+		return errors.New("netallow: ACL cannot be nil")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.allowed = acl
+	return nil
+}
+
+// SetLookup sets how the client's address is found; the Lookup is
+// passed the *http.Request. Passing nil restores the default,
+// HTTPLookup.
+func (h *Handler) SetLookup(lookup Lookup) {
+	if lookup == nil {
+		lookup = HTTPLookup{}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lookup = lookup
+}
+
+// SetAudit sets the sink that each access decision is recorded
+// to. Passing nil disables auditing.
+func (h *Handler) SetAudit(sink *AuditSink) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.audit = sink
+}
+
+// SetObserver sets the observer told about each access decision,
+// along with an exemplar if the request carries trace context (see
+// ExemplarFromRequest). Passing nil removes the observer.
+func (h *Handler) SetObserver(o Observer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.observer = o
+}
+
+// OnAllow sets a function that is called with the client's address
+// and the request whenever the handler permits a request, before the
+// allow handler runs. Passing nil removes it.
+func (h *Handler) OnAllow(fn func(ip net.IP, req *http.Request)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onAllow = fn
+}
+
+// OnDeny sets a function that is called with the client's address
+// and the request whenever the ACL denies a request, such as to
+// count denials or raise alerts. Requests let through by the bypass
+// are still reported as denied. Passing nil removes it.
+func (h *Handler) OnDeny(fn func(ip net.IP, req *http.Request)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onDeny = fn
+}
+
+// SetDenyPage sets a custom page served to denied clients when the
+// handler has no deny handler. Clients that ask for JSON still get
+// the JSON response. Passing nil restores the default.
+func (h *Handler) SetDenyPage(page *DenyPage) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.denyPage = page
+}
+
+// validErrorStatus returns true if status is a 4xx or 5xx HTTP
+// status code.
+func validErrorStatus(status int) bool {
+	return status >= 400 && status <= 599
+}
+
+// SetDenyStatus sets the status code returned to denied clients when
+// the handler has no deny handler. The default is 401 Unauthorized;
+// 403 Forbidden is often a better fit for an address-based block.
+// The status must be a 4xx or 5xx code.
+func (h *Handler) SetDenyStatus(status int) error {
+	if !validErrorStatus(status) {
+		return errors.New("netallow: deny status must be a 4xx or 5xx code")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.denyStatus = status
+	return nil
+}
+
+// SetLookupErrorStatus sets the status code returned when the
+// client's address can't be found. The default is 500 Internal
+// Server Error. The status must be a 4xx or 5xx code.
+func (h *Handler) SetLookupErrorStatus(status int) error {
+	if !validErrorStatus(status) {
+		return errors.New("netallow: lookup error status must be a 4xx or 5xx code")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lookupErrorStatus = status
+	return nil
+}
+
+// A LookupErrorPolicy decides how a Handler responds to a request
+// when the client's address can't be found, such as when the
+// request's RemoteAddr is malformed.
+type LookupErrorPolicy int
+
+const (
+	// FailError responds with the lookup error status, 500 by
+	// default (see SetLookupErrorStatus). It is the default.
+	FailError LookupErrorPolicy = iota
+
+	// FailClosed treats the request as denied, responding as for
+	// any other denied request.
+	FailClosed
+
+	// FailOpen treats the request as permitted, passing it to the
+	// allow handler. It should only be used where the ACL is a
+	// convenience rather than a security boundary.
+	FailOpen
+)
+
+// String returns the name of the policy.
+func (p LookupErrorPolicy) String() string {
+	switch p {
+	case FailError:
+		return "error"
+	case FailClosed:
+		return "closed"
+	case FailOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// OnLookupError sets how the handler responds when the client's
+// address can't be found. Requests without an address aren't
+// audited, reported to observers, or passed to the OnAllow and
+// OnDeny functions, and aren't affected by the bypass.
+func (h *Handler) OnLookupError(policy LookupErrorPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lookupPolicy = policy
+}
+
+// SetFamily restricts the handler to a single address family;
+// requests from the other family are denied without consulting the
+// ACL. See Family for how IPv4-mapped addresses are treated.
+func (h *Handler) SetFamily(family Family) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.family = family
+}
+
+// RequireCert requires that, in addition to coming from a permitted
+// address, requests present a TLS client certificate permitted by
+// certs. Passing nil removes the requirement.
+func (h *Handler) RequireCert(certs *CertFingerprintACL) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.certs = certs
+}
+
+// SetBypass turns the ACL bypass on or off. While the bypass is on,
+// every request is passed to the allow handler; requests that the ACL
+// would have denied are logged and counted (see ShadowDenied)
+// instead. This is intended for incident response, and may be
+// toggled while the handler is serving requests.
+func (h *Handler) SetBypass(on bool) {
+	if on {
+		log.Println("WARNING: netallow ACL bypass is active; all requests will be permitted")
+		atomic.StoreInt32(&h.bypass, 1)
+	} else {
+		atomic.StoreInt32(&h.bypass, 0)
+		log.Println("netallow ACL bypass is no longer active")
+	}
+}
+
+// Bypassed returns true if the ACL bypass is on.
+func (h *Handler) Bypassed() bool {
+	return atomic.LoadInt32(&h.bypass) == 1
+}
+
+// ShadowDenied returns the number of requests that were permitted
+// by the bypass that the ACL would have denied.
+func (h *Handler) ShadowDenied() uint64 {
+	return atomic.LoadUint64(&h.shadowDenied)
+}
+
+// requestChecker is implemented by ACLs that wrap other ACLs, so
+// that the wrapped ACL is given the request as it would be by a
+// Handler; see checkRequest.
+type requestChecker interface {
+	checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string)
+}
+
+// checkRequest checks the IP against acl, giving ACLs that use more
+// of the request, such as a MethodACL, the parts they need. It
+// returns the decision and the matching rule if the ACL reported
+// one; the returned request carries any details the ACL resolved
+// while making its decision.
+func checkRequest(acl ACL, req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	var permitted bool
+	var rule string
+	switch acl := acl.(type) {
+	case requestChecker:
+		return acl.checkRequest(req, ip)
+	case geoPermitter:
+		var info *GeoInfo
+		permitted, info = acl.PermittedGeo(ip)
+		if info != nil {
+			req = req.WithContext(withGeoInfo(req.Context(), info))
+		}
+	case methodPermitter:
+		permitted = acl.PermittedMethod(ip, req.Method)
+	case requestPermitter:
+		permitted = acl.PermittedRequest(ip, req)
+	case ContextACL:
+		var err error
+		permitted, err = acl.PermittedCtx(req.Context(), ip)
+		if err != nil {
+			log.Printf("netallow: failed to check %s: %v", ip, err)
+		}
+	default:
+		permitted, rule = matchRule(acl, ip)
+	}
+
+	return req, permitted, rule
+}
+
+// decide checks the request against the handler's ACL and any
+// additional requirements, returning the decision and the matching
+// rule if the ACL reported one. The returned request carries any
+// details the ACL resolved while making its decision.
+func (h *Handler) decide(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	h.lock.RLock()
+	allowed := h.allowed
+	certs := h.certs
+	sessions := h.sessions
+	family := h.family
+	h.lock.RUnlock()
+
+	// With AnyFamily, every address, even an invalid one, is left
+	// to the ACL.
+	if family != AnyFamily && !family.Permits(ip) {
+		return req, false, ""
+	}
+
+	req, permitted, rule := checkRequest(allowed, req, ip)
+	if permitted && certs != nil && !certs.PermittedRequest(req) {
+		permitted = false
+	}
+
+	if permitted && sessions != nil && !sessions.permits(req, ip) {
+		permitted = false
+	}
+
+	return req, permitted, rule
+}
+
 // ServeHTTP wraps the request in a allowed check.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ip, err := HTTPRequestLookup(req)
+	h.lock.RLock()
+	lookup := h.lookup
+	lookupErrorStatus := h.lookupErrorStatus
+	lookupPolicy := h.lookupPolicy
+	denyPage := h.denyPage
+	denyStatus := h.denyStatus
+	h.lock.RUnlock()
+
+	ip, err := lookup.Address(req)
 	if err != nil {
 		log.Printf("failed to lookup request address: %v", err)
-		status := http.StatusInternalServerError
-		http.Error(w, http.StatusText(status), status)
+		switch lookupPolicy {
+		case FailOpen:
+			h.allowHandler.ServeHTTP(w, req)
+		case FailClosed:
+			h.serveDenied(w, req, nil, denyPage, denyStatus)
+		default:
+			http.Error(w, http.StatusText(lookupErrorStatus), lookupErrorStatus)
+		}
 		return
 	}
 
-	if h.allowed.Permitted(ip) {
+	h.lock.RLock()
+	audit := h.audit
+	observer := h.observer
+	onAllow := h.onAllow
+	onDeny := h.onDeny
+	h.lock.RUnlock()
+
+	req, permitted, rule := h.decide(req, ip)
+	if audit != nil {
+		err = audit.Record(AuditRecord{
+			Source:    ip,
+			Permitted: permitted,
+			Rule:      rule,
+			Path:      requestPath(req),
+		})
+		if err != nil {
+			log.Printf("failed to write audit record: %v", err)
+		}
+	}
+
+	if observer != nil {
+		observer.Observe(permitted, ExemplarFromRequest(req))
+	}
+
+	if permitted && onAllow != nil {
+		onAllow(ip, req)
+	} else if !permitted && onDeny != nil {
+		onDeny(ip, req)
+	}
+
+	if !permitted && h.Bypassed() {
+		atomic.AddUint64(&h.shadowDenied, 1)
+		log.Printf("WARNING: netallow bypass permitted %s, which the ACL denies", ip)
+		permitted = true
+	}
+
+	if permitted {
 		h.allowHandler.ServeHTTP(w, req)
 	} else {
-		if h.denyHandler == nil {
-			status := http.StatusUnauthorized
-			http.Error(w, http.StatusText(status), status)
-		} else {
-			h.denyHandler.ServeHTTP(w, req)
-		}
+		h.serveDenied(w, req, ip, denyPage, denyStatus)
+	}
+}
+
+// serveDenied responds to a denied request with the deny handler, or
+// the default response if there isn't one.
+func (h *Handler) serveDenied(w http.ResponseWriter, req *http.Request, ip net.IP, page *DenyPage, status int) {
+	if h.denyHandler != nil {
+		h.denyHandler.ServeHTTP(w, req)
+	} else {
+		writeDeny(w, req, ip, page, status)
 	}
 }
 
@@ -101,6 +554,7 @@ type HandlerFunc struct {
 	allow   func(http.ResponseWriter, *http.Request)
 	deny    func(http.ResponseWriter, *http.Request)
 	allowed ACL
+	lookup  Lookup
 }
 
 // NewHandlerFunc returns a new basic ACL handler.
@@ -117,13 +571,25 @@ func NewHandlerFunc(allow, deny func(http.ResponseWriter, *http.Request), acl AC
 		allow:   allow,
 		deny:    deny,
 		allowed: acl,
+		lookup:  HTTPLookup{},
 	}, nil
 }
 
+// SetLookup sets how the client's address is found; the Lookup is
+// passed the *http.Request. Passing nil restores the default,
+// HTTPLookup. It must not be called while the handler is serving
+// requests.
+func (h *HandlerFunc) SetLookup(lookup Lookup) {
+	if lookup == nil {
+		lookup = HTTPLookup{}
+	}
+	h.lookup = lookup
+}
+
 // ServeHTTP checks the incoming request to see whether it is permitted,
 // and calls the appropriate handle function.
 func (h *HandlerFunc) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ip, err := HTTPRequestLookup(req)
+	ip, err := h.lookup.Address(req)
 	if err != nil {
 		log.Printf("failed to lookup request address: %v", err)
 		status := http.StatusInternalServerError
@@ -135,8 +601,7 @@ func (h *HandlerFunc) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		h.allow(w, req)
 	} else {
 		if h.deny == nil {
-			status := http.StatusUnauthorized
-			http.Error(w, http.StatusText(status), status)
+			writeDeny(w, req, ip, nil, http.StatusUnauthorized)
 		} else {
 			h.deny(w, req)
 		}
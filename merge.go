@@ -0,0 +1,45 @@
+package netallow
+
+import (
+	"net"
+)
+
+// MergeBasic returns a new host ACL permitting every address that
+// either a or b permits. An address disabled in one ACL and enabled
+// in the other is enabled; one disabled in both stays disabled.
+// Neither ACL is modified.
+func MergeBasic(a, b *Basic) *Basic {
+	acl := NewBasic()
+	for _, src := range []*Basic{a, b} {
+		src.lock.RLock()
+		for addr, enabled := range src.allowed {
+			acl.allowed[addr] = acl.allowed[addr] || enabled
+		}
+		src.lock.RUnlock()
+	}
+
+	acl.updateSingle()
+	return acl
+}
+
+// MergeBasicNet returns a new network ACL permitting every address
+// that either a or b permits. As with BasicNet.Add, networks already
+// covered by another network are dropped, which includes networks
+// that appear in both ACLs. Neither ACL is modified.
+func MergeBasicNet(a, b *BasicNet) *BasicNet {
+	var nets []*net.IPNet
+	for _, src := range []*BasicNet{a, b} {
+		src.lock.RLock()
+		for _, n := range src.allowed {
+			if n != nil {
+				nets = append(nets, n)
+			}
+		}
+		src.lock.RUnlock()
+	}
+
+	acl := NewBasicNet()
+	acl.allowed = dropCovered(nets)
+	sortNets(acl.allowed)
+	return acl
+}
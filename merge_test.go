@@ -0,0 +1,80 @@
+package netallow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeBasic(t *testing.T) {
+	a := NewBasic()
+	addIPString(a, "192.0.2.1", t)
+	addIPString(a, "192.0.2.2", t)
+	addIPString(a, "192.0.2.3", t)
+	a.Disable(mustParseIP(t, "192.0.2.2"))
+	a.Disable(mustParseIP(t, "192.0.2.3"))
+
+	b := NewBasic()
+	addIPString(b, "192.0.2.2", t)
+	addIPString(b, "2001:db8::1", t)
+
+	acl := MergeBasic(a, b)
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":   true,
+		"192.0.2.2":   true,
+		"192.0.2.3":   false,
+		"2001:db8::1": true,
+		"192.0.2.4":   false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if acl.Count() != 4 {
+		t.Fatalf("expected 4 addresses, but have %d", acl.Count())
+	}
+
+	// The inputs are unchanged.
+	if checkIPString(a, "2001:db8::1", t) || checkIPString(a, "192.0.2.2", t) || b.Count() != 2 {
+		t.Fatal("MergeBasic modified its inputs")
+	}
+
+	single := MergeBasic(NewBasic(), b)
+	delIPString(single, "2001:db8::1", t)
+	if !checkIPString(single, "192.0.2.2", t) || checkIPString(single, "192.0.2.1", t) {
+		t.Fatal("merged ACL with a single entry doesn't match")
+	}
+}
+
+func TestMergeBasicNet(t *testing.T) {
+	a := NewBasicNet()
+	testAddNet(a, "10.0.0.0/8", t)
+	testAddNet(a, "192.168.1.0/24", t)
+
+	b := NewBasicNet()
+	testAddNet(b, "192.168.1.0/24", t)
+	testAddNet(b, "10.1.0.0/16", t)
+	testAddNet(b, "2001:db8::/32", t)
+
+	acl := MergeBasicNet(a, b)
+	expected := "10.0.0.0/8,192.168.1.0/24,2001:db8::/32"
+	if have := strings.Join(testNetList(acl), ","); have != expected {
+		t.Fatalf("expected %s, but have %s", expected, have)
+	}
+
+	for addr, permitted := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.2.5": false,
+		"2001:db8::5": true,
+		"2001:db9::5": false,
+	} {
+		if checkIPString(acl, addr, t) != permitted {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if a.Count() != 2 || b.Count() != 3 {
+		t.Fatal("MergeBasicNet modified its inputs")
+	}
+}
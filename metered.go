@@ -0,0 +1,113 @@
+package netallow
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// MeteredACL wraps an ACL, counting how many addresses it permits
+// and denies. The counters are updated atomically, so a MeteredACL
+// adds little to the cost of a check. In a Handler, the wrapped ACL
+// is given the request as it would be on its own, so that ACLs such
+// as a MethodACL or TokenACL decide as they normally would.
+type MeteredACL struct {
+	allowed uint64 // accessed atomically; keep 64-bit aligned
+	denied  uint64 // accessed atomically
+	acl     ACL
+}
+
+// NewMeteredACL returns a MeteredACL wrapping acl.
+func NewMeteredACL(acl ACL) *MeteredACL {
+	return &MeteredACL{acl: acl}
+}
+
+// ACL returns the wrapped ACL.
+func (m *MeteredACL) ACL() ACL {
+	return m.acl
+}
+
+// count records a decision.
+func (m *MeteredACL) count(permitted bool) {
+	if permitted {
+		atomic.AddUint64(&m.allowed, 1)
+	} else {
+		atomic.AddUint64(&m.denied, 1)
+	}
+}
+
+// Permitted checks the IP against the wrapped ACL, counting the
+// decision.
+func (m *MeteredACL) Permitted(ip net.IP) bool {
+	permitted := m.acl.Permitted(ip)
+	m.count(permitted)
+	return permitted
+}
+
+// MatchRule checks the IP against the wrapped ACL, counting the
+// decision, and returns the matching entry if the wrapped ACL
+// reports one.
+func (m *MeteredACL) MatchRule(ip net.IP) (string, bool) {
+	permitted, rule := matchRule(m.acl, ip)
+	m.count(permitted)
+	return rule, permitted
+}
+
+// PermittedCtx checks the IP against the wrapped ACL, passing ctx
+// along if it is a ContextACL, and counts the decision.
+func (m *MeteredACL) PermittedCtx(ctx context.Context, ip net.IP) (bool, error) {
+	acl, ok := m.acl.(ContextACL)
+	if !ok {
+		return m.Permitted(ip), nil
+	}
+
+	permitted, err := acl.PermittedCtx(ctx, ip)
+	m.count(permitted)
+	return permitted, err
+}
+
+// checkRequest passes the request to the wrapped ACL, counting the
+// decision.
+func (m *MeteredACL) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	req, permitted, rule := checkRequest(m.acl, req, ip)
+	m.count(permitted)
+	return req, permitted, rule
+}
+
+// Stats returns the number of addresses permitted and denied so far.
+func (m *MeteredACL) Stats() (allowed, denied uint64) {
+	return atomic.LoadUint64(&m.allowed), atomic.LoadUint64(&m.denied)
+}
+
+// Add adds the IP to the wrapped ACL if it is a HostACL; otherwise,
+// it does nothing.
+func (m *MeteredACL) Add(ip net.IP) {
+	if acl, ok := m.acl.(HostACL); ok {
+		acl.Add(ip)
+	}
+}
+
+// Remove removes the IP from the wrapped ACL if it is a HostACL;
+// otherwise, it does nothing.
+func (m *MeteredACL) Remove(ip net.IP) {
+	if acl, ok := m.acl.(HostACL); ok {
+		acl.Remove(ip)
+	}
+}
+
+// AddNet adds the network to the wrapped ACL if it is a NetACL;
+// otherwise, it does nothing.
+func (m *MeteredACL) AddNet(n *net.IPNet) {
+	if acl, ok := m.acl.(NetACL); ok {
+		acl.Add(n)
+	}
+}
+
+// RemoveNet removes the network from the wrapped ACL if it is a
+// NetACL; otherwise, it does nothing.
+func (m *MeteredACL) RemoveNet(n *net.IPNet) {
+	if acl, ok := m.acl.(NetACL); ok {
+		acl.Remove(n)
+	}
+}
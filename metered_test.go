@@ -0,0 +1,109 @@
+package netallow
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMeteredACL(t *testing.T) {
+	acl := NewMeteredACL(NewBasic())
+	acl.Add(mustParseIP(t, "192.0.2.1"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				acl.Permitted(net.IP{192, 0, 2, 1})
+				acl.Permitted(net.IP{192, 0, 2, 2})
+				acl.Permitted(net.IP{192, 0, 2, 3})
+			}
+		}()
+	}
+	wg.Wait()
+
+	allowed, denied := acl.Stats()
+	if allowed != 8000 || denied != 16000 {
+		t.Fatalf("expected 8000 permitted and 16000 denied, but have %d and %d", allowed, denied)
+	}
+
+	acl.Remove(mustParseIP(t, "192.0.2.1"))
+	if acl.ACL().Permitted(mustParseIP(t, "192.0.2.1")) {
+		t.Fatal("Remove should pass through to the wrapped ACL")
+	}
+
+	// Network operations don't apply to a host ACL.
+	acl.AddNet(mustParseNet(t, "192.0.2.0/24"))
+	if acl.ACL().Permitted(mustParseIP(t, "192.0.2.1")) {
+		t.Fatal("AddNet shouldn't affect a host ACL")
+	}
+}
+
+func TestMeteredACLNet(t *testing.T) {
+	acl := NewMeteredACL(NewBasicNet())
+	acl.AddNet(mustParseNet(t, "192.0.2.0/24"))
+	acl.Add(mustParseIP(t, "198.51.100.1"))
+
+	if !checkIPString(acl, "192.0.2.1", t) || checkIPString(acl, "198.51.100.1", t) {
+		t.Fatal("only the network should have been added")
+	}
+
+	acl.RemoveNet(mustParseNet(t, "192.0.2.0/24"))
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("RemoveNet should pass through to the wrapped ACL")
+	}
+
+	if allowed, denied := acl.Stats(); allowed != 1 || denied != 2 {
+		t.Fatalf("expected 1 permitted and 2 denied, but have %d and %d", allowed, denied)
+	}
+}
+
+func TestMeteredACLHandler(t *testing.T) {
+	tokens, clock := testTokenACL(t)
+	token := testIssueToken(tokens, clock, t, "127.0.0.0/8")
+
+	acl := NewMeteredACL(tokens)
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for tok, expected := range map[string]string{token: "OK", "": "NO"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		req.Header.Set(DefaultTokenHeader, tok)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("Expected %s, but got %s", expected, w.Body.String())
+		}
+	}
+
+	if allowed, denied := acl.Stats(); allowed != 1 || denied != 1 {
+		t.Fatalf("expected 1 permitted and 1 denied, but have %d and %d", allowed, denied)
+	}
+}
+
+func TestMeteredACLMatchRule(t *testing.T) {
+	inner := NewBasicNet()
+	testAddNet(inner, "192.0.2.0/24", t)
+	acl := NewMeteredACL(inner)
+
+	if rule, permitted := acl.MatchRule(mustParseIP(t, "192.0.2.1")); !permitted || rule != "192.0.2.0/24" {
+		t.Fatalf("expected the wrapped ACL's rule, have (%q, %v)", rule, permitted)
+	}
+
+	// ACLs that aren't ContextACLs are checked with Permitted.
+	permitted, err := acl.PermittedCtx(context.Background(), mustParseIP(t, "198.51.100.1"))
+	if err != nil || permitted {
+		t.Fatalf("expected the address to be denied, have (%v, %v)", permitted, err)
+	}
+
+	if allowed, denied := acl.Stats(); allowed != 1 || denied != 1 {
+		t.Fatalf("expected 1 permitted and 1 denied, but have %d and %d", allowed, denied)
+	}
+}
@@ -0,0 +1,102 @@
+package netallow
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// methodPermitter is implemented by ACLs whose decision depends on
+// the HTTP request method. The Handler passes the request's method
+// to these ACLs.
+type methodPermitter interface {
+	PermittedMethod(ip net.IP, method string) bool
+}
+
+// MethodACL is a host ACL whose entries may be limited to a set of
+// HTTP methods, so that, for example, a wide set of clients can be
+// given read access while only a few are allowed to write. When used
+// with a Handler, the request method is taken into account.
+type MethodACL struct {
+	lock *sync.Mutex
+
+	// allowed maps addresses to their permitted methods; a nil
+	// set means every method is permitted.
+	allowed map[string]map[string]bool
+}
+
+// NewMethodACL returns a new, empty method-scoped ACL.
+func NewMethodACL() *MethodACL {
+	return &MethodACL{
+		lock:    new(sync.Mutex),
+		allowed: map[string]map[string]bool{},
+	}
+}
+
+// Add permits the IP to use every method.
+func (acl *MethodACL) Add(ip net.IP) {
+	acl.AddForMethods(ip)
+}
+
+// AddForMethods permits the IP to use only the given methods,
+// replacing any methods it was previously permitted. If no methods
+// are given, every method is permitted.
+func (acl *MethodACL) AddForMethods(ip net.IP, methods ...string) {
+	if !validIP(ip) {
+		return
+	}
+
+	var set map[string]bool
+	if len(methods) > 0 {
+		set = map[string]bool{}
+		for _, method := range methods {
+			set[strings.ToUpper(method)] = true
+		}
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed[ip.String()] = set
+}
+
+// Remove drops the IP from the ACL.
+func (acl *MethodACL) Remove(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	delete(acl.allowed, ip.String())
+}
+
+// PermittedMethod returns true if the IP is permitted to use the
+// method.
+func (acl *MethodACL) PermittedMethod(ip net.IP, method string) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	methods, ok := acl.allowed[ip.String()]
+	if !ok {
+		return false
+	}
+
+	return methods == nil || methods[strings.ToUpper(method)]
+}
+
+// Permitted returns true if the IP is permitted to use every method.
+// An IP limited to some methods is not permitted, since the method
+// isn't known.
+func (acl *MethodACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	methods, ok := acl.allowed[ip.String()]
+	return ok && methods == nil
+}
@@ -0,0 +1,98 @@
+package netallow
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodACL(t *testing.T) {
+	acl := NewMethodACL()
+	reader := net.ParseIP("192.168.1.5")
+	admin := net.ParseIP("192.168.1.1")
+
+	acl.AddForMethods(reader, "get", "HEAD")
+	acl.Add(admin)
+
+	tv := []struct {
+		ip       net.IP
+		method   string
+		expected bool
+	}{
+		{reader, "GET", true},
+		{reader, "HEAD", true},
+		{reader, "POST", false},
+		{admin, "GET", true},
+		{admin, "POST", true},
+		{net.ParseIP("192.168.1.2"), "GET", false},
+		{nil, "GET", false},
+	}
+
+	for _, tc := range tv {
+		if acl.PermittedMethod(tc.ip, tc.method) != tc.expected {
+			t.Fatalf("expected PermittedMethod(%s, %s) to be %v",
+				tc.ip, tc.method, tc.expected)
+		}
+	}
+
+	if acl.Permitted(reader) || !acl.Permitted(admin) {
+		t.Fatal("only unrestricted entries should be permitted without a method")
+	}
+
+	acl.Remove(admin)
+	if acl.PermittedMethod(admin, "GET") {
+		t.Fatal("ACL should have denied removed address")
+	}
+}
+
+func TestMethodACLHandler(t *testing.T) {
+	acl := NewMethodACL()
+	acl.AddForMethods(net.ParseIP("127.0.0.1"), "GET")
+
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for method, expected := range map[string]string{"GET": "OK", "POST": "NO"} {
+		req := httptest.NewRequest(method, "/", nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("%s: Expected %s, but got %s", method, expected, w.Body.String())
+		}
+	}
+}
+
+func TestMethodACLWrapped(t *testing.T) {
+	acl := NewMethodACL()
+	acl.AddForMethods(net.ParseIP("127.0.0.1"), "GET")
+
+	toggle, err := NewToggleACL(acl, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	toggle.SetEnforcing(true)
+
+	for name, wrapped := range map[string]ACL{
+		"FamilyACL": NewFamilyACL(acl, V4Only),
+		"SeenACL":   NewSeenACL(acl, 0),
+		"ToggleACL": toggle,
+	} {
+		h, err := NewHandler(testAllowHandler, testDenyHandler, wrapped)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for method, expected := range map[string]string{"GET": "OK", "POST": "NO"} {
+			req := httptest.NewRequest(method, "/", nil)
+			req.RemoteAddr = "127.0.0.1:4141"
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Body.String() != expected {
+				t.Fatalf("%s: %s: Expected %s, but got %s", name, method, expected, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package netallow
+
+import (
+	"net/http"
+)
+
+// An Option configures a Handler built by Middleware. Options that
+// can fail, such as WithDenyStatus, return an error.
+type Option func(*Handler) error
+
+// WithDenyHandler sets the handler called for denied requests,
+// instead of the default deny response.
+func WithDenyHandler(deny http.Handler) Option {
+	return func(h *Handler) error {
+		h.denyHandler = deny
+		return nil
+	}
+}
+
+// WithDenyStatus sets the status code of the default deny response;
+// see Handler.SetDenyStatus.
+func WithDenyStatus(status int) Option {
+	return func(h *Handler) error {
+		return h.SetDenyStatus(status)
+	}
+}
+
+// WithLookup sets how the client's address is found; see
+// Handler.SetLookup.
+func WithLookup(lookup Lookup) Option {
+	return func(h *Handler) error {
+		h.SetLookup(lookup)
+		return nil
+	}
+}
+
+// WithAudit records each access decision to sink; see
+// Handler.SetAudit.
+func WithAudit(sink *AuditSink) Option {
+	return func(h *Handler) error {
+		h.SetAudit(sink)
+		return nil
+	}
+}
+
+// WithObserver reports each access decision to o; see
+// Handler.SetObserver.
+func WithObserver(o Observer) Option {
+	return func(h *Handler) error {
+		h.SetObserver(o)
+		return nil
+	}
+}
+
+// Middleware returns a function that wraps a handler with the ACL,
+// for use with routers that chain middleware of the form
+// func(http.Handler) http.Handler. The wrapped handler serves
+// permitted requests; denied requests get the default deny response,
+// a 401 Unauthorized, unless the options say otherwise.
+//
+// Like http.ServeMux.Handle, Middleware panics if it is misused: if
+// the ACL is nil, or if an option fails when a handler is wrapped.
+func Middleware(acl ACL, opts ...Option) func(http.Handler) http.Handler {
+	if acl == nil {
+		panic("netallow: ACL cannot be nil")
+	}
+
+	return func(next http.Handler) http.Handler {
+		h, err := NewACLHandler(next, nil, acl)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, opt := range opts {
+			if err = opt(h); err != nil {
+				panic(err)
+			}
+		}
+		return h
+	}
+}
@@ -0,0 +1,62 @@
+package netallow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", Middleware(acl)(testAllowHandler))
+	mux.Handle("/custom", Middleware(acl, WithDenyHandler(testDenyHandler))(testAllowHandler))
+	mux.Handle("/forbidden", Middleware(acl, WithDenyStatus(http.StatusForbidden))(testAllowHandler))
+
+	tv := []struct {
+		path   string
+		remote string
+		status int
+		body   string
+	}{
+		{"/", "192.0.2.1:4141", http.StatusOK, "OK"},
+		{"/", "192.0.2.2:4141", http.StatusUnauthorized, ""},
+		{"/custom", "192.0.2.2:4141", http.StatusOK, "NO"},
+		{"/forbidden", "192.0.2.2:4141", http.StatusForbidden, ""},
+		{"/forbidden", "192.0.2.1:4141", http.StatusOK, "OK"},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.RemoteAddr = tc.remote
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Fatalf("%s from %s: expected status %d, but have %d", tc.path, tc.remote, tc.status, w.Code)
+		}
+
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Fatalf("%s from %s: expected %s, but got %s", tc.path, tc.remote, tc.body, w.Body.String())
+		}
+	}
+}
+
+func TestMiddlewarePanics(t *testing.T) {
+	for name, fn := range map[string]func(){
+		"nil ACL":    func() { Middleware(nil) },
+		"bad option": func() { Middleware(NewBasic(), WithDenyStatus(http.StatusOK))(testAllowHandler) },
+		"nil next":   func() { Middleware(NewBasic())(nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: expected Middleware to panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
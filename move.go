@@ -0,0 +1,168 @@
+package netallow
+
+// This file contains support for moving addresses between ACLs, such
+// as from an allow list to a quarantine list.
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+)
+
+// MoveIP moves the IP from one host ACL to another. The two ACLs
+// don't share a lock, so the move can't be atomic: the IP is added
+// to the destination before it is removed from the source. A
+// concurrent check may see the IP in both ACLs, but never in
+// neither, and a failure part way through leaves the IP in both
+// rather than losing it. Where a true atomic move is needed, keep
+// the lists in a ListSet and use its Move method.
+//
+// Moving an IP from an ACL to itself does nothing.
+func MoveIP(from, to HostACL, ip net.IP) {
+	if sameACL(from, to) {
+		return
+	}
+
+	to.Add(ip)
+	from.Remove(ip)
+}
+
+// sameACL returns true if a and b are the same ACL. ACLs whose types
+// can't be compared, which would make == panic, are never the same.
+func sameACL(a, b HostACL) bool {
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || t == nil || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// A ListSet holds a number of named host lists under a single lock,
+// so that addresses can be moved between them atomically.
+type ListSet struct {
+	lock  *sync.Mutex
+	lists map[string]map[string]bool
+}
+
+// NewListSet returns a new ListSet with empty lists for each of the
+// names.
+func NewListSet(names ...string) *ListSet {
+	ls := &ListSet{
+		lock:  new(sync.Mutex),
+		lists: map[string]map[string]bool{},
+	}
+
+	for _, name := range names {
+		ls.lists[name] = map[string]bool{}
+	}
+	return ls
+}
+
+// list returns the named list. The caller must hold the lock.
+func (ls *ListSet) list(name string) (map[string]bool, error) {
+	list, ok := ls.lists[name]
+	if !ok {
+		return nil, errors.New("netallow: no list named " + name)
+	}
+	return list, nil
+}
+
+// Add adds the IP to the named list.
+func (ls *ListSet) Add(name string, ip net.IP) error {
+	if !validIP(ip) {
+		return errors.New("netallow: invalid IP address")
+	}
+
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	list, err := ls.list(name)
+	if err != nil {
+		return err
+	}
+
+	list[ip.String()] = true
+	return nil
+}
+
+// Remove drops the IP from the named list.
+func (ls *ListSet) Remove(name string, ip net.IP) error {
+	if !validIP(ip) {
+		return errors.New("netallow: invalid IP address")
+	}
+
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	list, err := ls.list(name)
+	if err != nil {
+		return err
+	}
+
+	delete(list, ip.String())
+	return nil
+}
+
+// Contains returns true if the IP is in the named list.
+func (ls *ListSet) Contains(name string, ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	return ls.lists[name][ip.String()]
+}
+
+// Move atomically moves the IP from one list to another; no check
+// sees it in both lists or in neither. It is an error if the IP
+// isn't in the source list.
+func (ls *ListSet) Move(ip net.IP, from, to string) error {
+	if !validIP(ip) {
+		return errors.New("netallow: invalid IP address")
+	}
+
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	src, err := ls.list(from)
+	if err != nil {
+		return err
+	}
+
+	dst, err := ls.list(to)
+	if err != nil {
+		return err
+	}
+
+	addr := ip.String()
+	if !src[addr] {
+		return errors.New("netallow: " + addr + " is not in list " + from)
+	}
+
+	delete(src, addr)
+	dst[addr] = true
+	return nil
+}
+
+// List returns a HostACL backed by the named list, so that it can be
+// used anywhere an ACL is expected. Adding to or removing from an
+// unknown list does nothing, and it permits no addresses.
+func (ls *ListSet) List(name string) HostACL {
+	return listSetACL{set: ls, name: name}
+}
+
+type listSetACL struct {
+	set  *ListSet
+	name string
+}
+
+func (acl listSetACL) Permitted(ip net.IP) bool {
+	return acl.set.Contains(acl.name, ip)
+}
+
+func (acl listSetACL) Add(ip net.IP) {
+	acl.set.Add(acl.name, ip)
+}
+
+func (acl listSetACL) Remove(ip net.IP) {
+	acl.set.Remove(acl.name, ip)
+}
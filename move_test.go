@@ -0,0 +1,151 @@
+package netallow
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMoveIP(t *testing.T) {
+	allowed := NewBasic()
+	watched := NewBasic()
+	addIPString(allowed, "192.168.1.1", t)
+	addIPString(allowed, "192.168.1.2", t)
+
+	MoveIP(allowed, watched, mustParseIP(t, "192.168.1.1"))
+	if checkIPString(allowed, "192.168.1.1", t) {
+		t.Fatal("address should have been removed from the source")
+	}
+
+	if !checkIPString(watched, "192.168.1.1", t) {
+		t.Fatal("address should have been added to the destination")
+	}
+
+	if !checkIPString(allowed, "192.168.1.2", t) {
+		t.Fatal("other addresses should not have moved")
+	}
+}
+
+// funcACL is a HostACL whose type can't be compared with ==.
+type funcACL struct {
+	permitted func(net.IP) bool
+}
+
+func (acl funcACL) Permitted(ip net.IP) bool { return acl.permitted(ip) }
+func (acl funcACL) Add(ip net.IP)            {}
+func (acl funcACL) Remove(ip net.IP)         {}
+
+func TestMoveIPSame(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.168.1.1", t)
+
+	MoveIP(acl, acl, mustParseIP(t, "192.168.1.1"))
+	if !checkIPString(acl, "192.168.1.1", t) {
+		t.Fatal("moving an address to the same ACL shouldn't remove it")
+	}
+
+	ls := NewListSet("allowed")
+	if err := ls.Add("allowed", mustParseIP(t, "192.168.1.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	MoveIP(ls.List("allowed"), ls.List("allowed"), mustParseIP(t, "192.168.1.1"))
+	if !ls.Contains("allowed", mustParseIP(t, "192.168.1.1")) {
+		t.Fatal("moving an address to the same list shouldn't remove it")
+	}
+
+	// ACLs that can't be compared don't panic.
+	uncomparable := funcACL{permitted: func(net.IP) bool { return true }}
+	MoveIP(uncomparable, uncomparable, mustParseIP(t, "192.168.1.1"))
+}
+
+func TestListSet(t *testing.T) {
+	ls := NewListSet("allow", "watch")
+	ip := mustParseIP(t, "192.168.1.1")
+	if err := ls.Add("allow", ip); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	allowed := ls.List("allow")
+	watched := ls.List("watch")
+	if !allowed.Permitted(ip) || watched.Permitted(ip) {
+		t.Fatal("address should only be in the allow list")
+	}
+
+	if err := ls.Move(ip, "allow", "watch"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if allowed.Permitted(ip) || !watched.Permitted(ip) {
+		t.Fatal("address should only be in the watch list")
+	}
+
+	// The address is no longer in the allow list.
+	if err := ls.Move(ip, "allow", "watch"); err == nil {
+		t.Fatal("Move should fail when the address isn't in the source")
+	}
+
+	if err := ls.Move(ip, "watch", "block"); err == nil {
+		t.Fatal("Move should fail with an unknown list")
+	}
+
+	if !watched.Permitted(ip) {
+		t.Fatal("failed move should leave the address in place")
+	}
+
+	// Views work with MoveIP too.
+	MoveIP(watched, allowed, ip)
+	if !ls.Contains("allow", ip) || ls.Contains("watch", ip) {
+		t.Fatal("address should have moved back to the allow list")
+	}
+
+	if err := ls.Remove("allow", ip); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if allowed.Permitted(ip) {
+		t.Fatal("address should have been removed")
+	}
+
+	if err := ls.Add("block", ip); err == nil {
+		t.Fatal("Add should fail with an unknown list")
+	}
+
+	if err := ls.Add("allow", nil); err == nil {
+		t.Fatal("Add should fail with an invalid address")
+	}
+}
+
+func TestListSetConcurrentMove(t *testing.T) {
+	ls := NewListSet("a", "b")
+	ip := mustParseIP(t, "10.0.0.1")
+	ls.Add("a", ip)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if i%2 == 0 {
+				ls.Move(ip, "a", "b")
+			} else {
+				ls.Move(ip, "b", "a")
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// Check both lists under the lock so the observation
+		// is consistent.
+		ls.lock.Lock()
+		a, b := ls.lists["a"]["10.0.0.1"], ls.lists["b"]["10.0.0.1"]
+		ls.lock.Unlock()
+		if a == b {
+			t.Fatalf("address in both lists or neither (a=%v, b=%v)", a, b)
+		}
+	}
+}
@@ -4,7 +4,11 @@
 package netallow
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"sort"
@@ -33,6 +37,129 @@ type HostACL interface {
 	Remove(net.IP)
 }
 
+// A RuleMatcher is an ACL that can report which of its entries
+// permitted an address. It is used to annotate audit records.
+type RuleMatcher interface {
+	ACL
+
+	// MatchRule returns true and the entry that matched if the
+	// IP address is permitted.
+	MatchRule(net.IP) (string, bool)
+}
+
+// A ContextACL is an ACL whose checks may block, such as one that
+// consults an external service. PermittedCtx should give up when ctx
+// is done. A Handler uses PermittedCtx in preference to Permitted,
+// passing the request's context.
+type ContextACL interface {
+	ACL
+
+	// PermittedCtx returns true if the IP address is permitted
+	// access. If the decision couldn't be made normally, it
+	// returns an error along with the decision to use instead,
+	// which lets the ACL choose whether to fail open or closed;
+	// the Handler logs the error and uses the decision.
+	PermittedCtx(ctx context.Context, ip net.IP) (bool, error)
+}
+
+// matchRule checks whether ip is permitted by acl, returning the
+// matching entry if the ACL is able to report one.
+func matchRule(acl ACL, ip net.IP) (bool, string) {
+	if rm, ok := acl.(RuleMatcher); ok {
+		rule, permitted := rm.MatchRule(ip)
+		return permitted, rule
+	}
+
+	return acl.Permitted(ip), ""
+}
+
+// A BatchACL is an ACL that can check several addresses while
+// taking its lock once.
+type BatchACL interface {
+	ACL
+
+	// PermittedAny returns true if any of the IP addresses is
+	// permitted.
+	PermittedAny([]net.IP) bool
+
+	// PermittedAll returns true if every one of the IP addresses
+	// is permitted, and there is at least one.
+	PermittedAll([]net.IP) bool
+}
+
+// PermittedAny returns true if the ACL permits any of the IPs, such
+// as the addresses a hostname resolves to. ACLs implementing
+// BatchACL check the whole batch at once.
+func PermittedAny(acl ACL, ips []net.IP) bool {
+	if batch, ok := acl.(BatchACL); ok {
+		return batch.PermittedAny(ips)
+	}
+
+	for _, ip := range ips {
+		if acl.Permitted(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermittedAll returns true if the ACL permits every one of the IPs.
+// An empty slice is not permitted, so that a failure to find any
+// addresses doesn't grant access.
+func PermittedAll(acl ACL, ips []net.IP) bool {
+	if len(ips) == 0 {
+		return false
+	}
+
+	if batch, ok := acl.(BatchACL); ok {
+		return batch.PermittedAll(ips)
+	}
+
+	for _, ip := range ips {
+		if !acl.Permitted(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// A DeniedError is returned by Assert when an ACL would deny
+// addresses that must be permitted.
+type DeniedError struct {
+	Denied []net.IP
+}
+
+func (e *DeniedError) Error() string {
+	var addrs = make([]string, 0, len(e.Denied))
+	for _, ip := range e.Denied {
+		addrs = append(addrs, ipString(ip))
+	}
+	return "netallow: ACL denies required addresses " + strings.Join(addrs, ", ")
+}
+
+// Assert checks that the ACL permits every address in mustAllow,
+// such as an operations bastion or health checkers. It should be
+// used to check a new ACL before it replaces one in service, so that
+// administrators aren't locked out. If any address would be denied,
+// a *DeniedError listing them is returned.
+func Assert(acl ACL, mustAllow []net.IP) error {
+	var denied []net.IP
+	for _, ip := range mustAllow {
+		if !acl.Permitted(ip) {
+			denied = append(denied, ip)
+		}
+	}
+
+	if len(denied) > 0 {
+		return &DeniedError{Denied: denied}
+	}
+	return nil
+}
+
+// ErrInvalidIP is returned when an address that isn't a 4- or
+// 16-byte IP address is given to a method that reports errors.
+var ErrInvalidIP = errors.New("netallow: invalid IP address")
+
 // validIP takes an IP address (which is implemented as a byte slice)
 // and ensures that it is a possible address. Right now, this means
 // just doing length checks.
@@ -52,8 +179,54 @@ func validIP(ip net.IP) bool {
 // concurrency. IPv4 addresses are treated differently than an IPv6
 // address; namely, the IPv4 localhost will not match the IPv6 localhost.
 type Basic struct {
-	lock    *sync.Mutex
+	lock    *sync.RWMutex
 	allowed map[string]bool
+
+	// sources maps addresses added with AddFromSource to the
+	// tags of the sources they came from; "" marks an address
+	// that was also added with Add.
+	sources map[string]map[string]bool
+
+	// single holds the 16-byte form of the only permitted
+	// address when there is exactly one, so that Permitted can
+	// skip formatting the address and the map lookup.
+	single net.IP
+
+	// policy, if set, is consulted before an address is added.
+	policy AddPolicy
+
+	listeners    []listener
+	nextListener int
+}
+
+// updateSingle refreshes the single-entry fast path after the ACL
+// changes. The caller must hold the lock.
+func (acl *Basic) updateSingle() {
+	acl.single = nil
+	if len(acl.allowed) != 1 {
+		return
+	}
+
+	for addr, permitted := range acl.allowed {
+		if permitted {
+			acl.single = net.ParseIP(addr).To16()
+		}
+	}
+}
+
+// equalSingle returns true if ip is the same address as single,
+// which is in 16-byte form, without allocating.
+func equalSingle(single, ip net.IP) bool {
+	if len(ip) == net.IPv6len {
+		return bytes.Equal(single, ip)
+	}
+
+	for i := 0; i < 10; i++ {
+		if single[i] != 0 {
+			return false
+		}
+	}
+	return single[10] == 0xff && single[11] == 0xff && bytes.Equal(single[12:], ip)
 }
 
 // Permitted returns true if the IP is allowed access.
@@ -62,21 +235,95 @@ func (acl *Basic) Permitted(ip net.IP) bool {
 		return false
 	}
 
-	acl.lock.Lock()
-	permitted := acl.allowed[ip.String()]
-	acl.lock.Unlock()
-	return permitted
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	return acl.permitted(ip)
+}
+
+// permitted checks a valid IP; the caller must hold the lock.
+func (acl *Basic) permitted(ip net.IP) bool {
+	if acl.single != nil {
+		return equalSingle(acl.single, ip)
+	}
+	return acl.allowed[ip.String()]
+}
+
+// PermittedAny returns true if any of the IPs is allowed access. The
+// lock is only taken once for the whole batch.
+func (acl *Basic) PermittedAny(ips []net.IP) bool {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for _, ip := range ips {
+		if validIP(ip) && acl.permitted(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermittedAll returns true if every one of the IPs is allowed
+// access. An empty batch is not permitted.
+func (acl *Basic) PermittedAll(ips []net.IP) bool {
+	if len(ips) == 0 {
+		return false
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for _, ip := range ips {
+		if !validIP(ip) || !acl.permitted(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchRule returns true and the address as it is stored in the ACL
+// if the IP is allowed access.
+func (acl *Basic) MatchRule(ip net.IP) (string, bool) {
+	if !acl.Permitted(ip) {
+		return "", false
+	}
+
+	return ip.String(), true
 }
 
 // Add will permit access to the IP.
 func (acl *Basic) Add(ip net.IP) {
-	if !validIP(ip) {
+	if !validIP(ip) || acl.checkPolicy(ip) != nil {
 		return
 	}
 
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
-	acl.allowed[ip.String()] = true
+	acl.add(ip.String())
+}
+
+// add permits the address; the caller must hold the lock.
+func (acl *Basic) add(addr string) {
+	acl.allowed[addr] = true
+	acl.addSource(addr)
+	acl.updateSingle()
+	acl.notify(ChangeAdd, addr)
+}
+
+// AddChecked permits access to the IP, returning ErrInvalidIP if it
+// isn't a valid address, or the error from the ACL's policy if the
+// policy refuses it. Unlike Add, the caller can tell whether anything
+// was added.
+func (acl *Basic) AddChecked(ip net.IP) error {
+	if !validIP(ip) {
+		return ErrInvalidIP
+	}
+
+	if err := acl.checkPolicy(ip); err != nil {
+		return err
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.add(ip.String())
+	return nil
 }
 
 // Remove removes access by the ip.
@@ -87,75 +334,350 @@ func (acl *Basic) Remove(ip net.IP) {
 
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
-	delete(acl.allowed, ip.String())
+	acl.remove(ip.String())
+}
+
+// remove removes access by the address; the caller must hold the
+// lock.
+func (acl *Basic) remove(addr string) {
+	delete(acl.allowed, addr)
+	delete(acl.sources, addr)
+	acl.updateSingle()
+	acl.notify(ChangeRemove, addr)
+}
+
+// AddMany permits access to each of the IPs, taking the lock once for
+// the whole batch. Invalid addresses, and those refused by the ACL's
+// policy, are skipped.
+func (acl *Basic) AddMany(ips []net.IP) {
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if validIP(ip) && acl.checkPolicy(ip) == nil {
+			addrs = append(addrs, ip.String())
+		}
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, addr := range addrs {
+		acl.add(addr)
+	}
+}
+
+// RemoveMany removes access by each of the IPs, taking the lock once
+// for the whole batch. Invalid addresses are skipped.
+func (acl *Basic) RemoveMany(ips []net.IP) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, ip := range ips {
+		if validIP(ip) {
+			acl.remove(ip.String())
+		}
+	}
+}
+
+// RemoveChecked removes access by the IP, returning ErrInvalidIP if
+// it isn't a valid address. Removing a valid address that isn't in
+// the ACL isn't an error.
+func (acl *Basic) RemoveChecked(ip net.IP) error {
+	if !validIP(ip) {
+		return ErrInvalidIP
+	}
+
+	acl.Remove(ip)
+	return nil
+}
+
+// Clear removes every address from the ACL at once, so that checks
+// never see a partially emptied ACL.
+func (acl *Basic) Clear() {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed = map[string]bool{}
+	acl.sources = nil
+	acl.updateSingle()
+	acl.notifyReset()
+}
+
+// Disable stops the IP from being permitted without removing it from
+// the ACL, so that it can be enabled again later. Disabled addresses
+// are kept in dumps and serialised ACLs, prefixed with "!". Adding a
+// disabled address enables it.
+func (acl *Basic) Disable(ip net.IP) {
+	acl.setEnabled(ip, false)
+}
+
+// Enable permits an address that was disabled. It has no effect on
+// addresses that aren't in the ACL.
+func (acl *Basic) Enable(ip net.IP) {
+	acl.setEnabled(ip, true)
+}
+
+func (acl *Basic) setEnabled(ip net.IP, enabled bool) {
+	if !validIP(ip) {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	addr := ip.String()
+	if _, ok := acl.allowed[addr]; ok {
+		acl.allowed[addr] = enabled
+		acl.updateSingle()
+		if enabled {
+			acl.notify(ChangeAdd, addr)
+		} else {
+			acl.notify(ChangeRemove, addr)
+		}
+	}
+}
+
+// entryString returns the address as it is written in dumps, with a
+// "!" prefix if it is disabled.
+func entryString(addr string, enabled bool) string {
+	if enabled {
+		return addr
+	}
+	return "!" + addr
+}
+
+// parseEntry parses an address as written in dumps.
+func parseEntry(s string) (ip net.IP, enabled bool) {
+	enabled = !strings.HasPrefix(s, "!")
+	if !enabled {
+		s = s[1:]
+	}
+	return net.ParseIP(s), enabled
+}
+
+// stringMaxEntries is the most entries String lists before
+// eliding the rest.
+const stringMaxEntries = 10
+
+// describeEntries formats an ACL's sorted entries for String, as in
+// "Basic{3 hosts: 10.0.0.1, 127.0.0.1, ::1}".
+func describeEntries(kind, noun string, entries []string) string {
+	if len(entries) != 1 {
+		noun += "s"
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s{%d %s", kind, len(entries), noun)
+	for i, entry := range entries {
+		if i == 0 {
+			buf.WriteString(": ")
+		} else {
+			buf.WriteString(", ")
+		}
+
+		if i == stringMaxEntries {
+			buf.WriteString("...")
+			break
+		}
+		buf.WriteString(entry)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// String returns a summary of the ACL for debugging, listing the
+// first few addresses in sorted order. Disabled addresses are
+// prefixed with "!".
+func (acl *Basic) String() string {
+	return describeEntries("Basic", "host", acl.entries())
 }
 
 // NewBasic returns a new initialised basic ACL allowed.
 func NewBasic() *Basic {
 	return &Basic{
-		lock:    new(sync.Mutex),
+		lock:    new(sync.RWMutex),
 		allowed: map[string]bool{},
 	}
 }
 
-// MarshalJSON serialises a host allowed to a comma-separated list of
-// hosts, implementing the json.Marshaler interface.
-func (acl *Basic) MarshalJSON() ([]byte, error) {
-	acl.lock.Lock()
-	defer acl.lock.Unlock()
-	var ss = make([]string, 0, len(acl.allowed))
-	for ip := range acl.allowed {
-		ss = append(ss, ip)
+// Count returns the number of addresses in the ACL, including
+// disabled addresses.
+func (acl *Basic) Count() int {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	return len(acl.allowed)
+}
+
+// List returns a copy of the addresses in the ACL, including
+// disabled addresses, sorted by address.
+func (acl *Basic) List() []net.IP {
+	acl.lock.RLock()
+	var ips = make([]net.IP, 0, len(acl.allowed))
+	for addr := range acl.allowed {
+		ips = append(ips, net.ParseIP(addr))
+	}
+	acl.lock.RUnlock()
+
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// Snapshot returns a copy of the addresses the ACL permits, sorted by
+// address. Unlike List, disabled addresses are left out. The
+// snapshot is a point-in-time copy taken under the lock: it can be
+// iterated without blocking writers, but won't reflect changes made
+// after it was taken.
+func (acl *Basic) Snapshot() []net.IP {
+	acl.lock.RLock()
+	var ips = make([]net.IP, 0, len(acl.allowed))
+	for addr, enabled := range acl.allowed {
+		if enabled {
+			ips = append(ips, net.ParseIP(addr))
+		}
+	}
+	acl.lock.RUnlock()
+
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// Approximate sizes used to estimate memory footprints. These are
+// for 64-bit platforms.
+const (
+	sizeofPointer     = 8
+	sizeofUint64      = 8
+	sizeofSlice       = 24
+	sizeofString      = 16
+	sizeofRWMutex     = 24
+	sizeofMapHeader   = 48
+	sizeofMapOverhead = 10 // per-entry share of bucket overhead
+)
+
+// SizeBytes returns an estimate of the memory used by the ACL, in
+// bytes. The estimate is approximate: it accounts for the stored
+// addresses and the map's per-entry overhead, but not for spare
+// capacity in the map or allocator rounding.
+func (acl *Basic) SizeBytes() int {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	size := 3*sizeofPointer + sizeofSlice + sizeofRWMutex + sizeofMapHeader + len(acl.single)
+	for addr := range acl.allowed {
+		size += sizeofString + len(addr) + 1 + sizeofMapOverhead
+	}
+
+	if acl.sources != nil {
+		size += sizeofMapHeader
 	}
+	for addr, tags := range acl.sources {
+		size += sizeofString + len(addr) + sizeofPointer + sizeofMapOverhead + sizeofMapHeader
+		for tag := range tags {
+			size += sizeofString + len(tag) + 1 + sizeofMapOverhead
+		}
+	}
+	return size
+}
 
-	out := []byte(`"` + strings.Join(ss, ",") + `"`)
+// MarshalJSON serialises a host allowed to a comma-separated list of
+// hosts, implementing the json.Marshaler interface. The hosts are
+// sorted, as in DumpBasic, so that the output is reproducible.
+func (acl *Basic) MarshalJSON() ([]byte, error) {
+	out := []byte(`"` + strings.Join(acl.entries(), ",") + `"`)
 	return out, nil
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for host
-// ACLs, taking a comma-separated string of hosts.
+// ACLs, taking either a comma-separated string of hosts or an array
+// of hosts. A JSON null is treated as an empty ACL.
 func (acl *Basic) UnmarshalJSON(in []byte) error {
-	if in[0] != '"' || in[len(in)-1] != '"' {
-		return errors.New("allowed: invalid allowed")
+	addrs, err := jsonEntries(in)
+	if err != nil {
+		return err
 	}
 
 	if acl.lock == nil {
-		acl.lock = new(sync.Mutex)
+		acl.lock = new(sync.RWMutex)
 	}
 
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
-
-	netString := strings.TrimSpace(string(in[1 : len(in)-1]))
-	nets := strings.Split(netString, ",")
+	defer acl.notifyReset()
+	defer acl.updateSingle()
 
 	acl.allowed = map[string]bool{}
-	for i := range nets {
-		addr := strings.TrimSpace(nets[i])
-		if addr == "" {
-			continue
-		}
-
-		ip := net.ParseIP(addr)
+	acl.sources = nil
+	for _, addr := range addrs {
+		ip, enabled := parseEntry(addr)
 		if ip == nil {
-			acl.allowed = nil
+			acl.allowed = map[string]bool{}
 			return errors.New("netallow: invalid IP address " + addr)
 		}
-		acl.allowed[addr] = true
+		acl.allowed[strings.TrimPrefix(addr, "!")] = enabled
 	}
 
 	return nil
 }
 
+// jsonEntries returns the entries in a serialised ACL, which is
+// either a comma-separated string or an array of strings. Blank
+// entries are skipped, and null has no entries.
+func jsonEntries(in []byte) ([]string, error) {
+	in = bytes.TrimSpace(in)
+	if string(in) == "null" {
+		return nil, nil
+	}
+
+	var entries []string
+	switch {
+	case len(in) > 0 && in[0] == '[':
+		if err := json.Unmarshal(in, &entries); err != nil {
+			return nil, err
+		}
+	case len(in) > 1 && in[0] == '"' && in[len(in)-1] == '"':
+		var list string
+		if err := json.Unmarshal(in, &list); err != nil {
+			return nil, err
+		}
+		entries = strings.Split(list, ",")
+	default:
+		return nil, errors.New("netallow: ACL must be a JSON string or array")
+	}
+
+	var kept = entries[:0]
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// MarshalJSONArray serialises an ACL to a JSON array of its entries,
+// in sorted order. This is easier to edit by hand than the
+// comma-separated string written by MarshalJSON, and is read by
+// UnmarshalJSON in the same way. The ACL must be able to list its
+// entries, as Basic, BasicNet, and TrieNet can.
+func MarshalJSONArray(acl ACL) ([]byte, error) {
+	lister, ok := acl.(entryLister)
+	if !ok {
+		return nil, errors.New("netallow: ACL can't be listed")
+	}
+
+	entries := lister.entries()
+	if entries == nil {
+		entries = []string{}
+	}
+	return json.Marshal(entries)
+}
+
 // DumpBasic returns a allowed as a byte slice where each IP is on
 // its own line.
 func DumpBasic(acl *Basic) []byte {
-	acl.lock.Lock()
-	defer acl.lock.Unlock()
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
 
 	var addrs = make([]string, 0, len(acl.allowed))
-	for ip := range acl.allowed {
-		addrs = append(addrs, ip)
+	for ip, enabled := range acl.allowed {
+		addrs = append(addrs, entryString(ip, enabled))
 	}
 
 	sort.Strings(addrs)
@@ -164,47 +686,91 @@ func DumpBasic(acl *Basic) []byte {
 	return []byte(addrList)
 }
 
-// LoadBasic loads a allowed from a byteslice.
+// LoadBasic loads a allowed from a byteslice. Surrounding whitespace
+// is ignored, as are blank lines and lines starting with '#'.
 func LoadBasic(in []byte) (*Basic, error) {
 	acl := NewBasic()
 	addrs := strings.Split(string(in), "\n")
 
 	for _, addr := range addrs {
-		ip := net.ParseIP(addr)
+		addr = strings.TrimSpace(addr)
+		if addr == "" || strings.HasPrefix(addr, "#") {
+			continue
+		}
+
+		ip, enabled := parseEntry(addr)
 		if ip == nil {
-			return nil, errors.New("netallow: invalid address")
+			return nil, errors.New("netallow: invalid address " + addr)
 		}
 		acl.Add(ip)
+		if !enabled {
+			acl.Disable(ip)
+		}
 	}
 	return acl, nil
 }
 
+// A Logger receives the warnings printed by the stub ACLs. A
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger writes to the log package's default logger.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// loggerOrDefault returns l, or the log package's default logger if
+// l is nil.
+func loggerOrDefault(l Logger) Logger {
+	if l == nil {
+		return stdLogger{}
+	}
+
+	if ll, ok := l.(*log.Logger); ok && ll == nil {
+		return stdLogger{}
+	}
+	return l
+}
+
 // HostStub allows host ACLs to be added into a system's flow
 // without doing anything yet. All operations result in warning log
-// messages being printed to stderr. There is no mechanism for
-// squelching these messages short of modifying the log package's
-// default logger.
-type HostStub struct{}
+// messages being printed to stderr, or to the Logger given to
+// NewHostStubWithLogger.
+type HostStub struct {
+	logger Logger
+}
 
 // Permitted always returns true, but prints a warning message alerting
 // that ACL checks are stubbed.
 func (hs HostStub) Permitted(ip net.IP) bool {
-	log.Printf("WARNING: netallow check for %s but the list is stubbed", ip)
+	loggerOrDefault(hs.logger).Printf("WARNING: netallow check for %s but the list is stubbed", ip)
 	return true
 }
 
 // Add prints a warning message about ACL checks being stubbed.
 func (hs HostStub) Add(ip net.IP) {
-	log.Printf("WARNING: netallow check for %s but the list is stubbed", ip)
+	loggerOrDefault(hs.logger).Printf("WARNING: netallow check for %s but the list is stubbed", ip)
 }
 
 // Remove prints a warning message about ACL checks being stubbed.
 func (hs HostStub) Remove(ip net.IP) {
-	log.Printf("WARNING: netallow check for %s but the list is stubbed", ip)
+	loggerOrDefault(hs.logger).Printf("WARNING: netallow check for %s but the list is stubbed", ip)
 }
 
 // NewHostStub returns a new stubbed host ACL.
 func NewHostStub() HostStub {
-	log.Println("WARNING: netallow ACL is being stubbed")
-	return HostStub{}
+	return NewHostStubWithLogger(nil)
+}
+
+// NewHostStubWithLogger returns a new stubbed host ACL that prints
+// its warnings to l. If l is nil, the log package's default logger
+// is used.
+func NewHostStubWithLogger(l Logger) HostStub {
+	hs := HostStub{logger: loggerOrDefault(l)}
+	hs.logger.Printf("WARNING: netallow ACL is being stubbed")
+	return hs
 }
@@ -6,10 +6,11 @@ package netallow
 
 import (
 	"errors"
-	"log"
+	"math"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // A NetACL stores a list of permitted IP networks.
@@ -30,18 +31,58 @@ type NetACL interface {
 // constructor functions. This particular implementation is
 // unoptimised and will not scale.
 type BasicNet struct {
-	lock    *sync.Mutex
+	gen     uint64 // accessed atomically; keep 64-bit aligned
+	lock    *sync.RWMutex
 	allowed []*net.IPNet
 }
 
+// changed records that the ACL has been modified; the caller must
+// hold the lock.
+func (acl *BasicNet) changed() {
+	atomic.AddUint64(&acl.gen, 1)
+}
+
+// generation returns a counter that changes whenever the ACL is
+// modified.
+func (acl *BasicNet) generation() uint64 {
+	return atomic.LoadUint64(&acl.gen)
+}
+
+// classify determines whether every address in n gets the same
+// decision. If uniform is true, permitted is the decision for all of
+// n; otherwise, some addresses in n are permitted and some are not.
+func (acl *BasicNet) classify(n *net.IPNet) (permitted, uniform bool) {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	uniform = true
+	for i := range acl.allowed {
+		if covers(acl.allowed[i], n) {
+			return true, true
+		}
+
+		if covers(n, acl.allowed[i]) {
+			uniform = false
+		}
+	}
+	return false, uniform
+}
+
 // Permitted returns true if the IP is permitted.
 func (acl *BasicNet) Permitted(ip net.IP) bool {
 	if !validIP(ip) { // see netallow.go for this function
 		return false
 	}
 
-	acl.lock.Lock()
-	defer acl.lock.Unlock()
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	return acl.permitted(ip)
+}
+
+// permitted checks a valid IP; the caller must hold the lock. Any
+// network containing the IP will do, so it stops at the first one
+// rather than looking for the most specific, as match does.
+func (acl *BasicNet) permitted(ip net.IP) bool {
 	for i := range acl.allowed {
 		if acl.allowed[i].Contains(ip) {
 			return true
@@ -50,29 +91,279 @@ func (acl *BasicNet) Permitted(ip net.IP) bool {
 	return false
 }
 
-// BUG(kyle): overlapping networks aren't detected.
+// PermittedAny returns true if any of the IPs is permitted. The lock
+// is only taken once for the whole batch.
+func (acl *BasicNet) PermittedAny(ips []net.IP) bool {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for _, ip := range ips {
+		if validIP(ip) && acl.permitted(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermittedAll returns true if every one of the IPs is permitted. An
+// empty batch is not permitted.
+func (acl *BasicNet) PermittedAll(ips []net.IP) bool {
+	if len(ips) == 0 {
+		return false
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for _, ip := range ips {
+		if !validIP(ip) || !acl.permitted(ip) {
+			return false
+		}
+	}
+	return true
+}
 
-// Add adds a new network to the ACL. Caveat: overlapping
-// networks won't be detected.
+// MatchRule returns true and the most specific network containing
+// the IP if the IP is permitted. Add doesn't keep networks covered by
+// another, but overlapping networks can still be loaded, such as from
+// an older gob dump; the longest prefix is reported so that the
+// result doesn't depend on the order the networks are stored in.
+func (acl *BasicNet) MatchRule(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	if n := acl.match(ip); n != nil {
+		return n.String(), true
+	}
+	return "", false
+}
+
+// Explain returns true and the network that permits the IP, if any.
+// When more than one network contains the IP, the most specific one,
+// with the longest prefix, is returned. The network is a copy that
+// the caller may modify.
+func (acl *BasicNet) Explain(ip net.IP) (bool, *net.IPNet) {
+	if !validIP(ip) {
+		return false, nil
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	n := acl.match(ip)
+	if n == nil {
+		return false, nil
+	}
+
+	return true, &net.IPNet{
+		IP:   append(net.IP(nil), n.IP...),
+		Mask: append(net.IPMask(nil), n.Mask...),
+	}
+}
+
+// match returns the most specific network containing a valid IP, or
+// nil if none does; the caller must hold the lock.
+func (acl *BasicNet) match(ip net.IP) *net.IPNet {
+	var best *net.IPNet
+	var bestOnes int
+	for _, n := range acl.allowed {
+		if n == nil || !n.Contains(ip) {
+			continue
+		}
+
+		if ones, _ := n.Mask.Size(); best == nil || ones > bestOnes {
+			best, bestOnes = n, ones
+		}
+	}
+	return best
+}
+
+// CoverageOf returns the fraction of the addresses in n that are
+// permitted by the ACL, from 0 (none) to 1 (all of them).
+func (acl *BasicNet) CoverageOf(n *net.IPNet) float64 {
+	_, ones, bits := prefixOf(n)
+	if bits == 0 {
+		return 0
+	}
+
+	acl.lock.RLock()
+	var inside []*net.IPNet
+	for i := range acl.allowed {
+		if covers(acl.allowed[i], n) {
+			acl.lock.RUnlock()
+			return 1
+		}
+
+		if covers(n, acl.allowed[i]) {
+			inside = append(inside, acl.allowed[i])
+		}
+	}
+	acl.lock.RUnlock()
+
+	// Each network inside n covers 2^-(its prefix length - n's
+	// prefix length) of n. Working with fractions rather than
+	// address counts avoids overflowing on IPv6 networks.
+	var coverage float64
+	for _, sub := range dropCovered(inside) {
+		subOnes, _ := sub.Mask.Size()
+		coverage += math.Ldexp(1, ones-subOnes)
+	}
+	return coverage
+}
+
+// SizeBytes returns an estimate of the memory used by the ACL, in
+// bytes. Like Basic.SizeBytes, this is approximate.
+func (acl *BasicNet) SizeBytes() int {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	size := sizeofUint64 + 2*sizeofPointer + sizeofRWMutex + sizeofSlice
+	size += cap(acl.allowed) * sizeofPointer
+	for _, n := range acl.allowed {
+		if n != nil {
+			size += 2*sizeofSlice + len(n.IP) + len(n.Mask)
+		}
+	}
+	return size
+}
+
+// Add adds a new network to the ACL. If the network is already
+// covered by an entry, it isn't added; if it covers existing
+// entries, they are replaced by it. Because of this, removing a
+// network also removes access for any narrower networks that were
+// added after it.
+//
+// The ACL stores the network address rather than the address it was
+// given: adding 10.0.0.5/24 stores 10.0.0.0/24, which can be removed
+// as either. Networks with non-contiguous masks are ignored.
 func (acl *BasicNet) Add(n *net.IPNet) {
+	n = canonicalNet(n)
 	if n == nil {
 		return
 	}
 
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
-	acl.allowed = append(acl.allowed, n)
+	acl.add(n)
+}
+
+// add adds a canonical network to the ACL; the caller must hold the
+// lock.
+func (acl *BasicNet) add(n *net.IPNet) {
+	for _, existing := range acl.allowed {
+		if covers(existing, n) {
+			return
+		}
+	}
+
+	kept := acl.allowed[:0]
+	for _, existing := range acl.allowed {
+		if !covers(n, existing) {
+			kept = append(kept, existing)
+		}
+	}
+
+	for i := len(kept); i < len(acl.allowed); i++ {
+		acl.allowed[i] = nil
+	}
+	acl.allowed = append(kept, n)
+	acl.changed()
 }
 
-// Remove removes a network from the ACL.
+// AddMany adds each of the networks to the ACL, as Add does, taking
+// the lock once for the whole batch. Invalid networks are skipped.
+func (acl *BasicNet) AddMany(nets []*net.IPNet) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, n := range nets {
+		if n = canonicalNet(n); n != nil {
+			acl.add(n)
+		}
+	}
+}
+
+// RemoveMany removes each of the networks from the ACL, as Remove
+// does, taking the lock once for the whole batch.
+func (acl *BasicNet) RemoveMany(nets []*net.IPNet) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, n := range nets {
+		if n = canonicalNet(n); n != nil {
+			acl.remove(n)
+		}
+	}
+}
+
+// Contains returns true if every address in n is permitted by a
+// single entry in the ACL.
+func (acl *BasicNet) Contains(n *net.IPNet) bool {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for _, existing := range acl.allowed {
+		if covers(existing, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of networks in the ACL.
+func (acl *BasicNet) Count() int {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	var count int
+	for _, n := range acl.allowed {
+		if n != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// List returns a copy of the networks in the ACL, sorted with the
+// IPv4 networks first and then by address and prefix length.
+func (acl *BasicNet) List() []*net.IPNet {
+	acl.lock.RLock()
+	var nets = make([]*net.IPNet, 0, len(acl.allowed))
+	for _, n := range acl.allowed {
+		if n != nil {
+			nets = append(nets, &net.IPNet{
+				IP:   append(net.IP(nil), n.IP...),
+				Mask: append(net.IPMask(nil), n.Mask...),
+			})
+		}
+	}
+	acl.lock.RUnlock()
+
+	sortNets(nets)
+	return nets
+}
+
+// Snapshot returns a point-in-time copy of the networks in the ACL,
+// in the same order as List. It can be iterated without blocking
+// writers, but won't reflect changes made after it was taken.
+func (acl *BasicNet) Snapshot() []*net.IPNet {
+	return acl.List()
+}
+
+// Remove removes a network from the ACL. Any host bits set in the
+// network's address are ignored, as they are by Add.
 func (acl *BasicNet) Remove(n *net.IPNet) {
+	n = canonicalNet(n)
 	if n == nil {
 		return
 	}
 
-	index := -1
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
+	acl.remove(n)
+}
+
+// remove removes a network from the ACL, returning false if it
+// wasn't there. The caller must hold the lock.
+func (acl *BasicNet) remove(n *net.IPNet) bool {
+	index := -1
 	for i := range acl.allowed {
 		if acl.allowed[i].String() == n.String() {
 			index = i
@@ -81,59 +372,131 @@ func (acl *BasicNet) Remove(n *net.IPNet) {
 	}
 
 	if index == -1 {
-		return
+		return false
 	}
 
 	acl.allowed = append(acl.allowed[:index], acl.allowed[index+1:]...)
+	acl.changed()
+	return true
+}
+
+// ErrNetworkNotFound is returned by RemoveCIDR when the network isn't
+// in the ACL.
+var ErrNetworkNotFound = errors.New("netallow: network not found in ACL")
+
+// AddCIDR parses a network in CIDR notation and adds it to the ACL,
+// as Add does. A bare IP address is added as a single-host network.
+func (acl *BasicNet) AddCIDR(cidr string) error {
+	n, err := parseNet(strings.TrimSpace(cidr))
+	if err != nil {
+		return err
+	}
+
+	acl.Add(n)
+	return nil
+}
+
+// RemoveCIDR parses a network in CIDR notation and removes it from
+// the ACL, as Remove does. It returns ErrNetworkNotFound if the
+// network isn't in the ACL.
+func (acl *BasicNet) RemoveCIDR(cidr string) error {
+	n, err := parseNet(strings.TrimSpace(cidr))
+	if err != nil {
+		return err
+	}
+	n = canonicalNet(n)
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	if !acl.remove(n) {
+		return ErrNetworkNotFound
+	}
+	return nil
+}
+
+// Clear removes every network from the ACL at once.
+func (acl *BasicNet) Clear() {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed = nil
+	acl.changed()
+}
+
+// hostNet returns the single-host network containing only ip.
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// parseNet parses a network in CIDR notation; a bare IP address is
+// treated as a single-host network.
+func parseNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("netallow: invalid address " + s)
+	}
+	return hostNet(ip), nil
+}
+
+// String returns a summary of the ACL for debugging, listing the
+// first few networks in sorted order.
+func (acl *BasicNet) String() string {
+	return describeEntries("BasicNet", "network", acl.entries())
 }
 
 // NewBasicNet constructs a new basic network-based ACL.
 func NewBasicNet() *BasicNet {
 	return &BasicNet{
-		lock: new(sync.Mutex),
+		lock: new(sync.RWMutex),
 	}
 }
 
 // MarshalJSON serialises a network allowed to a comma-separated
-// list of networks.
+// list of networks. The networks are sorted so that the output is
+// reproducible.
 func (acl *BasicNet) MarshalJSON() ([]byte, error) {
-	var ss = make([]string, 0, len(acl.allowed))
-	for i := range acl.allowed {
-		ss = append(ss, acl.allowed[i].String())
-	}
-
-	out := []byte(`"` + strings.Join(ss, ",") + `"`)
+	out := []byte(`"` + strings.Join(acl.entries(), ",") + `"`)
 	return out, nil
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for network
-// ACLs, taking a comma-separated string of networks.
+// ACLs, taking either a comma-separated string of networks or an
+// array of networks. Bare IP addresses are treated as single-host
+// networks. A JSON null is treated as an empty ACL. As with Add,
+// networks are stored by their network address, and duplicate or
+// covered networks are dropped, however they are written.
 func (acl *BasicNet) UnmarshalJSON(in []byte) error {
-	if in[0] != '"' || in[len(in)-1] != '"' {
-		return errors.New("allowed: invalid allowed")
+	entries, err := jsonEntries(in)
+	if err != nil {
+		return err
 	}
 
 	if acl.lock == nil {
-		acl.lock = new(sync.Mutex)
+		acl.lock = new(sync.RWMutex)
 	}
 
 	acl.lock.Lock()
 	defer acl.lock.Unlock()
+	defer acl.changed()
 
-	var err error
-	netString := strings.TrimSpace(string(in[1 : len(in)-1]))
-	nets := strings.Split(netString, ",")
-	acl.allowed = make([]*net.IPNet, len(nets))
-	for i := range nets {
-		addr := strings.TrimSpace(nets[i])
-		if addr == "" {
-			continue
-		}
-		_, acl.allowed[i], err = net.ParseCIDR(addr)
+	acl.allowed = nil
+	for _, entry := range entries {
+		n, err := parseNet(entry)
 		if err != nil {
 			acl.allowed = nil
 			return err
 		}
+
+		if n = canonicalNet(n); n != nil {
+			acl.add(n)
+		}
 	}
 
 	return nil
@@ -141,30 +504,39 @@ func (acl *BasicNet) UnmarshalJSON(in []byte) error {
 
 // NetStub allows network ACLs to be added into a system's
 // flow without doing anything yet. All operations result in warning
-// log messages being printed to stderr. There is no mechanism for
-// squelching these messages short of modifying the log package's
-// default logger.
-type NetStub struct{}
+// log messages being printed to stderr, or to the Logger given to
+// NewNetStubWithLogger.
+type NetStub struct {
+	logger Logger
+}
 
 // Permitted always returns true, but prints a warning message alerting
 // that ACL checks are stubbed.
 func (acl NetStub) Permitted(ip net.IP) bool {
-	log.Printf("WARNING: allowed check for %s but ACL is stubbed", ip)
+	loggerOrDefault(acl.logger).Printf("WARNING: allowed check for %s but ACL is stubbed", ip)
 	return true
 }
 
 // Add prints a warning message about ACL being stubbed.
 func (acl NetStub) Add(ip *net.IPNet) {
-	log.Printf("WARNING: IP network %s added to allowed but ACL is stubbed", ip)
+	loggerOrDefault(acl.logger).Printf("WARNING: IP network %s added to allowed but ACL is stubbed", ip)
 }
 
 // Remove prints a warning message about ACL being stubbed.
 func (acl NetStub) Remove(ip *net.IPNet) {
-	log.Printf("WARNING: IP network %s removed from allowed but ACL is stubbed", ip)
+	loggerOrDefault(acl.logger).Printf("WARNING: IP network %s removed from allowed but ACL is stubbed", ip)
 }
 
 // NewNetStub returns a new stubbed network ACL.
 func NewNetStub() NetStub {
-	log.Println("WARNING: ACL is being stubbed")
-	return NetStub{}
+	return NewNetStubWithLogger(nil)
+}
+
+// NewNetStubWithLogger returns a new stubbed network ACL that prints
+// its warnings to l. If l is nil, the log package's default logger
+// is used.
+func NewNetStubWithLogger(l Logger) NetStub {
+	acl := NetStub{logger: loggerOrDefault(l)}
+	acl.logger.Printf("WARNING: ACL is being stubbed")
+	return acl
 }
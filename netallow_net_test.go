@@ -2,7 +2,10 @@ package netallow
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -49,6 +52,83 @@ func TestMarshalNetFail(t *testing.T) {
 	}
 }
 
+func TestMarshalNetSorted(t *testing.T) {
+	acl := NewBasicNet()
+	for _, n := range []string{"192.168.7.0/24", "10.0.0.0/8", "2001:db8::/32", "192.168.3.0/24"} {
+		testAddNet(acl, n, t)
+	}
+
+	first, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	second, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(first) != string(second) {
+		t.Fatalf("marshaled output isn't reproducible: %s != %s", first, second)
+	}
+
+	expected := `"10.0.0.0/8,192.168.3.0/24,192.168.7.0/24,2001:db8::/32"`
+	if string(first) != expected {
+		t.Fatalf("expected %s, but have %s", expected, first)
+	}
+}
+
+func TestUnmarshalNetEmpty(t *testing.T) {
+	for _, in := range []string{"", `"`, "1"} {
+		acl := NewBasicNet()
+		if err := acl.UnmarshalJSON([]byte(in)); err == nil {
+			t.Fatalf("Expected failure unmarshaling %q.", in)
+		}
+	}
+
+	for _, in := range []string{`""`, "null", `" , "`} {
+		acl := NewBasicNet()
+		testAddNet(acl, "192.168.3.0/24", t)
+		if err := acl.UnmarshalJSON([]byte(in)); err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+
+		if acl.Count() != 0 || len(acl.allowed) != 0 {
+			t.Fatalf("%q: expected an empty ACL", in)
+		}
+
+		if checkIPString(acl, "192.168.3.1", t) {
+			t.Fatalf("%q: empty ACL shouldn't permit anything", in)
+		}
+	}
+}
+
+func TestUnmarshalNetArray(t *testing.T) {
+	for _, in := range []string{
+		`["127.0.0.1", "10.0.0.0/8", "2001:db8::/32"]`,
+		`"127.0.0.1/32,10.0.0.0/8,2001:db8::/32"`,
+	} {
+		acl := NewBasicNet()
+		if err := acl.UnmarshalJSON([]byte(in)); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+
+		out, err := MarshalJSONArray(acl)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		expected := `["10.0.0.0/8","127.0.0.1/32","2001:db8::/32"]`
+		if string(out) != expected {
+			t.Fatalf("%s: expected %s, but have %s", in, expected, out)
+		}
+	}
+
+	if err := NewBasicNet().UnmarshalJSON([]byte(`["10.0.0.0/33"]`)); err == nil {
+		t.Fatal("Expected failure unmarshaling bad JSON input.")
+	}
+}
+
 var testNet *BasicNet
 
 func testAddNet(acl NetACL, ns string, t *testing.T) {
@@ -90,3 +170,428 @@ func TestFailPermitted(t *testing.T) {
 		t.Fatal("Expected failure checking invalid IP address.")
 	}
 }
+
+func TestCoverageOf(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "192.168.1.0/25", t)
+	testAddNet(acl, "192.168.1.0/26", t)
+	testAddNet(acl, "192.168.1.192/26", t)
+	testAddNet(acl, "2001:db8::/33", t)
+
+	tv := map[string]float64{
+		"10.1.0.0/16":    1,
+		"10.0.0.0/8":     1,
+		"192.168.1.0/24": 0.75,
+		"192.168.1.0/25": 1,
+		"192.168.0.0/16": 0.75 / 256,
+		"172.16.0.0/12":  0,
+		"2001:db8::/32":  0.5,
+		"2001:db9::/32":  0,
+		"::/0":           math.Ldexp(1, -33),
+	}
+
+	for cidr, expected := range tv {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if coverage := acl.CoverageOf(n); coverage != expected {
+			t.Fatalf("expected coverage of %s to be %v, but have %v",
+				cidr, expected, coverage)
+		}
+	}
+
+	if acl.CoverageOf(nil) != 0 {
+		t.Fatal("expected no coverage of a nil network")
+	}
+}
+
+func TestBasicNetSizeBytes(t *testing.T) {
+	acl := NewBasicNet()
+	size := acl.SizeBytes()
+	for _, cidr := range []string{"127.0.0.0/8", "10.0.0.0/8", "2001:db8::/32"} {
+		testAddNet(acl, cidr, t)
+		next := acl.SizeBytes()
+		if next <= size {
+			t.Fatalf("expected size to grow after adding %s, but have %d after %d", cidr, next, size)
+		}
+		size = next
+	}
+}
+
+func TestBasicNetOverlaps(t *testing.T) {
+	tv := []struct {
+		name     string
+		add      []string
+		expected []string
+	}{
+		{"duplicate v4", []string{"10.0.0.0/8", "10.0.0.0/8"}, []string{"10.0.0.0/8"}},
+		{"subnet v4", []string{"10.0.0.0/8", "10.1.0.0/16"}, []string{"10.0.0.0/8"}},
+		{"superset v4", []string{"10.1.0.0/16", "192.168.0.0/16", "10.2.3.0/24", "10.0.0.0/8"},
+			[]string{"192.168.0.0/16", "10.0.0.0/8"}},
+		{"duplicate v6", []string{"2001:db8::/32", "2001:db8::/32"}, []string{"2001:db8::/32"}},
+		{"subnet v6", []string{"2001:db8::/32", "2001:db8:1::/48"}, []string{"2001:db8::/32"}},
+		{"superset v6", []string{"2001:db8:1::/48", "2001:db8:2::/48", "2001:db8::/32"},
+			[]string{"2001:db8::/32"}},
+		{"families", []string{"0.0.0.0/0", "::/0", "10.0.0.0/8"}, []string{"0.0.0.0/0", "::/0"}},
+	}
+
+	for _, tc := range tv {
+		acl := NewBasicNet()
+		for _, n := range tc.add {
+			testAddNet(acl, n, t)
+		}
+
+		nets := testNetList(acl)
+		if len(nets) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, but have %v", tc.name, tc.expected, nets)
+		}
+
+		for i := range nets {
+			if nets[i] != tc.expected[i] {
+				t.Fatalf("%s: expected %v, but have %v", tc.name, tc.expected, nets)
+			}
+		}
+	}
+}
+
+func TestBasicNetContains(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "2001:db8::/32", t)
+
+	for n, expected := range map[string]bool{
+		"10.0.0.0/8":          true,
+		"10.1.0.0/16":         true,
+		"10.1.2.3/32":         true,
+		"0.0.0.0/0":           false,
+		"11.0.0.0/8":          false,
+		"2001:db8:1::/48":     true,
+		"2001:db8::/31":       false,
+		"::ffff:10.0.0.0/104": false,
+	} {
+		if acl.Contains(mustParseNet(t, n)) != expected {
+			t.Fatalf("expected Contains(%s) to be %v", n, expected)
+		}
+	}
+
+	if acl.Contains(nil) {
+		t.Fatal("Contains should be false for a nil network")
+	}
+}
+
+func TestBasicNetCountList(t *testing.T) {
+	acl := NewBasicNet()
+	if acl.Count() != 0 || len(acl.List()) != 0 {
+		t.Fatal("expected an empty ACL")
+	}
+
+	testAddNet(acl, "2001:db8::/32", t)
+	testAddNet(acl, "192.168.0.0/16", t)
+	testAddNet(acl, "10.0.0.0/8", t)
+	if acl.Count() != 3 {
+		t.Fatalf("expected 3 networks, but have %d", acl.Count())
+	}
+
+	nets := acl.List()
+	var have []string
+	for _, n := range nets {
+		have = append(have, n.String())
+	}
+	expected := []string{"10.0.0.0/8", "192.168.0.0/16", "2001:db8::/32"}
+	if strings.Join(have, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, but have %v", expected, have)
+	}
+
+	// Modifying the returned networks mustn't change the ACL.
+	nets[0].IP[0] = 11
+	if !checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("List should return copies of the networks")
+	}
+}
+
+func TestBasicNetClear(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "2001:db8::/32", t)
+	gen := acl.generation()
+
+	acl.Clear()
+	if checkIPString(acl, "10.0.0.1", t) || checkIPString(acl, "2001:db8::1", t) {
+		t.Fatal("cleared ACL shouldn't permit anything")
+	}
+
+	if acl.Count() != 0 || acl.generation() == gen {
+		t.Fatal("expected an empty, changed ACL")
+	}
+}
+
+func TestBasicNetCIDR(t *testing.T) {
+	acl := NewBasicNet()
+	for _, cidr := range []string{"10.0.0.0/8", " 2001:db8::/32", "192.0.2.1"} {
+		if err := acl.AddCIDR(cidr); err != nil {
+			t.Fatalf("%s: %v", cidr, err)
+		}
+	}
+
+	if !checkIPString(acl, "10.1.2.3", t) || !checkIPString(acl, "2001:db8::1", t) ||
+		!checkIPString(acl, "192.0.2.1", t) || checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("networks weren't added")
+	}
+
+	for _, cidr := range []string{"", "10.0.0.0/33", "10.0.0.0/", "example.com/8", "999.0.0.0/8"} {
+		if err := acl.AddCIDR(cidr); err == nil {
+			t.Fatalf("AddCIDR should reject %q", cidr)
+		}
+
+		if err := acl.RemoveCIDR(cidr); err == nil || err == ErrNetworkNotFound {
+			t.Fatalf("RemoveCIDR should fail to parse %q, but have %v", cidr, err)
+		}
+	}
+
+	if err := acl.RemoveCIDR("10.0.0.0/8"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if checkIPString(acl, "10.1.2.3", t) {
+		t.Fatal("network should have been removed")
+	}
+
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "2001:db8::/48"} {
+		if err := acl.RemoveCIDR(cidr); err != ErrNetworkNotFound {
+			t.Fatalf("%s: expected ErrNetworkNotFound, but have %v", cidr, err)
+		}
+	}
+
+	if err := acl.RemoveCIDR("192.0.2.1/32"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.Count() != 1 {
+		t.Fatalf("expected one network left, but have %d", acl.Count())
+	}
+}
+
+func TestBasicNetCanonical(t *testing.T) {
+	acl := NewBasicNet()
+	acl.Add(&net.IPNet{IP: net.IP{10, 0, 0, 5}, Mask: net.CIDRMask(24, 32)})
+	acl.Add(&net.IPNet{IP: net.ParseIP("2001:db8::5"), Mask: net.CIDRMask(64, 128)})
+	if err := acl.AddCIDR("192.0.2.77/28"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	nets := testNetList(acl)
+	expected := []string{"10.0.0.0/24", "2001:db8::/64", "192.0.2.64/28"}
+	if strings.Join(nets, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, but have %v", expected, nets)
+	}
+
+	if !checkIPString(acl, "10.0.0.200", t) {
+		t.Fatal("the whole network should be permitted")
+	}
+
+	// Networks can be removed with or without host bits.
+	testDelNet(acl, "10.0.0.0/24", t)
+	acl.Remove(&net.IPNet{IP: net.ParseIP("2001:db8::9"), Mask: net.CIDRMask(64, 128)})
+	if err := acl.RemoveCIDR("192.0.2.64/28"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.Count() != 0 {
+		t.Fatalf("expected every network to be removed, but have %v", testNetList(acl))
+	}
+
+	acl.Add(&net.IPNet{IP: net.ParseIP("192.0.2.1").To16(), Mask: net.CIDRMask(24, 32)})
+	if err := acl.RemoveCIDR("192.0.2.1/24"); err != nil {
+		t.Fatalf("16-byte IPv4 address should be stored as 4 bytes: %v", err)
+	}
+
+	acl.Add(&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}})
+	if acl.Count() != 0 {
+		t.Fatal("a network with a non-contiguous mask shouldn't be added")
+	}
+}
+
+func TestBasicNetMany(t *testing.T) {
+	acl := NewBasicNet()
+	acl.AddMany([]*net.IPNet{
+		mustParseNet(t, "10.1.0.0/16"),
+		mustParseNet(t, "10.0.0.0/8"),
+		nil,
+		{IP: net.IP{192, 0, 2, 9}, Mask: net.CIDRMask(24, 32)},
+		mustParseNet(t, "2001:db8::/32"),
+	})
+
+	nets := testNetList(acl)
+	expected := []string{"10.0.0.0/8", "192.0.2.0/24", "2001:db8::/32"}
+	if strings.Join(nets, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, but have %v", expected, nets)
+	}
+
+	acl.RemoveMany([]*net.IPNet{mustParseNet(t, "10.0.0.0/8"), nil, mustParseNet(t, "192.0.2.0/24")})
+	if acl.Count() != 1 || !checkIPString(acl, "2001:db8::1", t) {
+		t.Fatalf("expected only 2001:db8::/32 to be left, but have %v", testNetList(acl))
+	}
+}
+
+func TestBasicNetString(t *testing.T) {
+	acl := NewBasicNet()
+	if s := acl.String(); s != "BasicNet{0 networks}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+
+	testAddNet(acl, "2001:db8::/32", t)
+	if s := acl.String(); s != "BasicNet{1 network: 2001:db8::/32}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+
+	testAddNet(acl, "10.0.0.0/8", t)
+	if s := fmt.Sprint(acl); s != "BasicNet{2 networks: 10.0.0.0/8, 2001:db8::/32}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+}
+
+// BenchmarkBasicNetParallel checks a 100-entry ACL from many
+// goroutines at once.
+func BenchmarkBasicNetParallel(b *testing.B) {
+	acl := NewBasicNet()
+	for i := 0; i < 100; i++ {
+		acl.Add(&net.IPNet{IP: net.IPv4(10, byte(i), 0, 0).To4(), Mask: net.CIDRMask(16, 32)})
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		ip := net.IP{10, 99, 0, 1}
+		for pb.Next() {
+			if !acl.Permitted(ip) {
+				b.Fatal("address should have been permitted")
+			}
+		}
+	})
+}
+
+func TestBasicNetExplain(t *testing.T) {
+	// Add drops networks covered by another, so overlapping entries
+	// can only come from elsewhere, such as an old gob dump.
+	acl := NewBasicNet()
+	acl.allowed = []*net.IPNet{
+		mustParseNet(t, "10.0.0.0/8"),
+		mustParseNet(t, "10.1.2.0/24"),
+		mustParseNet(t, "10.1.0.0/16"),
+	}
+
+	for addr, expected := range map[string]string{
+		"10.1.2.3":   "10.1.2.0/24",
+		"10.1.3.3":   "10.1.0.0/16",
+		"10.2.0.1":   "10.0.0.0/8",
+		"192.0.2.1":  "",
+		"2001:db8::": "",
+	} {
+		permitted, n := acl.Explain(mustParseIP(t, addr))
+		if permitted != (expected != "") {
+			t.Fatalf("expected Explain(%s) to be %v", addr, expected != "")
+		}
+
+		if expected == "" {
+			if n != nil {
+				t.Fatalf("expected no network for %s, have %s", addr, n)
+			}
+			continue
+		}
+
+		if n.String() != expected {
+			t.Fatalf("expected %s to match %s, have %s", addr, expected, n)
+		}
+	}
+
+	if permitted, n := acl.Explain(nil); permitted || n != nil {
+		t.Fatal("an invalid IP shouldn't match")
+	}
+
+	// The returned network is a copy.
+	_, n := acl.Explain(mustParseIP(t, "10.1.2.3"))
+	n.IP[0] = 192
+	if _, n = acl.Explain(mustParseIP(t, "10.1.2.3")); n.String() != "10.1.2.0/24" {
+		t.Fatalf("modifying the result changed the ACL: %s", n)
+	}
+}
+
+func TestBasicNetMatchRuleSpecific(t *testing.T) {
+	wide := mustParseNet(t, "10.0.0.0/8")
+	narrow := mustParseNet(t, "10.1.2.0/24")
+	ip := mustParseIP(t, "10.1.2.3")
+
+	// The result shouldn't depend on the order of the entries.
+	for _, nets := range [][]*net.IPNet{
+		{wide, narrow},
+		{narrow, wide},
+	} {
+		acl := NewBasicNet()
+		acl.allowed = nets
+
+		rule, permitted := acl.MatchRule(ip)
+		if !permitted || rule != "10.1.2.0/24" {
+			t.Fatalf("expected 10.1.2.0/24 to be chosen over 10.0.0.0/8, have %q", rule)
+		}
+
+		if rule, _ = acl.MatchRule(mustParseIP(t, "10.9.9.9")); rule != "10.0.0.0/8" {
+			t.Fatalf("expected 10.0.0.0/8 outside the /24, have %q", rule)
+		}
+	}
+}
+
+func TestBasicNetIPv6Spellings(t *testing.T) {
+	spellings := []string{
+		"2001:db8::/32",
+		"2001:0db8:0000::/32",
+		"2001:DB8:0:0:0:0:0:0/32",
+		"2001:0DB8::0/32",
+		"2001:db8:ffff::1/32",
+	}
+
+	acl := NewBasicNet()
+	for _, cidr := range spellings {
+		if err := acl.AddCIDR(cidr); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	// A narrower network, however it is written, is covered.
+	if err := acl.AddCIDR("2001:0DB8:0001:0000::/48"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if nets := testNetList(acl); len(nets) != 1 || nets[0] != "2001:db8::/32" {
+		t.Fatalf("expected a single 2001:db8::/32, but have %v", nets)
+	}
+
+	// Any spelling removes the network.
+	for _, cidr := range spellings {
+		if err := acl.AddCIDR("2001:db8::/32"); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if err := acl.RemoveCIDR(cidr); err != nil {
+			t.Fatalf("removing %s: %v", cidr, err)
+		}
+
+		if acl.Count() != 0 {
+			t.Fatalf("expected %s to remove the network, but have %v", cidr, testNetList(acl))
+		}
+	}
+
+	// The same goes for networks loaded from JSON.
+	out, err := json.Marshal(spellings)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = acl.UnmarshalJSON(out); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if nets := testNetList(acl); len(nets) != 1 || nets[0] != "2001:db8::/32" {
+		t.Fatalf("expected a single 2001:db8::/32, but have %v", nets)
+	}
+}
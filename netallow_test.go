@@ -2,11 +2,16 @@ package netallow
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -35,6 +40,22 @@ func (lu StringLookup) Address(args ...interface{}) (net.IP, error) {
 
 var slu StringLookup
 
+func mustParseIP(t *testing.T, addr string) net.IP {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		t.Fatalf("invalid address %s", addr)
+	}
+	return ip
+}
+
+func mustParseNet(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return n
+}
+
 func checkIPString(acl ACL, addr string, t *testing.T) bool {
 	ip, err := slu.Address(addr)
 	if err != nil {
@@ -148,13 +169,135 @@ func TestMarshalHostFail(t *testing.T) {
 	}
 }
 
+func TestMarshalHostSorted(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{"192.168.3.2", "10.0.0.1", "2001:db8::1", "192.168.3.1"} {
+		addIPString(acl, addr, t)
+	}
+
+	first, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	second, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Fatalf("marshaled output isn't reproducible: %s != %s", first, second)
+	}
+
+	expected := `"10.0.0.1,192.168.3.1,192.168.3.2,2001:db8::1"`
+	if string(first) != expected {
+		t.Fatalf("expected %s, but have %s", expected, first)
+	}
+}
+
+func TestUnmarshalHostEmpty(t *testing.T) {
+	for _, in := range []string{"", `"`, "1"} {
+		acl := NewBasic()
+		if err := acl.UnmarshalJSON([]byte(in)); err == nil {
+			t.Fatalf("Expected failure unmarshaling %q.", in)
+		}
+	}
+
+	for _, in := range []string{`""`, "null"} {
+		acl := NewBasic()
+		addIPString(acl, "192.168.3.1", t)
+		if err := acl.UnmarshalJSON([]byte(in)); err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+
+		if acl.Count() != 0 {
+			t.Fatalf("%q: expected an empty ACL", in)
+		}
+
+		// The ACL must still be usable.
+		addIPString(acl, "192.168.3.2", t)
+		if !checkIPString(acl, "192.168.3.2", t) {
+			t.Fatalf("%q: ACL should permit an address added after unmarshaling", in)
+		}
+	}
+
+	var cfg struct {
+		ACL Basic `json:"acl"`
+	}
+	if err := json.Unmarshal([]byte(`{"acl": null}`), &cfg); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if cfg.ACL.Count() != 0 {
+		t.Fatal("expected an empty ACL")
+	}
+}
+
+func TestUnmarshalHostArray(t *testing.T) {
+	for _, in := range []string{
+		`["192.168.3.1", " 2001:db8::1", "!192.168.3.2", ""]`,
+		` "192.168.3.1,2001:db8::1, !192.168.3.2" `,
+	} {
+		acl := NewBasic()
+		if err := acl.UnmarshalJSON([]byte(in)); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+
+		expected := "!192.168.3.2\n192.168.3.1\n2001:db8::1"
+		if out := string(DumpBasic(acl)); out != expected {
+			t.Fatalf("%s: expected\n%s\nbut have\n%s", in, expected, out)
+		}
+	}
+
+	for _, in := range []string{`["192.168.3.1", 4]`, `["192.168.3.256"]`, `["192.168.3.1"`} {
+		if err := NewBasic().UnmarshalJSON([]byte(in)); err == nil {
+			t.Fatalf("Expected failure unmarshaling %s.", in)
+		}
+	}
+}
+
+func TestMarshalJSONArray(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.168.3.2", t)
+	addIPString(acl, "192.168.3.1", t)
+
+	out, err := MarshalJSONArray(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := `["192.168.3.1","192.168.3.2"]`
+	if string(out) != expected {
+		t.Fatalf("expected %s, but have %s", expected, out)
+	}
+
+	var acl2 Basic
+	if err = json.Unmarshal(out, &acl2); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(DumpBasic(&acl2), DumpBasic(acl)) {
+		t.Fatal("array didn't round trip")
+	}
+
+	if out, err = MarshalJSONArray(NewBasic()); err != nil || string(out) != "[]" {
+		t.Fatalf("expected an empty array, but have %s (%v)", out, err)
+	}
+
+	if _, err = MarshalJSONArray(NewHostStub()); err == nil {
+		t.Fatal("MarshalJSONArray should fail on an ACL that can't be listed")
+	}
+}
+
 var shutdown = make(chan struct{}, 1)
 var proceed = make(chan struct{}, 0)
 
 func setupTestServer(t *testing.T, acl ACL) {
 	ln, err := net.Listen("tcp", "127.0.0.1:4141")
 	if err != nil {
-		t.Fatalf("%v", err)
+		t.Errorf("%v", err)
+		close(proceed)
+		return
 	}
 	proceed <- struct{}{}
 	for {
@@ -166,7 +309,8 @@ func setupTestServer(t *testing.T, acl ACL) {
 		default:
 			conn, err := ln.Accept()
 			if err != nil {
-				t.Fatalf("%v", err)
+				t.Errorf("%v", err)
+				return
 			}
 			go handleTestConnection(conn, acl, t)
 		}
@@ -177,7 +321,8 @@ func handleTestConnection(conn net.Conn, acl ACL, t *testing.T) {
 	defer conn.Close()
 	ip, err := NetConnLookup(conn)
 	if err != nil {
-		t.Fatalf("%v", err)
+		t.Errorf("%v", err)
+		return
 	}
 
 	if acl.Permitted(ip) {
@@ -241,11 +386,64 @@ func TestBasicDumpLoad(t *testing.T) {
 	}
 }
 
+func TestBasicJSONRoundTrip(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "127.0.0.1", t)
+	addIPString(acl, "10.0.1.15", t)
+	addIPString(acl, "2001:db8::1", t)
+	acl.Disable(mustParseIP(t, "10.0.1.15"))
+
+	out, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded := NewBasic()
+	if err = json.Unmarshal(out, loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(DumpBasic(acl), DumpBasic(loaded)) {
+		t.Fatalf("JSON round trip failed: %s != %s", DumpBasic(acl), DumpBasic(loaded))
+	}
+
+	if checkIPString(loaded, "10.0.1.15", t) || !checkIPString(loaded, "2001:db8::1", t) {
+		t.Fatal("round trip should keep which addresses are enabled")
+	}
+}
+
 func TestBasicFailedLoad(t *testing.T) {
 	dump := []byte("192.168.1.5\n192.168.2.3\n192.168.2\n192.168.3.1")
 	if _, err := LoadBasic(dump); err == nil {
 		t.Fatalf("LoadBasic should fail on invalid IP address")
 	}
+
+	dump = []byte("192.168.1.5\n192.168.2.3\n\n# 192.168.2\n192.168.3.1\n")
+	if _, err := LoadBasic(dump); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestBasicLoadComments(t *testing.T) {
+	dump := []byte("# managed by ansible\n\n  192.168.1.5  \n\t\n#192.168.1.6\n!192.168.1.7\r\n2001:db8::1\n")
+	acl, err := LoadBasic(dump)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "!192.168.1.7\n192.168.1.5\n2001:db8::1"
+	if out := string(DumpBasic(acl)); out != expected {
+		t.Fatalf("expected\n%s\nbut have\n%s", expected, out)
+	}
+
+	acl, err = LoadBasic(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.Count() != 0 {
+		t.Fatal("expected an empty ACL")
+	}
 }
 
 func TestNetConnChecks(t *testing.T) {
@@ -323,6 +521,101 @@ func TestStubConn(t *testing.T) {
 
 }
 
+// stringAddr is a net.Addr that NetConnLookup has to parse.
+type stringAddr string
+
+func (a stringAddr) Network() string { return "tcp" }
+func (a stringAddr) String() string  { return string(a) }
+
+func TestNetConnLookupAddrs(t *testing.T) {
+	var nilTCP *net.TCPAddr
+	for _, tc := range []struct {
+		addr     net.Addr
+		expected string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4141}, "192.0.2.1"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4141}, "2001:db8::1"},
+		{stringAddr("192.0.2.2:4141"), "192.0.2.2"},
+		{stringAddr("[2001:db8::2]:4141"), "2001:db8::2"},
+		{stringAddr("192.0.2.2"), ""},
+		{nilTCP, ""},
+	} {
+		ip, err := NetConnLookup(&remoteConn{remote: tc.addr})
+		if tc.expected == "" {
+			if err == nil {
+				t.Fatalf("%v: expected an error, but have %s", tc.addr, ip)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%v: %v", tc.addr, err)
+		}
+
+		if ip.String() != tc.expected {
+			t.Fatalf("expected %s, but have %s", tc.expected, ip)
+		}
+	}
+}
+
+func TestAddrLookup(t *testing.T) {
+	var nilUDP *net.UDPAddr
+	for _, tc := range []struct {
+		addr     interface{}
+		expected string
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}, "192.0.2.1"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, "2001:db8::1"},
+		{&net.IPAddr{IP: net.ParseIP("192.0.2.2")}, "192.0.2.2"},
+		{&net.IPAddr{IP: net.ParseIP("2001:db8::2"), Zone: "eth0"}, "2001:db8::2"},
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.3"), Port: 4141}, "192.0.2.3"},
+		{stringAddr("192.0.2.4:53"), "192.0.2.4"},
+		{nilUDP, ""},
+		{nil, ""},
+		{"192.0.2.1:53", ""},
+	} {
+		ip, err := AddrLookup{}.Address(tc.addr)
+		if tc.expected == "" {
+			if err == nil {
+				t.Fatalf("%v: expected an error, but have %s", tc.addr, ip)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%v: %v", tc.addr, err)
+		}
+
+		if ip.String() != tc.expected {
+			t.Fatalf("expected %s, but have %s", tc.expected, ip)
+		}
+	}
+
+	if _, err := (AddrLookup{}).Address(); err == nil {
+		t.Fatal("expected an error without an address")
+	}
+}
+
+func BenchmarkNetConnLookupTCP(b *testing.B) {
+	conn := &remoteConn{remote: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4141}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NetConnLookup(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNetConnLookupString(b *testing.B) {
+	conn := &remoteConn{remote: stringAddr("192.0.2.1:4141")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NetConnLookup(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestValidIP(t *testing.T) {
 	ip4 := []byte{127, 0, 0, 1}
 	ip6 := make([]byte, 16)
@@ -332,3 +625,495 @@ func TestValidIP(t *testing.T) {
 		t.Fatal("Failed to validate an IPv4 or an IPv6 address")
 	}
 }
+
+func TestAssert(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	addIPString(acl, "10.0.0.2", t)
+
+	required := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	if err := Assert(acl, required); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	required = append(required, net.ParseIP("10.0.0.3"), nil)
+	err := Assert(acl, required)
+	if err == nil {
+		t.Fatal("Assert should fail when a required address is denied")
+	}
+
+	denied, ok := err.(*DeniedError)
+	if !ok {
+		t.Fatalf("expected a *DeniedError, but have %T", err)
+	}
+
+	if len(denied.Denied) != 2 || !denied.Denied[0].Equal(required[2]) {
+		t.Fatalf("unexpected denied addresses %v", denied.Denied)
+	}
+
+	expected := "netallow: ACL denies required addresses 10.0.0.3, "
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, but have %q", expected, err.Error())
+	}
+}
+
+func TestBasicSizeBytes(t *testing.T) {
+	acl := NewBasic()
+	size := acl.SizeBytes()
+	for _, addr := range []string{"127.0.0.1", "10.0.0.1", "2001:db8::1"} {
+		addIPString(acl, addr, t)
+		next := acl.SizeBytes()
+		if next <= size {
+			t.Fatalf("expected size to grow after adding %s, but have %d after %d", addr, next, size)
+		}
+		size = next
+	}
+}
+
+func TestBasicSingleEntry(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.168.1.1", t)
+	if acl.single == nil {
+		t.Fatal("single-entry fast path should be in use")
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.168.1.1":        true,
+		"::ffff:192.168.1.1": true,
+		"192.168.1.2":        false,
+		"::1":                false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	addIPString(acl, "::1", t)
+	if acl.single != nil {
+		t.Fatal("single-entry fast path should not be used with two entries")
+	}
+
+	if !checkIPString(acl, "::1", t) || !checkIPString(acl, "192.168.1.1", t) {
+		t.Fatal("ACL should have permitted both addresses")
+	}
+
+	delIPString(acl, "192.168.1.1", t)
+	if acl.single == nil || !checkIPString(acl, "::1", t) || checkIPString(acl, "::2", t) {
+		t.Fatal("single-entry fast path should be used for the remaining IPv6 entry")
+	}
+
+	delIPString(acl, "::1", t)
+	if acl.single != nil || checkIPString(acl, "::1", t) {
+		t.Fatal("empty ACL should deny everything")
+	}
+}
+
+func benchmarkBasic(b *testing.B, entries int) {
+	acl := NewBasic()
+	for i := 0; i < entries; i++ {
+		acl.Add(net.IPv4(127, 0, byte(i>>8), byte(i+1)))
+	}
+
+	ip := net.IP{127, 0, 0, 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !acl.Permitted(ip) {
+			b.Fatal("address should have been permitted")
+		}
+	}
+}
+
+func BenchmarkBasicOneEntry(b *testing.B) {
+	benchmarkBasic(b, 1)
+}
+
+func BenchmarkBasicTwoEntries(b *testing.B) {
+	benchmarkBasic(b, 2)
+}
+
+// BenchmarkBasicParallel checks a 1000-entry ACL from many goroutines
+// at once, as a busy server does.
+func BenchmarkBasicParallel(b *testing.B) {
+	acl := NewBasic()
+	for i := 0; i < 1000; i++ {
+		acl.Add(net.IPv4(127, 0, byte(i>>8), byte(i+1)))
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		ip := net.IP{127, 0, 0, 1}
+		for pb.Next() {
+			if !acl.Permitted(ip) {
+				b.Fatal("address should have been permitted")
+			}
+		}
+	})
+}
+
+func TestBasicEnableDisable(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	addIPString(acl, "10.0.0.2", t)
+
+	ip := mustParseIP(t, "10.0.0.1")
+	acl.Disable(ip)
+	if checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("ACL should have denied disabled address")
+	}
+
+	if string(DumpBasic(acl)) != "!10.0.0.1\n10.0.0.2" {
+		t.Fatalf("unexpected dump %q", DumpBasic(acl))
+	}
+
+	out, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The disabled flag survives a round trip through both
+	// formats.
+	var fromJSON = NewBasic()
+	if err = json.Unmarshal(out, fromJSON); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fromDump, err := LoadBasic(DumpBasic(acl))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, loaded := range []*Basic{fromJSON, fromDump} {
+		if checkIPString(loaded, "10.0.0.1", t) || !checkIPString(loaded, "10.0.0.2", t) {
+			t.Fatal("loaded ACL should have kept the disabled flag")
+		}
+
+		loaded.Enable(ip)
+		if !checkIPString(loaded, "10.0.0.1", t) {
+			t.Fatal("ACL should have permitted enabled address")
+		}
+	}
+
+	acl.Enable(ip)
+	if string(DumpBasic(acl)) != "10.0.0.1\n10.0.0.2" {
+		t.Fatalf("unexpected dump %q", DumpBasic(acl))
+	}
+
+	// Enabling an address that isn't in the ACL does nothing.
+	acl.Enable(mustParseIP(t, "10.0.0.3"))
+	if checkIPString(acl, "10.0.0.3", t) {
+		t.Fatal("Enable should not add addresses")
+	}
+}
+
+func TestBasicDisableSingle(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	acl.Disable(mustParseIP(t, "10.0.0.1"))
+	if checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("ACL should have denied disabled address")
+	}
+
+	addIPString(acl, "10.0.0.1", t)
+	if !checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("adding a disabled address should enable it")
+	}
+}
+
+func TestBasicCountList(t *testing.T) {
+	acl := NewBasic()
+	if acl.Count() != 0 || len(acl.List()) != 0 {
+		t.Fatal("expected an empty ACL")
+	}
+
+	addIPString(acl, "2001:db8::1", t)
+	addIPString(acl, "192.168.1.1", t)
+	addIPString(acl, "10.0.0.1", t)
+	acl.Disable(mustParseIP(t, "192.168.1.1"))
+	if acl.Count() != 3 {
+		t.Fatalf("expected 3 addresses, but have %d", acl.Count())
+	}
+
+	var have []string
+	for _, ip := range acl.List() {
+		have = append(have, ip.String())
+	}
+	expected := "10.0.0.1,192.168.1.1,2001:db8::1"
+	if got := strings.Join(have, ","); got != expected {
+		t.Fatalf("expected %s, but have %s", expected, got)
+	}
+}
+
+func TestStubLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := log.New(buf, "", 0)
+
+	hs := NewHostStubWithLogger(l)
+	addIPString(hs, "127.0.0.1", t)
+	if !checkIPString(hs, "127.0.0.1", t) {
+		t.Fatal("stub should have permitted address")
+	}
+
+	ns := NewNetStubWithLogger(l)
+	testAddNet(ns, "10.0.0.0/8", t)
+	if !ns.Permitted(mustParseIP(t, "192.0.2.1")) {
+		t.Fatal("stub should have permitted address")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 warnings, but have %d: %q", len(lines), buf.String())
+	}
+
+	// A nil *log.Logger falls back to the default logger.
+	var nilLogger *log.Logger
+	NewHostStubWithLogger(nilLogger).Permitted(mustParseIP(t, "127.0.0.1"))
+}
+
+func TestPermittedBatch(t *testing.T) {
+	hosts := NewBasic()
+	addIPString(hosts, "192.0.2.1", t)
+	addIPString(hosts, "2001:db8::1", t)
+
+	nets := NewBasicNet()
+	testAddNet(nets, "192.0.2.0/31", t)
+	testAddNet(nets, "2001:db8::/127", t)
+
+	// Combined doesn't implement BatchACL, so the free functions
+	// fall back to checking each address.
+	combined := NewCombined(NewBasic(), nets)
+
+	permitted := mustParseIP(t, "192.0.2.1")
+	permitted6 := mustParseIP(t, "2001:db8::1")
+	denied := mustParseIP(t, "198.51.100.1")
+
+	for _, tc := range []struct {
+		ips      []net.IP
+		any, all bool
+	}{
+		{nil, false, false},
+		{[]net.IP{permitted}, true, true},
+		{[]net.IP{permitted, permitted6}, true, true},
+		{[]net.IP{denied, permitted}, true, false},
+		{[]net.IP{permitted, denied}, true, false},
+		{[]net.IP{denied}, false, false},
+		{[]net.IP{permitted, nil}, true, false},
+	} {
+		for _, acl := range []ACL{hosts, nets, combined} {
+			if PermittedAny(acl, tc.ips) != tc.any {
+				t.Fatalf("%T: expected PermittedAny(%v) to be %v", acl, tc.ips, tc.any)
+			}
+
+			if PermittedAll(acl, tc.ips) != tc.all {
+				t.Fatalf("%T: expected PermittedAll(%v) to be %v", acl, tc.ips, tc.all)
+			}
+		}
+	}
+}
+
+func TestBasicClear(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+	addIPString(acl, "2001:db8::1", t)
+	acl.AddFromSource(mustParseIP(t, "192.0.2.2"), "feed")
+
+	acl.Clear()
+	for _, addr := range []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"} {
+		if checkIPString(acl, addr, t) {
+			t.Fatalf("cleared ACL shouldn't permit %s", addr)
+		}
+	}
+
+	if acl.Count() != 0 || len(acl.Sources(mustParseIP(t, "192.0.2.2"))) != 0 {
+		t.Fatal("expected an empty ACL")
+	}
+
+	addIPString(acl, "192.0.2.3", t)
+	if !checkIPString(acl, "192.0.2.3", t) {
+		t.Fatal("ACL should permit an address added after clearing")
+	}
+}
+
+func TestBasicChecked(t *testing.T) {
+	acl := NewBasic()
+	for _, ip := range []net.IP{nil, {}, {127, 0, 0}, {0, 0, 0, 0, 0}, net.ParseIP("999.1.1.1")} {
+		if err := acl.AddChecked(ip); err != ErrInvalidIP {
+			t.Fatalf("AddChecked(%v): expected ErrInvalidIP, but have %v", []byte(ip), err)
+		}
+
+		if err := acl.RemoveChecked(ip); err != ErrInvalidIP {
+			t.Fatalf("RemoveChecked(%v): expected ErrInvalidIP, but have %v", []byte(ip), err)
+		}
+	}
+
+	if acl.Count() != 0 {
+		t.Fatal("invalid addresses shouldn't be added")
+	}
+
+	if err := acl.AddChecked(mustParseIP(t, "192.0.2.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("address should have been added")
+	}
+
+	if err := acl.RemoveChecked(mustParseIP(t, "192.0.2.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("address should have been removed")
+	}
+
+	if err := acl.RemoveChecked(mustParseIP(t, "192.0.2.1")); err != nil {
+		t.Fatalf("removing an absent address shouldn't fail, but have %v", err)
+	}
+}
+
+func TestBasicMany(t *testing.T) {
+	acl := NewBasic()
+	acl.AddMany([]net.IP{
+		mustParseIP(t, "192.0.2.1"),
+		mustParseIP(t, "192.0.2.2"),
+		nil,
+		{1, 2, 3},
+		mustParseIP(t, "2001:db8::1"),
+	})
+
+	if acl.Count() != 3 {
+		t.Fatalf("expected 3 addresses, but have %d", acl.Count())
+	}
+
+	acl.RemoveMany([]net.IP{mustParseIP(t, "192.0.2.1"), nil, mustParseIP(t, "2001:db8::1")})
+	if acl.Count() != 1 || !checkIPString(acl, "192.0.2.2", t) {
+		t.Fatalf("expected only 192.0.2.2 to be left, but have %v", acl.List())
+	}
+
+	// The single-entry fast path must be kept up to date.
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("removed address shouldn't be permitted")
+	}
+}
+
+func benchmarkIPs(n int) []net.IP {
+	ips := make([]net.IP, n)
+	for i := range ips {
+		ips[i] = net.IP{10, byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+	return ips
+}
+
+func BenchmarkBasicAdd(b *testing.B) {
+	ips := benchmarkIPs(10000)
+	for i := 0; i < b.N; i++ {
+		acl := NewBasic()
+		for _, ip := range ips {
+			acl.Add(ip)
+		}
+	}
+}
+
+func BenchmarkBasicAddMany(b *testing.B) {
+	ips := benchmarkIPs(10000)
+	for i := 0; i < b.N; i++ {
+		NewBasic().AddMany(ips)
+	}
+}
+
+func TestBasicString(t *testing.T) {
+	acl := NewBasic()
+	if s := fmt.Sprint(acl); s != "Basic{0 hosts}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+
+	addIPString(acl, "127.0.0.1", t)
+	if s := acl.String(); s != "Basic{1 host: 127.0.0.1}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+
+	addIPString(acl, "10.0.0.1", t)
+	addIPString(acl, "::1", t)
+	acl.Disable(mustParseIP(t, "::1"))
+	if s := fmt.Sprintf("%v", acl); s != "Basic{3 hosts: !::1, 10.0.0.1, 127.0.0.1}" {
+		t.Fatalf("unexpected summary %s", s)
+	}
+
+	acl.AddMany(benchmarkIPs(20))
+	expected := "Basic{22 hosts: !::1, 10.0.0.0, 10.0.0.1, 10.0.0.10, 10.0.0.11, " +
+		"10.0.0.12, 10.0.0.13, 10.0.0.14, 10.0.0.15, 10.0.0.16, ...}"
+	if s := acl.String(); s != expected {
+		t.Fatalf("expected %s, but have %s", expected, s)
+	}
+}
+
+func TestBasicSnapshot(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.2", t)
+	addIPString(acl, "192.0.2.1", t)
+	addIPString(acl, "192.0.2.3", t)
+	acl.Disable(mustParseIP(t, "192.0.2.3"))
+
+	snap := acl.Snapshot()
+	if len(snap) != 2 || snap[0].String() != "192.0.2.1" || snap[1].String() != "192.0.2.2" {
+		t.Fatalf("unexpected snapshot %v", snap)
+	}
+
+	// The snapshot doesn't follow later changes.
+	delIPString(acl, "192.0.2.1", t)
+	if len(snap) != 2 || snap[0].String() != "192.0.2.1" {
+		t.Fatalf("snapshot changed with the ACL: %v", snap)
+	}
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+	hosts := NewBasic()
+	nets := NewBasicNet()
+	for i := 0; i < 256; i++ {
+		hosts.Add(net.IPv4(10, 0, 0, byte(i)))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				ip := make(net.IP, 4)
+				binary.BigEndian.PutUint32(ip, uint32(0x0b000000+w<<16+i%1024))
+				hosts.Add(ip)
+				hosts.Remove(ip)
+				nets.Add(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+				nets.Remove(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+			}
+		}(w)
+	}
+
+	for i := 0; i < 100; i++ {
+		snap := hosts.Snapshot()
+		if len(snap) < 256 {
+			t.Fatalf("snapshot is missing addresses: have %d", len(snap))
+		}
+
+		for _, ip := range snap {
+			if ip == nil {
+				t.Fatal("snapshot has an invalid address")
+			}
+		}
+
+		for _, n := range nets.Snapshot() {
+			if n == nil {
+				t.Fatal("snapshot has an invalid network")
+			}
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,10 @@
+module github.com/kisom/netallow/netallowgrpc
+
+go 1.14
+
+require (
+	github.com/kisom/netallow v0.0.0
+	google.golang.org/grpc v1.33.2
+)
+
+replace github.com/kisom/netallow => ../
@@ -0,0 +1,82 @@
+// Package netallowgrpc provides gRPC server interceptors that check
+// clients against a netallow ACL. It is a separate module so that
+// users of netallow who don't use gRPC don't depend on it.
+package netallowgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/kisom/netallow"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerIP returns the IP address of the client that made the call in
+// ctx, taken from the peer information gRPC attaches to the context.
+// It is the address of the transport connection, so behind a proxy
+// it is the proxy's address. An error is returned if the context has
+// no peer information or the peer's address isn't an IP address, as
+// for clients connected over a Unix socket.
+func PeerIP(ctx context.Context) (net.IP, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil, errors.New("netallowgrpc: no peer information")
+	}
+
+	if addr, ok := p.Addr.(*net.TCPAddr); ok {
+		return addr.IP, nil
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errors.New("netallowgrpc: peer address isn't an IP address")
+	}
+	return ip, nil
+}
+
+// check returns nil if the call in ctx is permitted by acl, and a
+// PermissionDenied error otherwise.
+func check(ctx context.Context, acl netallow.ACL) error {
+	ip, err := PeerIP(ctx)
+	if err != nil || !acl.Permitted(ip) {
+		return status.Error(codes.PermissionDenied, "netallowgrpc: access denied")
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns an interceptor that only passes on
+// calls from clients permitted by acl. The client's address is found
+// with PeerIP; calls without a usable peer address are denied.
+// Denied calls fail with codes.PermissionDenied without reaching the
+// handler.
+func UnaryServerInterceptor(acl netallow.ACL) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, acl); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor. The client is checked once, when the
+// stream is opened.
+func StreamServerInterceptor(acl netallow.ACL) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), acl); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
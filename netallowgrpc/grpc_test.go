@@ -0,0 +1,93 @@
+package netallowgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/kisom/netallow"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(addr net.Addr) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func testACL() netallow.ACL {
+	acl := netallow.NewBasic()
+	acl.Add(net.ParseIP("192.0.2.1"))
+	acl.Add(net.ParseIP("2001:db8::1"))
+	return acl
+}
+
+var testContexts = []struct {
+	name      string
+	ctx       context.Context
+	permitted bool
+}{
+	{"permitted TCP", peerContext(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4141}), true},
+	{"permitted IPv6", peerContext(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4141}), true},
+	{"denied TCP", peerContext(&net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 4141}), false},
+	{"permitted UDP", peerContext(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4141}), true},
+	{"unix socket", peerContext(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}), false},
+	{"no peer", context.Background(), false},
+	{"nil address", peerContext(nil), false},
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(testACL())
+	for _, tc := range testContexts {
+		called := false
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return "OK", nil
+		}
+
+		resp, err := interceptor(tc.ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		if tc.permitted {
+			if err != nil || resp != "OK" || !called {
+				t.Fatalf("%s: expected the call to be permitted, but have %v", tc.name, err)
+			}
+			continue
+		}
+
+		if called || status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("%s: expected PermissionDenied, but have %v", tc.name, err)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(testACL())
+	for _, tc := range testContexts {
+		called := false
+		handler := func(srv interface{}, ss grpc.ServerStream) error {
+			called = true
+			return nil
+		}
+
+		err := interceptor(nil, &testStream{ctx: tc.ctx}, &grpc.StreamServerInfo{}, handler)
+		if tc.permitted {
+			if err != nil || !called {
+				t.Fatalf("%s: expected the stream to be permitted, but have %v", tc.name, err)
+			}
+			continue
+		}
+
+		if called || status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("%s: expected PermissionDenied, but have %v", tc.name, err)
+		}
+	}
+}
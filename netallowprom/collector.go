@@ -0,0 +1,69 @@
+// Package netallowprom exports the decisions of a netallow ACL as
+// Prometheus metrics. It is a separate module so that users of
+// netallow who don't use Prometheus don't depend on it.
+package netallowprom
+
+import (
+	"github.com/kisom/netallow"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counter is implemented by ACLs that can report their size, such as
+// netallow.Basic and netallow.BasicNet.
+type counter interface {
+	Count() int
+}
+
+// Collector is an ACL that counts the decisions of the ACL it wraps
+// and exports them to Prometheus as
+//
+//	netallow_permitted_total  counter of addresses permitted
+//	netallow_denied_total     counter of addresses denied
+//	netallow_entries          gauge of the entries in the ACL
+//
+// The entries gauge is only exported if the wrapped ACL has a Count
+// method. Use the Collector in place of the wrapped ACL, such as in a
+// netallow.Handler, and register it with a prometheus.Registerer. In
+// a Handler, the wrapped ACL decides as it would on its own, so a
+// MethodACL still sees the request's method.
+type Collector struct {
+	*netallow.MeteredACL
+
+	permitted *prometheus.Desc
+	denied    *prometheus.Desc
+	entries   *prometheus.Desc
+}
+
+// NewCollector returns a Collector wrapping acl. The labels are
+// attached to every metric, so that collectors for several ACLs can
+// be registered together; they may be nil.
+func NewCollector(acl netallow.ACL, labels prometheus.Labels) *Collector {
+	return &Collector{
+		MeteredACL: netallow.NewMeteredACL(acl),
+		permitted: prometheus.NewDesc("netallow_permitted_total",
+			"Number of addresses the ACL permitted.", nil, labels),
+		denied: prometheus.NewDesc("netallow_denied_total",
+			"Number of addresses the ACL denied.", nil, labels),
+		entries: prometheus.NewDesc("netallow_entries",
+			"Number of entries in the ACL.", nil, labels),
+	}
+}
+
+// Describe sends the descriptions of the collector's metrics to ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.permitted
+	ch <- c.denied
+	if _, ok := c.ACL().(counter); ok {
+		ch <- c.entries
+	}
+}
+
+// Collect sends the current values of the collector's metrics to ch.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	permitted, denied := c.Stats()
+	ch <- prometheus.MustNewConstMetric(c.permitted, prometheus.CounterValue, float64(permitted))
+	ch <- prometheus.MustNewConstMetric(c.denied, prometheus.CounterValue, float64(denied))
+	if acl, ok := c.ACL().(counter); ok {
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(acl.Count()))
+	}
+}
@@ -0,0 +1,119 @@
+package netallowprom
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kisom/netallow"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	acl := netallow.NewBasic()
+	acl.Add(net.IP{192, 0, 2, 1})
+	acl.Add(net.IP{192, 0, 2, 2})
+
+	c := NewCollector(acl, prometheus.Labels{"acl": "admin"})
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	c.Permitted(net.IP{192, 0, 2, 1})
+	c.Permitted(net.IP{192, 0, 2, 3})
+	c.Permitted(net.IP{192, 0, 2, 4})
+
+	expected := `
+# HELP netallow_denied_total Number of addresses the ACL denied.
+# TYPE netallow_denied_total counter
+netallow_denied_total{acl="admin"} 2
+# HELP netallow_entries Number of entries in the ACL.
+# TYPE netallow_entries gauge
+netallow_entries{acl="admin"} 2
+# HELP netallow_permitted_total Number of addresses the ACL permitted.
+# TYPE netallow_permitted_total counter
+netallow_permitted_total{acl="admin"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Changes to the ACL are reflected in the entries gauge.
+	c.Remove(net.IP{192, 0, 2, 2})
+	expected = `
+# HELP netallow_entries Number of entries in the ACL.
+# TYPE netallow_entries gauge
+netallow_entries{acl="admin"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "netallow_entries"); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestCollectorWithoutCount(t *testing.T) {
+	c := NewCollector(netallow.NewHostStub(), nil)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	c.Permitted(net.IP{127, 0, 0, 1})
+	n, err := testutil.GatherAndCount(reg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected only the two counters, but have %d metrics", n)
+	}
+
+	if err = reg.Register(NewCollector(netallow.NewBasic(), nil)); err == nil {
+		t.Fatal("registering a second unlabelled collector should fail")
+	}
+}
+
+func TestCollectorHandler(t *testing.T) {
+	acl := netallow.NewMethodACL()
+	acl.AddForMethods(net.IP{127, 0, 0, 1}, "GET")
+
+	c := NewCollector(acl, nil)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+
+	allow := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "OK")
+	})
+	deny := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "NO")
+	})
+
+	h, err := netallow.NewHandler(allow, deny, c)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for method, expected := range map[string]string{"GET": "OK", "POST": "NO"} {
+		req := httptest.NewRequest(method, "/", nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("%s: expected %s, but got %s", method, expected, w.Body.String())
+		}
+	}
+
+	expected := `
+# HELP netallow_denied_total Number of addresses the ACL denied.
+# TYPE netallow_denied_total counter
+netallow_denied_total 1
+# HELP netallow_permitted_total Number of addresses the ACL permitted.
+# TYPE netallow_permitted_total counter
+netallow_permitted_total 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/kisom/netallow/netallowprom
+
+go 1.14
+
+require (
+	github.com/kisom/netallow v0.0.0
+	github.com/prometheus/client_golang v1.11.1
+)
+
+replace github.com/kisom/netallow => ../
@@ -0,0 +1,115 @@
+// Package netallowtest provides helpers for testing implementations
+// of the netallow ACL interfaces.
+package netallowtest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kisom/netallow"
+)
+
+// Workers is the number of goroutines StressACL runs of each kind.
+const Workers = 8
+
+// deadlockGrace is how long past the stress duration StressACL waits
+// for its goroutines before declaring a deadlock.
+const deadlockGrace = 10 * time.Second
+
+// workerIP returns the private address for worker i, taken from the
+// 198.18.0.0/15 benchmarking network.
+func workerIP(i int) net.IP {
+	return net.IP{198, 18, byte(i >> 8), byte(i)}
+}
+
+// StressACL hammers the ACL from many goroutines for roughly the
+// given duration, to surface races and deadlocks. It is intended to
+// be run under the race detector (go test -race). The following
+// invariants are checked:
+//
+//   - No call panics.
+//   - Every goroutine finishes within a grace period after the
+//     duration; if not, the ACL is assumed to have deadlocked.
+//   - If the ACL is a HostACL or NetACL, each writer goroutine
+//     repeatedly adds and removes its own address (or single-host
+//     network), and checks that the address is permitted after Add
+//     returns and denied after Remove returns. Other goroutines
+//     concurrently check addresses and mutate other entries.
+//
+// The read-your-writes check assumes an ACL that only permits what
+// has been added, so stub ACLs that permit everything will fail it.
+func StressACL(t testing.TB, acl netallow.ACL, d time.Duration) {
+	t.Helper()
+
+	var add, remove func(net.IP)
+	switch acl := acl.(type) {
+	case netallow.HostACL:
+		add, remove = acl.Add, acl.Remove
+	case netallow.NetACL:
+		add = func(ip net.IP) {
+			acl.Add(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+		}
+		remove = func(ip net.IP) {
+			acl.Remove(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+		}
+	}
+
+	deadline := time.Now().Add(d)
+	wg := new(sync.WaitGroup)
+	run := func(name string, work func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("netallowtest: %s panicked: %v", name, r)
+				}
+			}()
+
+			for time.Now().Before(deadline) {
+				work()
+			}
+		}()
+	}
+
+	for i := 0; i < Workers; i++ {
+		ip := workerIP(i)
+		run(fmt.Sprintf("reader %d", i), func() {
+			for j := 0; j < Workers; j++ {
+				acl.Permitted(workerIP(j))
+			}
+			acl.Permitted(nil)
+		})
+
+		if add == nil {
+			continue
+		}
+
+		run(fmt.Sprintf("writer %d", i), func() {
+			add(ip)
+			if !acl.Permitted(ip) {
+				t.Errorf("netallowtest: %s was denied after it was added", ip)
+			}
+
+			remove(ip)
+			if acl.Permitted(ip) {
+				t.Errorf("netallowtest: %s was permitted after it was removed", ip)
+			}
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(d + deadlockGrace):
+		t.Fatalf("netallowtest: ACL operations didn't finish within %s; possible deadlock", d+deadlockGrace)
+	}
+}
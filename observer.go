@@ -0,0 +1,90 @@
+package netallow
+
+// This file contains support for observing a Handler's access
+// decisions, such as to export metrics.
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// An Exemplar links an access decision to the distributed trace of
+// the request it was made for. Metrics backends supporting
+// OpenMetrics exemplars can attach it to a sample, so that a spike
+// in denials can be followed to specific traces.
+type Exemplar struct {
+	TraceID string
+	SpanID  string
+}
+
+// Labels returns the exemplar as OpenMetrics exemplar labels, using
+// the conventional trace_id and span_id names.
+func (ex *Exemplar) Labels() map[string]string {
+	labels := map[string]string{"trace_id": ex.TraceID}
+	if ex.SpanID != "" {
+		labels["span_id"] = ex.SpanID
+	}
+	return labels
+}
+
+// An Observer is told about each access decision a Handler makes.
+// The exemplar is nil unless the request carried trace context.
+// Observers are called on the request path, so they should be fast.
+type Observer interface {
+	Observe(permitted bool, ex *Exemplar)
+}
+
+// ObserverFunc adapts an ordinary function to an Observer.
+type ObserverFunc func(permitted bool, ex *Exemplar)
+
+// Observe calls f(permitted, ex).
+func (f ObserverFunc) Observe(permitted bool, ex *Exemplar) {
+	f(permitted, ex)
+}
+
+// validTraceHex returns true if s is n lowercase hex digits that
+// aren't all zero, as required of W3C trace context IDs.
+func validTraceHex(s string, n int) bool {
+	if len(s) != n || strings.ToLower(s) != s {
+		return false
+	}
+
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		return false
+	}
+
+	for _, b := range id {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ExemplarFromRequest returns the trace and span IDs from the
+// request's W3C traceparent header, or from B3 headers if there is
+// no traceparent. It returns nil if the request has no valid trace
+// context.
+func ExemplarFromRequest(req *http.Request) *Exemplar {
+	if tp := req.Header.Get("traceparent"); tp != "" {
+		parts := strings.Split(strings.TrimSpace(tp), "-")
+		if len(parts) < 4 || parts[0] == "ff" || !validTraceHex(parts[1], 32) ||
+			!validTraceHex(parts[2], 16) {
+			return nil
+		}
+		return &Exemplar{TraceID: parts[1], SpanID: parts[2]}
+	}
+
+	traceID := strings.ToLower(req.Header.Get("X-B3-TraceId"))
+	if !validTraceHex(traceID, 32) && !validTraceHex(traceID, 16) {
+		return nil
+	}
+
+	ex := &Exemplar{TraceID: traceID}
+	if spanID := strings.ToLower(req.Header.Get("X-B3-SpanId")); validTraceHex(spanID, 16) {
+		ex.SpanID = spanID
+	}
+	return ex
+}
@@ -0,0 +1,127 @@
+package netallow
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExemplarFromRequest(t *testing.T) {
+	tv := []struct {
+		headers map[string]string
+		trace   string
+		span    string
+	}{
+		{nil, "", ""},
+		{map[string]string{
+			"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{
+			"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		}, "", ""},
+		{map[string]string{
+			"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		}, "", ""},
+		{map[string]string{"traceparent": "garbage"}, "", ""},
+		{map[string]string{
+			"X-B3-TraceId": "463ac35c9f6413ad",
+			"X-B3-SpanId":  "a2fb4a1d1a96d312",
+		}, "463ac35c9f6413ad", "a2fb4a1d1a96d312"},
+	}
+
+	for i, tc := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+
+		ex := ExemplarFromRequest(req)
+		if tc.trace == "" {
+			if ex != nil {
+				t.Fatalf("%d: expected no exemplar, but have %+v", i, ex)
+			}
+			continue
+		}
+
+		if ex == nil || ex.TraceID != tc.trace || ex.SpanID != tc.span {
+			t.Fatalf("%d: unexpected exemplar %+v", i, ex)
+		}
+	}
+}
+
+func TestObserverExemplar(t *testing.T) {
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var denials int
+	var last *Exemplar
+	h.SetObserver(ObserverFunc(func(permitted bool, ex *Exemplar) {
+		if !permitted {
+			denials++
+		}
+		last = ex
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if denials != 1 || last == nil {
+		t.Fatal("observer should have been given the denial with an exemplar")
+	}
+
+	labels := last.Labels()
+	if labels["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || labels["span_id"] != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected exemplar labels %v", labels)
+	}
+
+	// Without trace context, there is no exemplar.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if denials != 2 || last != nil {
+		t.Fatal("observer should have been given the denial without an exemplar")
+	}
+}
+
+func TestHandlerOnAllowOnDeny(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Requests must be served with no callbacks set.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.2:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var allowed, denied []string
+	h.OnAllow(func(ip net.IP, req *http.Request) {
+		allowed = append(allowed, ip.String())
+	})
+	h.OnDeny(func(ip net.IP, req *http.Request) {
+		// The ACL must be usable from a callback.
+		acl.Add(ip)
+		denied = append(denied, ip.String())
+	})
+
+	for _, remote := range []string{"192.0.2.1:4141", "192.0.2.2:4141", "192.0.2.2:4141"} {
+		req = httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(allowed) != 2 || allowed[0] != "192.0.2.1" || allowed[1] != "192.0.2.2" {
+		t.Fatalf("unexpected allowed callbacks %v", allowed)
+	}
+
+	if len(denied) != 1 || denied[0] != "192.0.2.2" {
+		t.Fatalf("unexpected denied callbacks %v", denied)
+	}
+}
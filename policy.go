@@ -0,0 +1,124 @@
+package netallow
+
+// This file contains helpers for classifying addresses, policies that
+// use them to refuse additions to an ACL, and helpers for adding the
+// standard local ranges.
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	// ErrNotLoopback is returned by LoopbackOnly for addresses
+	// outside the loopback ranges.
+	ErrNotLoopback = errors.New("netallow: address is not a loopback address")
+
+	// ErrPrivateIP is returned by PublicOnly for private and
+	// loopback addresses.
+	ErrPrivateIP = errors.New("netallow: address is private")
+)
+
+var privateNets = []*net.IPNet{
+	{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+	{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)},
+	{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(16, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+}
+
+// IsLoopback returns true if the IP is in 127.0.0.0/8 or is the IPv6
+// loopback address, ::1. IPv4-mapped IPv6 addresses are treated as
+// IPv4.
+func IsLoopback(ip net.IP) bool {
+	return validIP(ip) && ip.IsLoopback()
+}
+
+// IsPrivate returns true if the IP is in one of the private IPv4
+// networks set aside by RFC 1918 (10.0.0.0/8, 172.16.0.0/12, and
+// 192.168.0.0/16) or is an IPv6 unique local address (fc00::/7).
+// Loopback addresses aren't private; check them with IsLoopback.
+func IsPrivate(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// An AddPolicy decides whether an address may be added to an ACL,
+// returning a non-nil error to refuse it. A policy that only wants
+// to warn about an address can log it and return nil.
+type AddPolicy func(net.IP) error
+
+// LoopbackOnly is an AddPolicy that refuses addresses other than
+// loopback addresses, for ACLs guarding local administrative
+// interfaces.
+func LoopbackOnly(ip net.IP) error {
+	if !IsLoopback(ip) {
+		return ErrNotLoopback
+	}
+	return nil
+}
+
+// PublicOnly is an AddPolicy that refuses private and loopback
+// addresses, for ACLs of public clients.
+func PublicOnly(ip net.IP) error {
+	if IsPrivate(ip) || IsLoopback(ip) {
+		return ErrPrivateIP
+	}
+	return nil
+}
+
+// SetAddPolicy sets the policy consulted before an address is added
+// with Add, AddChecked, AddMany, or AddFromSource. Add, AddMany, and
+// AddFromSource silently skip refused addresses, while AddChecked
+// returns the policy's error. Addresses already in the ACL, and
+// contents replaced wholesale, such as by ReloadFromFile, aren't
+// checked. A nil policy permits every address.
+func (acl *Basic) SetAddPolicy(policy AddPolicy) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.policy = policy
+}
+
+// checkPolicy applies the ACL's policy to a valid IP. The policy is
+// called without the lock held, so that it may use the ACL.
+func (acl *Basic) checkPolicy(ip net.IP) error {
+	acl.lock.RLock()
+	policy := acl.policy
+	acl.lock.RUnlock()
+
+	if policy == nil {
+		return nil
+	}
+	return policy(ip)
+}
+
+// AddLoopback adds both loopback addresses, 127.0.0.1 and ::1, to the
+// ACL. Clients connecting to "localhost" may use either, depending
+// on how the name resolves.
+func AddLoopback(acl HostACL) {
+	acl.Add(net.IPv4(127, 0, 0, 1))
+	acl.Add(net.IPv6loopback)
+}
+
+// AddPrivateRanges adds the private networks recognised by IsPrivate
+// to the ACL: the RFC 1918 IPv4 networks and the IPv6 unique local
+// addresses.
+func AddPrivateRanges(acl NetACL) {
+	for _, n := range privateNets {
+		acl.Add(&net.IPNet{
+			IP:   append(net.IP(nil), n.IP...),
+			Mask: append(net.IPMask(nil), n.Mask...),
+		})
+	}
+}
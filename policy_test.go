@@ -0,0 +1,134 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for addr, expected := range map[string]struct{ private, loopback bool }{
+		"10.0.0.1":         {true, false},
+		"10.255.255.255":   {true, false},
+		"172.16.0.1":       {true, false},
+		"172.31.255.254":   {true, false},
+		"172.32.0.1":       {false, false},
+		"192.168.1.1":      {true, false},
+		"192.169.1.1":      {false, false},
+		"::ffff:10.1.2.3":  {true, false},
+		"fc00::1":          {true, false},
+		"fdff:ffff::1":     {true, false},
+		"fe80::1":          {false, false},
+		"2001:db8::1":      {false, false},
+		"127.0.0.1":        {false, true},
+		"127.255.0.3":      {false, true},
+		"::ffff:127.0.0.1": {false, true},
+		"::1":              {false, true},
+		"8.8.8.8":          {false, false},
+	} {
+		ip := mustParseIP(t, addr)
+		if IsPrivate(ip) != expected.private {
+			t.Fatalf("expected IsPrivate(%s) to be %v", addr, expected.private)
+		}
+
+		if IsLoopback(ip) != expected.loopback {
+			t.Fatalf("expected IsLoopback(%s) to be %v", addr, expected.loopback)
+		}
+	}
+
+	if IsPrivate(nil) || IsLoopback(net.IP{127, 0, 0}) {
+		t.Fatal("invalid addresses shouldn't be classified")
+	}
+}
+
+func TestBasicAddPolicy(t *testing.T) {
+	acl := NewBasic()
+	acl.SetAddPolicy(LoopbackOnly)
+
+	addIPString(acl, "127.0.0.1", t)
+	addIPString(acl, "192.0.2.1", t)
+	acl.AddMany([]net.IP{mustParseIP(t, "::1"), mustParseIP(t, "10.0.0.1")})
+	acl.AddFromSource(mustParseIP(t, "203.0.113.1"), "feed")
+
+	if string(DumpBasic(acl)) != "127.0.0.1\n::1" {
+		t.Fatalf("expected only loopback addresses, have %s", acl)
+	}
+
+	if err := acl.AddChecked(mustParseIP(t, "192.0.2.1")); err != ErrNotLoopback {
+		t.Fatalf("expected ErrNotLoopback, have %v", err)
+	}
+
+	if err := acl.AddChecked(nil); err != ErrInvalidIP {
+		t.Fatalf("expected ErrInvalidIP, have %v", err)
+	}
+
+	// Custom policies can refuse with their own errors, and may use
+	// the ACL itself.
+	errFull := errors.New("full")
+	acl.SetAddPolicy(func(ip net.IP) error {
+		if acl.Count() >= 3 {
+			return errFull
+		}
+		return PublicOnly(ip)
+	})
+
+	if err := acl.AddChecked(mustParseIP(t, "10.0.0.1")); err != ErrPrivateIP {
+		t.Fatalf("expected ErrPrivateIP, have %v", err)
+	}
+
+	if err := acl.AddChecked(mustParseIP(t, "192.0.2.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := acl.AddChecked(mustParseIP(t, "192.0.2.2")); err != errFull {
+		t.Fatalf("expected the custom error, have %v", err)
+	}
+
+	acl.SetAddPolicy(nil)
+	addIPString(acl, "10.0.0.1", t)
+	if acl.Count() != 4 {
+		t.Fatalf("expected 4 addresses without a policy, have %s", acl)
+	}
+}
+
+func TestAddLoopback(t *testing.T) {
+	acl := NewBasic()
+	AddLoopback(acl)
+
+	for _, addr := range []string{"127.0.0.1", "::1", "::ffff:127.0.0.1"} {
+		if !checkIPString(acl, addr, t) {
+			t.Fatalf("expected %s to be permitted", addr)
+		}
+	}
+
+	if acl.Count() != 2 {
+		t.Fatalf("expected 2 addresses, have %s", acl)
+	}
+
+	// Loopback addresses pass the loopback policy.
+	acl = NewBasic()
+	acl.SetAddPolicy(LoopbackOnly)
+	AddLoopback(acl)
+	if acl.Count() != 2 {
+		t.Fatalf("expected 2 addresses, have %s", acl)
+	}
+}
+
+func TestAddPrivateRanges(t *testing.T) {
+	acl := NewBasicNet()
+	AddPrivateRanges(acl)
+
+	for addr, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"172.20.0.1":  true,
+		"192.168.1.1": true,
+		"fd00::1":     true,
+		"127.0.0.1":   false,
+		"8.8.8.8":     false,
+		"2001:db8::1": false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package netallow
+
+// This file contains helpers for doing arithmetic on network
+// prefixes.
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// prefixOf returns the network address, prefix length, and address
+// length in bits of n. IPv4 networks are returned with a 4-byte
+// address. A nil address is returned if n isn't a valid network.
+func prefixOf(n *net.IPNet) (ip net.IP, ones, bits int) {
+	if n == nil {
+		return nil, 0, 0
+	}
+
+	ones, bits = n.Mask.Size()
+	switch bits {
+	case 32:
+		ip = n.IP.To4()
+	case 128:
+		ip = n.IP.To16()
+	}
+
+	if ip == nil {
+		return nil, 0, 0
+	}
+
+	return ip.Mask(n.Mask), ones, bits
+}
+
+// canonicalNet returns a copy of n in its canonical form: the
+// network address, with host bits cleared, and a CIDR mask of the
+// same length as the address. It returns nil if n isn't a valid
+// network, such as one with a non-contiguous mask.
+func canonicalNet(n *net.IPNet) *net.IPNet {
+	ip, ones, bits := prefixOf(n)
+	if ip == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, bits)}
+}
+
+// covers returns true if every address in b is also in a.
+func covers(a, b *net.IPNet) bool {
+	aIP, aOnes, aBits := prefixOf(a)
+	bIP, bOnes, bBits := prefixOf(b)
+	if aIP == nil || bIP == nil || aBits != bBits {
+		return false
+	}
+
+	return aOnes <= bOnes && a.Contains(bIP)
+}
+
+// dropCovered returns the networks in nets that are not covered by
+// another network in the list; duplicates are reduced to a single
+// entry. The input slice is not modified.
+func dropCovered(nets []*net.IPNet) []*net.IPNet {
+	var kept []*net.IPNet
+outer:
+	for i := range nets {
+		for j := range kept {
+			if covers(kept[j], nets[i]) {
+				continue outer
+			}
+		}
+
+		// Remove anything the new network covers.
+		n := 0
+		for j := range kept {
+			if !covers(nets[i], kept[j]) {
+				kept[n] = kept[j]
+				n++
+			}
+		}
+		kept = append(kept[:n], nets[i])
+	}
+	return kept
+}
+
+// sortNets sorts networks with IPv4 before IPv6, then by address,
+// then from broadest to narrowest.
+func sortNets(nets []*net.IPNet) {
+	sort.Slice(nets, func(i, j int) bool {
+		iIP, iOnes, iBits := prefixOf(nets[i])
+		jIP, jOnes, jBits := prefixOf(nets[j])
+		if iBits != jBits {
+			return iBits < jBits
+		}
+
+		if c := bytes.Compare(iIP, jIP); c != 0 {
+			return c < 0
+		}
+		return iOnes < jOnes
+	})
+}
+
+// bitAt returns the i'th bit of ip, counting from the most
+// significant bit.
+func bitAt(ip net.IP, i int) byte {
+	return (ip[i/8] >> uint(7-i%8)) & 1
+}
+
+// setBit returns a copy of ip with the i'th bit set.
+func setBit(ip net.IP, i int) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	out[i/8] |= 1 << uint(7-i%8)
+	return out
+}
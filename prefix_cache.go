@@ -0,0 +1,146 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PrefixCache caches the decisions of a BasicNet by client prefix
+// rather than by address. Clients tend to cluster in subnets, so
+// caching the decision for a whole /24 or /64 gets many more hits
+// than caching each address. A prefix is only answered from the
+// cache if every address in it gets the same decision; prefixes that
+// straddle the edge of a permitted network always go to the ACL.
+//
+// The cache is invalidated whenever the underlying ACL changes,
+// whether it is modified through the cache or directly.
+type PrefixCache struct {
+	hits   uint64 // accessed atomically; keep 64-bit aligned
+	misses uint64 // accessed atomically
+
+	acl    *BasicNet
+	v4Mask net.IPMask
+	v6Mask net.IPMask
+	ttl    time.Duration
+
+	lock    *sync.Mutex
+	clock   Clock
+	gen     uint64
+	entries map[string]prefixCacheEntry
+}
+
+type prefixCacheEntry struct {
+	permitted bool
+	uniform   bool
+	expires   time.Time
+}
+
+// NewPrefixCache returns a cache in front of acl that aggregates
+// IPv4 addresses by v4Bits-long prefixes and IPv6 addresses by
+// v6Bits-long prefixes. Cached decisions are kept for up to ttl.
+func NewPrefixCache(acl *BasicNet, v4Bits, v6Bits int, ttl time.Duration) (*PrefixCache, error) {
+	if acl == nil {
+		return nil, errors.New("netallow: ACL cannot be nil")
+	}
+
+	if v4Bits < 0 || v4Bits > 32 || v6Bits < 0 || v6Bits > 128 {
+		return nil, errors.New("netallow: invalid cache prefix length")
+	}
+
+	if ttl <= 0 {
+		return nil, errors.New("netallow: cache TTL must be positive")
+	}
+
+	return &PrefixCache{
+		acl:     acl,
+		v4Mask:  net.CIDRMask(v4Bits, 32),
+		v6Mask:  net.CIDRMask(v6Bits, 128),
+		ttl:     ttl,
+		lock:    new(sync.Mutex),
+		clock:   SystemClock,
+		entries: map[string]prefixCacheEntry{},
+	}, nil
+}
+
+// SetClock sets the clock used to expire cached decisions. A nil
+// clock selects the system clock.
+func (c *PrefixCache) SetClock(clock Clock) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clock = clockOrSystem(clock)
+}
+
+// prefix returns the cache prefix containing ip.
+func (c *PrefixCache) prefix(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4.Mask(c.v4Mask), Mask: c.v4Mask}
+	}
+	return &net.IPNet{IP: ip.Mask(c.v6Mask), Mask: c.v6Mask}
+}
+
+// Permitted returns true if the IP is permitted, answering from the
+// cache if possible.
+func (c *PrefixCache) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	prefix := c.prefix(ip)
+	key := prefix.String()
+
+	c.lock.Lock()
+	now := c.clock.Now()
+	gen := c.acl.generation()
+	if gen != c.gen {
+		c.entries = map[string]prefixCacheEntry{}
+		c.gen = gen
+	}
+
+	entry, ok := c.entries[key]
+	c.lock.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		if entry.uniform {
+			atomic.AddUint64(&c.hits, 1)
+			return entry.permitted
+		}
+
+		atomic.AddUint64(&c.misses, 1)
+		return c.acl.Permitted(ip)
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	entry.permitted, entry.uniform = c.acl.classify(prefix)
+	entry.expires = now.Add(c.ttl)
+
+	c.lock.Lock()
+	if c.gen == gen {
+		c.entries[key] = entry
+	}
+	c.lock.Unlock()
+
+	if !entry.uniform {
+		return c.acl.Permitted(ip)
+	}
+	return entry.permitted
+}
+
+// Add adds a network to the underlying ACL.
+func (c *PrefixCache) Add(n *net.IPNet) {
+	c.acl.Add(n)
+}
+
+// Remove removes a network from the underlying ACL.
+func (c *PrefixCache) Remove(n *net.IPNet) {
+	c.acl.Remove(n)
+}
+
+// Stats returns the number of cache hits and misses so far. A check
+// of an address in a prefix that straddles a permitted network
+// always counts as a miss.
+func (c *PrefixCache) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
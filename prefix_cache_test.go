@@ -0,0 +1,135 @@
+package netallow
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPrefixCache(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "192.168.1.5/32", t)
+
+	cache, err := NewPrefixCache(acl, 24, 64, time.Minute)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(cache, "10.1.2.3", t) || !checkIPString(cache, "10.1.2.4", t) {
+		t.Fatal("cache should have permitted address")
+	}
+
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("expected 1 hit and 1 miss, but have %d and %d", hits, misses)
+	}
+
+	// 192.168.1.0/24 is only partly permitted, so it mustn't be
+	// answered from the cache.
+	if !checkIPString(cache, "192.168.1.5", t) {
+		t.Fatal("cache should have permitted address")
+	}
+
+	if checkIPString(cache, "192.168.1.6", t) {
+		t.Fatal("cache should have denied address")
+	}
+
+	if checkIPString(cache, "2001:db8::1", t) || checkIPString(cache, "2001:db8::2", t) {
+		t.Fatal("cache should have denied address")
+	}
+
+	// Modifying the ACL directly invalidates the cache.
+	testAddNet(acl, "2001:db8::/32", t)
+	if !checkIPString(cache, "2001:db8::1", t) {
+		t.Fatal("cache should have permitted address")
+	}
+
+	testDelNet(cache, "10.0.0.0/8", t)
+	if checkIPString(cache, "10.1.2.3", t) {
+		t.Fatal("cache should have denied address")
+	}
+
+	if cache.Permitted(net.IP{1, 2}) {
+		t.Fatal("cache should have denied an invalid address")
+	}
+}
+
+func TestPrefixCacheTTL(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+
+	cache, err := NewPrefixCache(acl, 24, 64, time.Minute)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	cache.SetClock(clock)
+
+	checkIPString(cache, "10.1.2.3", t)
+	checkIPString(cache, "10.1.2.4", t)
+	clock.Advance(2 * time.Minute)
+	checkIPString(cache, "10.1.2.5", t)
+
+	if hits, misses := cache.Stats(); hits != 1 || misses != 2 {
+		t.Fatalf("expected 1 hit and 2 misses, but have %d and %d", hits, misses)
+	}
+}
+
+func TestPrefixCacheFails(t *testing.T) {
+	acl := NewBasicNet()
+	if _, err := NewPrefixCache(nil, 24, 64, time.Minute); err == nil {
+		t.Fatal("expected NewPrefixCache to fail with a nil ACL")
+	}
+
+	if _, err := NewPrefixCache(acl, 33, 64, time.Minute); err == nil {
+		t.Fatal("expected NewPrefixCache to fail with an invalid prefix length")
+	}
+
+	if _, err := NewPrefixCache(acl, 24, 64, 0); err == nil {
+		t.Fatal("expected NewPrefixCache to fail with a zero TTL")
+	}
+}
+
+// benchmarkPrefixCache checks addresses drawn from a small number
+// of /24 subnets against a cache with the given prefix lengths,
+// reporting the cache hit rate.
+func benchmarkPrefixCache(b *testing.B, v4Bits, v6Bits int) {
+	acl := NewBasicNet()
+	for i := 0; i < 256; i++ {
+		acl.Add(&net.IPNet{
+			IP:   net.IP{10, byte(i), 0, 0},
+			Mask: net.CIDRMask(16, 32),
+		})
+	}
+
+	cache, err := NewPrefixCache(acl, v4Bits, v6Bits, time.Hour)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	prng := rand.New(rand.NewSource(1))
+	ips := make([]net.IP, 4096)
+	for i := range ips {
+		subnet := prng.Intn(64)
+		ips[i] = net.IP{10, byte(subnet), byte(subnet), byte(prng.Intn(256))}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Permitted(ips[i%len(ips)])
+	}
+	b.StopTimer()
+
+	hits, misses := cache.Stats()
+	b.ReportMetric(float64(hits)/float64(hits+misses), "hits/op")
+}
+
+func BenchmarkPrefixCache(b *testing.B) {
+	benchmarkPrefixCache(b, 24, 64)
+}
+
+func BenchmarkPerIPCache(b *testing.B) {
+	benchmarkPrefixCache(b, 32, 128)
+}
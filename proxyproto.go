@@ -0,0 +1,152 @@
+package netallow
+
+// This file contains support for finding a client's address from a
+// PROXY protocol header, as sent by load balancers such as HAProxy.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// proxyV2Signature starts every PROXY protocol version 2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrProxyUnknown is returned for a PROXY header that doesn't carry a
+// client address: a version 1 header with the UNKNOWN transport, or
+// a version 2 header with the LOCAL command or an unsupported address
+// family. The connection's remote address is the proxy's own in this
+// case, so it shouldn't be used in its place.
+var ErrProxyUnknown = errors.New("netallow: PROXY header has no client address")
+
+// ParseProxyHeader returns the source address from a PROXY protocol
+// header, which may be either version 1 (text) or version 2
+// (binary). The header should contain only the PROXY header; any
+// bytes following it are ignored for version 2 headers, but are an
+// error for version 1.
+func ParseProxyHeader(header []byte) (net.IP, error) {
+	if bytes.HasPrefix(header, proxyV2Signature) {
+		return parseProxyV2(header)
+	}
+
+	if bytes.HasPrefix(header, []byte("PROXY ")) {
+		return parseProxyV1(header)
+	}
+
+	return nil, errors.New("netallow: not a PROXY protocol header")
+}
+
+// parseProxyV1 parses a header such as
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func parseProxyV1(header []byte) (net.IP, error) {
+	line := string(header)
+	if !strings.HasSuffix(line, "\r\n") || strings.Count(line, "\r\n") != 1 {
+		return nil, errors.New("netallow: malformed PROXY v1 header")
+	}
+
+	fields := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, ErrProxyUnknown
+	}
+
+	if len(fields) != 6 {
+		return nil, errors.New("netallow: malformed PROXY v1 header")
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, errors.New("netallow: invalid PROXY v1 source address " + fields[2])
+	}
+
+	switch fields[1] {
+	case "TCP4":
+		if ip.To4() == nil || strings.Contains(fields[2], ":") {
+			return nil, errors.New("netallow: PROXY v1 TCP4 header has a non-IPv4 source address")
+		}
+		return ip.To4(), nil
+	case "TCP6":
+		if !strings.Contains(fields[2], ":") {
+			return nil, errors.New("netallow: PROXY v1 TCP6 header has a non-IPv6 source address")
+		}
+		return ip, nil
+	default:
+		return nil, errors.New("netallow: unsupported PROXY v1 transport " + fields[1])
+	}
+}
+
+// parseProxyV2 parses a binary version 2 header.
+func parseProxyV2(header []byte) (net.IP, error) {
+	if len(header) < 16 {
+		return nil, errors.New("netallow: short PROXY v2 header")
+	}
+
+	verCmd, family := header[12], header[13]
+	if verCmd>>4 != 2 {
+		return nil, errors.New("netallow: unsupported PROXY protocol version")
+	}
+
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if len(header) < 16+length {
+		return nil, errors.New("netallow: short PROXY v2 header")
+	}
+
+	switch verCmd & 0xf {
+	case 0: // LOCAL
+		return nil, ErrProxyUnknown
+	case 1: // PROXY
+	default:
+		return nil, errors.New("netallow: unsupported PROXY v2 command")
+	}
+
+	var size int
+	switch family >> 4 {
+	case 1: // AF_INET
+		size = net.IPv4len
+	case 2: // AF_INET6
+		size = net.IPv6len
+	default:
+		return nil, ErrProxyUnknown
+	}
+
+	// The source and destination addresses are followed by the
+	// source and destination ports.
+	if length < 2*size+4 {
+		return nil, errors.New("netallow: short PROXY v2 address block")
+	}
+
+	return append(net.IP(nil), header[16:16+size]...), nil
+}
+
+// ProxyLookup is a Lookup for connections from a load balancer using
+// the PROXY protocol. Address should be passed the net.Conn and the
+// PROXY header read from it, as a []byte. If the header is empty
+// because the connection didn't send one, the connection's remote
+// address is used. The header can't be trusted unless the connection
+// is known to come from the load balancer; listeners accepting
+// connections from anywhere else should not use ProxyLookup.
+type ProxyLookup struct{}
+
+// Address returns the client address from the PROXY header, or the
+// remote address of the net.Conn if there is no header.
+func (ProxyLookup) Address(args ...interface{}) (net.IP, error) {
+	if len(args) != 2 {
+		return nil, errors.New("netallow: lookup requires a net.Conn and a PROXY header")
+	}
+
+	conn, ok := args[0].(net.Conn)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires a net.Conn")
+	}
+
+	header, ok := args[1].([]byte)
+	if !ok {
+		return nil, errors.New("netallow: lookup requires a PROXY header")
+	}
+
+	if len(header) == 0 {
+		return NetConnLookup(conn)
+	}
+	return ParseProxyHeader(header)
+}
@@ -0,0 +1,133 @@
+package netallow
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// proxyV2Header builds a version 2 header with the given command,
+// family, and address block.
+func proxyV2Header(cmd, family byte, addrs []byte) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	v4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	v6 := append(append(append([]byte(nil), net.ParseIP("2001:db8::1")...),
+		net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0x01, 0xbb)
+
+	for _, tc := range []struct {
+		header   string
+		expected string
+	}{
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1"},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "2001:db8::1"},
+		{string(proxyV2Header(1, 0x11, v4)), "192.0.2.1"},
+		{string(proxyV2Header(1, 0x21, v6)), "2001:db8::1"},
+
+		// Trailing TLVs are skipped.
+		{string(proxyV2Header(1, 0x11, append(v4, 0x04, 0, 1, 0))), "192.0.2.1"},
+	} {
+		ip, err := ParseProxyHeader([]byte(tc.header))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.header, err)
+		}
+
+		if ip.String() != tc.expected {
+			t.Fatalf("%q: expected %s, but have %s", tc.header, tc.expected, ip)
+		}
+	}
+}
+
+func TestParseProxyHeaderFails(t *testing.T) {
+	v4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+
+	for _, header := range []string{
+		"PROXY UNKNOWN\r\n",
+		"PROXY UNKNOWN 192.0.2.1 198.51.100.1 56324 443\r\n",
+		string(proxyV2Header(0, 0x11, v4)),
+		string(proxyV2Header(1, 0x00, nil)),
+	} {
+		if _, err := ParseProxyHeader([]byte(header)); err != ErrProxyUnknown {
+			t.Fatalf("%q: expected ErrProxyUnknown, but have %v", header, err)
+		}
+	}
+
+	badVersion := proxyV2Header(1, 0x11, v4)
+	badVersion[12] = 0x11
+	for _, header := range []string{
+		"",
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP6 192.0.2.1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2 198.51.100.1 56324 443\r\n",
+		"PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n",
+		string(proxyV2Signature),
+		string(proxyV2Header(1, 0x11, v4[:8])),
+		string(proxyV2Header(1, 0x11, v4)[:20]),
+		string(proxyV2Header(2, 0x11, v4)),
+		string(badVersion),
+	} {
+		_, err := ParseProxyHeader([]byte(header))
+		if err == nil || err == ErrProxyUnknown {
+			t.Fatalf("%q: expected a malformed header error, but have %v", header, err)
+		}
+	}
+}
+
+// remoteConn is a net.Conn that only reports its remote address.
+type remoteConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (conn *remoteConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
+
+func TestProxyLookup(t *testing.T) {
+	conn := &remoteConn{remote: &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 4141}}
+	header := []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+
+	var lookup Lookup = ProxyLookup{}
+	ip, err := lookup.Address(conn, header)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ip.String() != "192.0.2.1" {
+		t.Fatalf("expected the client address from the header, but have %s", ip)
+	}
+
+	ip, err = lookup.Address(conn, []byte(nil))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ip.String() != "198.51.100.7" {
+		t.Fatalf("expected the connection's remote address, but have %s", ip)
+	}
+
+	if _, err = lookup.Address(conn, []byte("PROXY UNKNOWN\r\n")); err != ErrProxyUnknown {
+		t.Fatalf("expected ErrProxyUnknown, but have %v", err)
+	}
+
+	if _, err = lookup.Address(conn); err == nil {
+		t.Fatal("Address should fail without a header")
+	}
+
+	if _, err = lookup.Address("conn", header); err == nil {
+		t.Fatal("Address should fail without a net.Conn")
+	}
+
+	if _, err = lookup.Address(conn, string(header)); err == nil {
+		t.Fatal("Address should fail when the header isn't a []byte")
+	}
+}
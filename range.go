@@ -0,0 +1,287 @@
+package netallow
+
+// This file contains an ACL of inclusive address ranges, for
+// allowlists that don't fall on CIDR boundaries.
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// IPRange is an inclusive range of addresses in a single address
+// family. IPv4 ranges use 4-byte addresses.
+type IPRange struct {
+	From net.IP
+	To   net.IP
+}
+
+// canonicalIP returns ip as a 4-byte address if it is IPv4, or as a
+// 16-byte address otherwise. It returns nil if ip isn't valid.
+func canonicalIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// NewIPRange returns the range of addresses from from to to
+// inclusive. Both addresses must be in the same family, and from
+// must not come after to.
+func NewIPRange(from, to net.IP) (IPRange, error) {
+	from, to = canonicalIP(from), canonicalIP(to)
+	if from == nil || to == nil {
+		return IPRange{}, errors.New("netallow: invalid IP address in range")
+	}
+
+	if len(from) != len(to) {
+		return IPRange{}, errors.New("netallow: range mixes IPv4 and IPv6 addresses")
+	}
+
+	if bytes.Compare(from, to) > 0 {
+		return IPRange{}, errors.New("netallow: range starts after it ends")
+	}
+
+	return IPRange{From: from, To: to}, nil
+}
+
+// ParseIPRange parses a range written as "from-to", such as
+// "192.0.2.10-192.0.2.50".
+func ParseIPRange(s string) (IPRange, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return IPRange{}, errors.New("netallow: invalid range " + s)
+	}
+
+	from := net.ParseIP(strings.TrimSpace(parts[0]))
+	to := net.ParseIP(strings.TrimSpace(parts[1]))
+	if from == nil || to == nil {
+		return IPRange{}, errors.New("netallow: invalid range " + s)
+	}
+
+	return NewIPRange(from, to)
+}
+
+// RangeFromNet returns the range of addresses in n.
+func RangeFromNet(n *net.IPNet) (IPRange, error) {
+	ip, ones, bits := prefixOf(n)
+	if ip == nil {
+		return IPRange{}, errors.New("netallow: invalid network")
+	}
+
+	return IPRange{From: ip, To: lastAddr(ip, ones, bits)}, nil
+}
+
+// RangesFromNets returns the fewest ranges covering the addresses in
+// nets, merging networks that overlap or are adjacent. IPv4 ranges
+// come before IPv6 ranges, and each family is sorted. Invalid
+// networks are skipped.
+func RangesFromNets(nets []*net.IPNet) []IPRange {
+	sorted := make([]*net.IPNet, 0, len(nets))
+	for _, n := range nets {
+		if ip, _, _ := prefixOf(n); ip != nil {
+			sorted = append(sorted, n)
+		}
+	}
+	sortNets(sorted)
+
+	var ranges []IPRange
+	for _, n := range sorted {
+		r, _ := RangeFromNet(n)
+		if len(ranges) > 0 {
+			// nextAddr wraps around after the last address, so
+			// check for that separately.
+			prev := &ranges[len(ranges)-1]
+			if len(prev.To) == len(r.From) && (isLastAddr(prev.To) ||
+				bytes.Compare(r.From, nextAddr(prev.To)) <= 0) {
+				if bytes.Compare(r.To, prev.To) > 0 {
+					prev.To = r.To
+				}
+				continue
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// String returns the range as "from-to".
+func (r IPRange) String() string {
+	return r.From.String() + "-" + r.To.String()
+}
+
+// valid returns true if r could have been returned by NewIPRange.
+func (r IPRange) valid() bool {
+	return validIP(r.From) && len(r.From) == len(r.To) &&
+		bytes.Compare(r.From, r.To) <= 0
+}
+
+// Contains returns true if ip is in the range.
+func (r IPRange) Contains(ip net.IP) bool {
+	ip = canonicalIP(ip)
+	if ip == nil || !r.valid() || len(ip) != len(r.From) {
+		return false
+	}
+
+	return bytes.Compare(r.From, ip) <= 0 && bytes.Compare(ip, r.To) <= 0
+}
+
+// Nets returns the fewest networks that together cover exactly the
+// addresses in the range, in order. For example, 192.0.2.10-192.0.2.20
+// is 192.0.2.10/31, 192.0.2.12/30, 192.0.2.16/30, and 192.0.2.20/32.
+func (r IPRange) Nets() []*net.IPNet {
+	if !r.valid() {
+		return nil
+	}
+
+	bits := len(r.From) * 8
+	start := r.From
+	var nets []*net.IPNet
+	for {
+		// Take the largest network starting at start that
+		// doesn't run past the end of the range.
+		ones := bits
+		for ones > 0 && bitAt(start, ones-1) == 0 &&
+			bytes.Compare(lastAddr(start, ones-1, bits), r.To) <= 0 {
+			ones--
+		}
+
+		last := lastAddr(start, ones, bits)
+		nets = append(nets, &net.IPNet{IP: start, Mask: net.CIDRMask(ones, bits)})
+		if bytes.Equal(last, r.To) {
+			return nets
+		}
+		start = nextAddr(last)
+	}
+}
+
+// lastAddr returns the last address in the network ip/ones.
+func lastAddr(ip net.IP, ones, bits int) net.IP {
+	mask := net.CIDRMask(ones, bits)
+	out := make(net.IP, len(ip))
+	for i := range ip {
+		out[i] = ip[i] | ^mask[i]
+	}
+	return out
+}
+
+// nextAddr returns the address after ip, wrapping around at the end
+// of the address space.
+func nextAddr(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+		if out[i] != 0 {
+			break
+		}
+	}
+	return out
+}
+
+// isLastAddr returns true if ip is the last address in its family.
+func isLastAddr(ip net.IP) bool {
+	for i := range ip {
+		if ip[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// RangeNet implements an ACL of address ranges using locks for
+// concurrency. Like BasicNet, checks compare the address against
+// every range in turn. It must be initialised with NewRangeNet.
+type RangeNet struct {
+	lock   *sync.RWMutex
+	ranges []IPRange
+}
+
+// NewRangeNet constructs a new, empty range ACL.
+func NewRangeNet() *RangeNet {
+	return &RangeNet{
+		lock: new(sync.RWMutex),
+	}
+}
+
+// Permitted returns true if the IP is in one of the ACL's ranges.
+func (acl *RangeNet) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	for i := range acl.ranges {
+		if acl.ranges[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add permits the addresses in the range. Invalid ranges are
+// ignored, as is a range that is already in the ACL.
+func (acl *RangeNet) Add(r IPRange) {
+	r, err := NewIPRange(r.From, r.To)
+	if err != nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	if acl.index(r) < 0 {
+		acl.ranges = append(acl.ranges, r)
+	}
+}
+
+// Remove drops the range from the ACL. As with BasicNet, the range
+// must match one that was added exactly; it won't shrink or split a
+// range that contains it.
+func (acl *RangeNet) Remove(r IPRange) {
+	r, err := NewIPRange(r.From, r.To)
+	if err != nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	if i := acl.index(r); i >= 0 {
+		acl.ranges = append(acl.ranges[:i], acl.ranges[i+1:]...)
+	}
+}
+
+// index returns the position of r in the ACL, or -1. The caller must
+// hold the lock.
+func (acl *RangeNet) index(r IPRange) int {
+	for i := range acl.ranges {
+		if acl.ranges[i].From.Equal(r.From) && acl.ranges[i].To.Equal(r.To) {
+			return i
+		}
+	}
+	return -1
+}
+
+// List returns the ranges in the ACL, in the order they were added.
+func (acl *RangeNet) List() []IPRange {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+
+	ranges := make([]IPRange, len(acl.ranges))
+	copy(ranges, acl.ranges)
+	return ranges
+}
+
+// Nets returns the networks covering the ACL's ranges, as a network
+// ACL permitting the same addresses.
+func (acl *RangeNet) Nets() *BasicNet {
+	out := NewBasicNet()
+	for _, r := range acl.List() {
+		for _, n := range r.Nets() {
+			out.Add(n)
+		}
+	}
+	return out
+}
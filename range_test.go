@@ -0,0 +1,147 @@
+package netallow
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	for in, expected := range map[string]string{
+		"192.0.2.10-192.0.2.50":      "192.0.2.10-192.0.2.50",
+		" 192.0.2.10 - 192.0.2.10 ":  "192.0.2.10-192.0.2.10",
+		"::ffff:192.0.2.1-192.0.2.9": "192.0.2.1-192.0.2.9",
+		"2001:db8::1-2001:db8::ff":   "2001:db8::1-2001:db8::ff",
+	} {
+		r, err := ParseIPRange(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+
+		if r.String() != expected {
+			t.Fatalf("%q: expected %s, but have %s", in, expected, r)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"192.0.2.10",
+		"192.0.2.50-192.0.2.10",
+		"192.0.2.1-2001:db8::1",
+		"192.0.2.1-192.0.2.2-192.0.2.3",
+		"192.0.2.1-example.com",
+		"2001:db8::ff-2001:db8::1",
+	} {
+		if _, err := ParseIPRange(in); err == nil {
+			t.Fatalf("ParseIPRange should reject %q", in)
+		}
+	}
+}
+
+func testRangeNets(t *testing.T, r IPRange) string {
+	var nets []string
+	for _, n := range r.Nets() {
+		nets = append(nets, n.String())
+	}
+	return strings.Join(nets, ",")
+}
+
+func TestIPRangeNets(t *testing.T) {
+	for in, expected := range map[string]string{
+		"192.0.2.10-192.0.2.20":                      "192.0.2.10/31,192.0.2.12/30,192.0.2.16/30,192.0.2.20/32",
+		"192.0.2.0-192.0.2.255":                      "192.0.2.0/24",
+		"192.0.2.7-192.0.2.7":                        "192.0.2.7/32",
+		"0.0.0.0-255.255.255.255":                    "0.0.0.0/0",
+		"10.0.0.255-10.0.1.0":                        "10.0.0.255/32,10.0.1.0/32",
+		"2001:db8::-2001:db8::2":                     "2001:db8::/127,2001:db8::2/128",
+		"::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff": "::/0",
+	} {
+		r, err := ParseIPRange(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+
+		if have := testRangeNets(t, r); have != expected {
+			t.Fatalf("%s: expected %s, but have %s", in, expected, have)
+		}
+
+		// Converting back should give the same range.
+		ranges := RangesFromNets(r.Nets())
+		if len(ranges) != 1 || ranges[0].String() != r.String() {
+			t.Fatalf("%s: round trip gave %v", in, ranges)
+		}
+	}
+
+	if (IPRange{From: net.IP{10, 0, 0, 2}, To: net.IP{10, 0, 0, 1}}).Nets() != nil {
+		t.Fatal("an invalid range shouldn't have any networks")
+	}
+}
+
+func TestRangesFromNets(t *testing.T) {
+	nets := []*net.IPNet{
+		mustParseNet(t, "2001:db8::/32"),
+		mustParseNet(t, "10.0.1.0/24"),
+		mustParseNet(t, "10.0.0.0/24"),
+		mustParseNet(t, "10.0.0.128/25"),
+		mustParseNet(t, "10.0.3.0/24"),
+		nil,
+	}
+
+	var have []string
+	for _, r := range RangesFromNets(nets) {
+		have = append(have, r.String())
+	}
+
+	expected := "10.0.0.0-10.0.1.255,10.0.3.0-10.0.3.255,2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"
+	if strings.Join(have, ",") != expected {
+		t.Fatalf("expected %s, but have %v", expected, have)
+	}
+}
+
+func TestRangeNet(t *testing.T) {
+	acl := NewRangeNet()
+	for _, s := range []string{"192.0.2.10-192.0.2.50", "2001:db8::10-2001:db8::20"} {
+		r, err := ParseIPRange(s)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		acl.Add(r)
+		acl.Add(r)
+	}
+
+	// Invalid ranges are ignored.
+	acl.Add(IPRange{From: net.IP{10, 0, 0, 2}, To: net.IP{10, 0, 0, 1}})
+	acl.Add(IPRange{})
+	if len(acl.List()) != 2 {
+		t.Fatalf("expected 2 ranges, but have %v", acl.List())
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.0.2.9":         false,
+		"192.0.2.10":        true,
+		"192.0.2.33":        true,
+		"::ffff:192.0.2.50": true,
+		"192.0.2.51":        false,
+		"2001:db8::10":      true,
+		"2001:db8::21":      false,
+		"2001:db8::1:10":    false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if !acl.Nets().Permitted(net.ParseIP("192.0.2.50")) || acl.Nets().Permitted(net.ParseIP("192.0.2.51")) {
+		t.Fatal("network ACL should permit the same addresses")
+	}
+
+	r, _ := ParseIPRange("192.0.2.10-192.0.2.50")
+	acl.Remove(r)
+	if checkIPString(acl, "192.0.2.10", t) || len(acl.List()) != 1 {
+		t.Fatal("range should have been removed")
+	}
+
+	if acl.Permitted(net.IP{0, 0}) {
+		t.Fatal("invalid addresses shouldn't be permitted")
+	}
+}
@@ -0,0 +1,74 @@
+package netallow
+
+// This file contains support for replacing the contents of an ACL
+// from a file while it is in use.
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// ReloadFromFile replaces the contents of the ACL with the addresses
+// in the file at path, which is in the format read by LoadBasic. The
+// file is parsed before the ACL is touched, and the new contents are
+// swapped in at once, so checks never see a partially loaded ACL. If
+// the file can't be read or parsed, the ACL is left unchanged.
+// Sources recorded with AddFromSource are discarded.
+func (acl *Basic) ReloadFromFile(path string) error {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := LoadBasic(in)
+	if err != nil {
+		return err
+	}
+
+	acl.replace(fresh)
+	return nil
+}
+
+// replace swaps in the contents of fresh, which must not be in use
+// elsewhere, discarding any recorded sources.
+func (acl *Basic) replace(fresh *Basic) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed = fresh.allowed
+	acl.sources = nil
+	acl.updateSingle()
+	acl.notifyReset()
+}
+
+// ReloadFromFile replaces the contents of the ACL with the networks
+// in the file at path, which has one network in CIDR notation per
+// line; a bare IP address is treated as a single-host network. Blank
+// lines and lines starting with '#' are skipped. As with Basic, the
+// new networks are swapped in at once, and the ACL is left unchanged
+// if the file can't be read or parsed.
+func (acl *BasicNet) ReloadFromFile(path string) error {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fresh := NewBasicNet()
+	for _, line := range strings.Split(string(in), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		n, err := parseNet(line)
+		if err != nil {
+			return err
+		}
+		fresh.Add(n)
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.allowed = fresh.allowed
+	acl.changed()
+	return nil
+}
@@ -0,0 +1,131 @@
+package netallow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes contents to a file named name in dir, and
+// returns its path.
+func writeTestFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return path
+}
+
+func TestBasicReloadFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netallow")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+	acl.AddFromSource(mustParseIP(t, "192.0.2.9"), "feed")
+
+	var resets int
+	cancel := acl.Subscribe(func(c Change) {
+		if c.Op == ChangeReset {
+			resets++
+		}
+	})
+	defer cancel()
+
+	path := writeTestFile(t, dir, "hosts", "# hosts\n192.0.2.2\n2001:db8::1\n")
+	if err = acl.ReloadFromFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":   false,
+		"192.0.2.2":   true,
+		"192.0.2.9":   false,
+		"2001:db8::1": true,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if resets != 2 {
+		t.Fatalf("expected subscribers to be sent a reset, have %d resets", resets)
+	}
+
+	if len(acl.Sources(mustParseIP(t, "192.0.2.2"))) != 0 {
+		t.Fatal("reloaded addresses shouldn't have sources")
+	}
+
+	// A file that fails to parse leaves the ACL as it was.
+	path = writeTestFile(t, dir, "bad", "192.0.2.3\n192.0.2\n")
+	if err = acl.ReloadFromFile(path); err == nil {
+		t.Fatal("ReloadFromFile should fail on an invalid address")
+	}
+
+	if err = acl.ReloadFromFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("ReloadFromFile should fail on a missing file")
+	}
+
+	if !checkIPString(acl, "192.0.2.2", t) || checkIPString(acl, "192.0.2.3", t) {
+		t.Fatal("a failed reload shouldn't change the ACL")
+	}
+
+	// The single-entry fast path must follow a reload.
+	path = writeTestFile(t, dir, "one", "192.0.2.4\n")
+	if err = acl.ReloadFromFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(acl, "192.0.2.4", t) || checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("ACL doesn't match the reloaded file")
+	}
+}
+
+func TestBasicNetReloadFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netallow")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	acl := NewBasicNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	gen := acl.generation()
+
+	path := writeTestFile(t, dir, "nets", "# networks\n\n192.168.0.0/16\n192.168.1.0/24\n203.0.113.5\n")
+	if err = acl.ReloadFromFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.generation() == gen {
+		t.Fatal("a reload should change the ACL's generation")
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":    false,
+		"192.168.7.1": true,
+		"203.0.113.5": true,
+		"203.0.113.6": false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if acl.Count() != 2 {
+		t.Fatalf("expected 2 networks, but have %d", acl.Count())
+	}
+
+	path = writeTestFile(t, dir, "bad", "172.16.0.0/12\n172.16.0.0/33\n")
+	if err = acl.ReloadFromFile(path); err == nil {
+		t.Fatal("ReloadFromFile should fail on an invalid network")
+	}
+
+	if !checkIPString(acl, "192.168.7.1", t) || checkIPString(acl, "172.16.0.1", t) {
+		t.Fatal("a failed reload shouldn't change the ACL")
+	}
+}
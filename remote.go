@@ -0,0 +1,213 @@
+package netallow
+
+// This file contains an ACL that asks a remote policy service for
+// its decisions.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RemoteDecision is the response a RemoteACL expects from its policy
+// service.
+type RemoteDecision struct {
+	Permitted bool `json:"permitted"`
+}
+
+// DefaultRemoteTimeout bounds each request a RemoteACL makes to its
+// policy service, unless changed with SetTimeout.
+const DefaultRemoteTimeout = 5 * time.Second
+
+// The circuit breaker settings for a RemoteACL made by NewRemoteACL.
+const (
+	// DefaultRemoteThreshold is the number of consecutive failed
+	// requests after which the policy service isn't asked.
+	DefaultRemoteThreshold = 5
+
+	// DefaultRemoteCooldown is how long the policy service isn't
+	// asked for after it has failed DefaultRemoteThreshold times.
+	DefaultRemoteCooldown = 10 * time.Second
+)
+
+// RemoteACL is an ACL whose decisions are made by a remote policy
+// service. For each address it makes a GET request to the endpoint
+// with the address in the ip query parameter, expecting a 200
+// response with a JSON-encoded RemoteDecision. If the service can't
+// be reached or gives any other response, the request has failed.
+//
+// The requests are made through a Breaker: decisions are cached for
+// the configured TTL, concurrent checks for an address that isn't
+// cached share a single request, and stale decisions may be served
+// while the service is slow or down. Addresses without a usable
+// decision get the failure policy's decision: a RemoteACL that fails
+// open permits the address, and one that fails closed denies it.
+// Failed requests aren't cached.
+type RemoteACL struct {
+	endpoint *url.URL
+	breaker  *Breaker
+
+	lock   *sync.Mutex
+	client *http.Client
+}
+
+// NewRemoteACL returns a RemoteACL asking the policy service at
+// endpoint, caching its decisions for ttl. If failOpen is true,
+// addresses are permitted when the service fails. Requests are
+// bounded by DefaultRemoteTimeout, up to DefaultCacheSize decisions
+// are cached, stale decisions aren't served, and the service isn't
+// asked for DefaultRemoteCooldown after DefaultRemoteThreshold
+// consecutive failures; NewRemoteACLWithBreaker allows these to be
+// chosen.
+func NewRemoteACL(endpoint string, ttl time.Duration, failOpen bool) (*RemoteACL, error) {
+	if ttl < 0 {
+		return nil, errors.New("netallow: remote ACL TTL cannot be negative")
+	}
+
+	return NewRemoteACLWithBreaker(endpoint, BreakerConfig{
+		Timeout:   DefaultRemoteTimeout,
+		TTL:       ttl,
+		Threshold: DefaultRemoteThreshold,
+		Cooldown:  DefaultRemoteCooldown,
+		FailOpen:  failOpen,
+	})
+}
+
+// NewRemoteACLWithBreaker returns a RemoteACL asking the policy
+// service at endpoint, with its requests made through a Breaker
+// configured by cfg.
+func NewRemoteACLWithBreaker(endpoint string, cfg BreakerConfig) (*RemoteACL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("netallow: remote ACL endpoint must be an HTTP URL")
+	}
+
+	acl := &RemoteACL{
+		endpoint: u,
+		lock:     new(sync.Mutex),
+		client:   http.DefaultClient,
+	}
+
+	acl.breaker, err = NewBreaker(acl.ask, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// SetCacheLimits bounds the decision cache to size decisions, evicting
+// the least recently used decision to make room for a new one; a
+// size of 0 removes the bound. Permitted addresses are cached for
+// allowTTL and denied ones for denyTTL, so that, for example, a
+// scanner's repeated attempts can be denied from the cache for
+// longer than an allowed client's decision is trusted. A TTL of 0
+// disables caching of those decisions.
+func (acl *RemoteACL) SetCacheLimits(size int, allowTTL, denyTTL time.Duration) error {
+	if size < 0 || allowTTL < 0 || denyTTL < 0 {
+		return errors.New("netallow: cache limits cannot be negative")
+	}
+
+	acl.breaker.setCacheLimits(size, allowTTL, denyTTL)
+	return nil
+}
+
+// CacheStats returns the decision cache's counters.
+func (acl *RemoteACL) CacheStats() CacheStats {
+	return acl.breaker.CacheStats()
+}
+
+// BreakerStats returns the state and counters of the circuit breaker
+// in front of the policy service.
+func (acl *RemoteACL) BreakerStats() BreakerStats {
+	return acl.breaker.Stats()
+}
+
+// SetClient sets the HTTP client used to reach the policy service.
+// A nil client selects http.DefaultClient.
+func (acl *RemoteACL) SetClient(client *http.Client) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.client = client
+}
+
+// SetTimeout bounds each request to the policy service, which must
+// take a positive time. A request is shared by every check waiting
+// on the same address, so it isn't cancelled by any one check's
+// context; it is only bounded by this timeout.
+func (acl *RemoteACL) SetTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("netallow: remote ACL timeout must be positive")
+	}
+
+	acl.breaker.setTimeout(timeout)
+	return nil
+}
+
+// SetClock sets the clock used for cache expiry and the breaker's
+// cooldown. A nil clock selects the system clock.
+func (acl *RemoteACL) SetClock(clock Clock) {
+	acl.breaker.SetClock(clock)
+}
+
+// ask makes a request to the policy service for the IP.
+func (acl *RemoteACL) ask(ctx context.Context, ip net.IP) (bool, error) {
+	acl.lock.Lock()
+	client := acl.client
+	acl.lock.Unlock()
+
+	u := *acl.endpoint
+	q := u.Query()
+	q.Set("ip", ip.String())
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("netallow: policy service returned %s", resp.Status)
+	}
+
+	var decision RemoteDecision
+	if err = json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, err
+	}
+	return decision.Permitted, nil
+}
+
+// PermittedCtx returns the decision for the IP from the breaker,
+// asking the policy service if no cached decision is usable. The
+// request is shared, so it runs with the ACL's timeout (see
+// SetTimeout) rather than ctx; ctx only bounds how long this check
+// waits for it. If the service fails, or ctx is done first, the
+// error is returned along with the failure policy's decision.
+func (acl *RemoteACL) PermittedCtx(ctx context.Context, ip net.IP) (bool, error) {
+	return acl.breaker.PermittedCtx(ctx, ip)
+}
+
+// Permitted returns the decision for the IP.
+func (acl *RemoteACL) Permitted(ip net.IP) bool {
+	permitted, _ := acl.PermittedCtx(context.Background(), ip)
+	return permitted
+}
@@ -0,0 +1,351 @@
+package netallow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPolicyServer answers RemoteACL requests from a fixed set of
+// decisions, counting the requests made for each address. Addresses
+// it has no decision for get a 500. If block is set, responses wait
+// until it is closed.
+type testPolicyServer struct {
+	lock      sync.Mutex
+	decisions map[string]bool
+	requests  map[string]int
+	block     chan struct{}
+}
+
+func (s *testPolicyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ip := req.URL.Query().Get("ip")
+	s.lock.Lock()
+	s.requests[ip]++
+	permitted, ok := s.decisions[ip]
+	block := s.block
+	s.lock.Unlock()
+
+	if block != nil {
+		<-block
+	}
+
+	if !ok {
+		http.Error(w, "no decision", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, `{"permitted": %v}`, permitted)
+}
+
+func (s *testPolicyServer) count(ip string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[ip]
+}
+
+func newTestPolicyServer() (*testPolicyServer, *httptest.Server) {
+	policy := &testPolicyServer{
+		decisions: map[string]bool{
+			"192.0.2.1":   true,
+			"192.0.2.2":   false,
+			"2001:db8::1": true,
+		},
+		requests: map[string]int{},
+	}
+	return policy, httptest.NewServer(policy)
+}
+
+func TestRemoteACL(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+
+	acl, err := NewRemoteACL(srv.URL+"/check?svc=test", time.Minute, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	acl.SetClock(clock)
+
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":   true,
+		"192.0.2.2":   false,
+		"2001:db8::1": true,
+		"192.0.2.3":   false,
+	} {
+		for i := 0; i < 3; i++ {
+			if checkIPString(acl, addr, t) != expected {
+				t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+			}
+		}
+	}
+
+	// Decisions are cached, but failures aren't.
+	if policy.count("192.0.2.1") != 1 || policy.count("192.0.2.2") != 1 {
+		t.Fatal("decisions should have been cached")
+	}
+
+	if policy.count("192.0.2.3") != 3 {
+		t.Fatal("failed requests shouldn't be cached")
+	}
+
+	clock.Advance(time.Minute)
+	checkIPString(acl, "192.0.2.1", t)
+	if policy.count("192.0.2.1") != 2 {
+		t.Fatal("expired decisions should be asked for again")
+	}
+}
+
+func TestRemoteACLFlood(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+	policy.block = make(chan struct{})
+
+	acl, err := NewRemoteACL(srv.URL, time.Minute, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ip := mustParseIP(t, "192.0.2.2")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if acl.Permitted(ip) {
+				t.Error("scanner should have been denied")
+			}
+		}()
+	}
+
+	waitFor(t, "the first request", func() bool { return policy.count("192.0.2.2") > 0 })
+	close(policy.block)
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		acl.Permitted(ip)
+	}
+
+	if n := policy.count("192.0.2.2"); n != 1 {
+		t.Fatalf("expected one upstream request, but have %d", n)
+	}
+
+	stats := acl.CacheStats()
+	if stats.Hits < 50 || stats.Hits+stats.Misses != 100 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRemoteACLCacheLimits(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+
+	acl, err := NewRemoteACL(srv.URL, time.Minute, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	acl.SetClock(clock)
+	if err := acl.SetCacheLimits(1, time.Minute, time.Hour); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	checkIPString(acl, "192.0.2.1", t)
+	checkIPString(acl, "192.0.2.2", t)
+	checkIPString(acl, "192.0.2.1", t)
+	if policy.count("192.0.2.1") != 2 {
+		t.Fatal("a full cache should have evicted the older decision")
+	}
+
+	// Denials are cached for longer than allowed addresses.
+	checkIPString(acl, "192.0.2.2", t)
+	clock.Advance(2 * time.Minute)
+	checkIPString(acl, "192.0.2.2", t)
+	if policy.count("192.0.2.2") != 2 {
+		t.Fatal("expected the deny decision to have been asked for twice")
+	}
+
+	if err := acl.SetCacheLimits(-1, time.Minute, time.Minute); err == nil {
+		t.Fatal("SetCacheLimits should reject a negative size")
+	}
+}
+
+func TestRemoteACLFailure(t *testing.T) {
+	_, srv := newTestPolicyServer()
+	srv.Close()
+
+	for _, failOpen := range []bool{false, true} {
+		acl, err := NewRemoteACL(srv.URL, time.Minute, failOpen)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		permitted, err := acl.PermittedCtx(context.Background(), mustParseIP(t, "192.0.2.1"))
+		if err == nil {
+			t.Fatal("expected an error when the service is down")
+		}
+
+		if permitted != failOpen {
+			t.Fatalf("expected the failure policy's decision %v, but have %v", failOpen, permitted)
+		}
+	}
+
+	for _, endpoint := range []string{"", "ftp://example.com/", "http://[::1"} {
+		if _, err := NewRemoteACL(endpoint, time.Minute, false); err == nil {
+			t.Fatalf("NewRemoteACL should reject %q", endpoint)
+		}
+	}
+}
+
+func TestRemoteACLHandler(t *testing.T) {
+	_, srv := newTestPolicyServer()
+	defer srv.Close()
+
+	acl, err := NewRemoteACL(srv.URL, time.Minute, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for remote, expected := range map[string]string{
+		"192.0.2.1:4141": "OK",
+		"192.0.2.2:4141": "NO",
+		"192.0.2.3:4141": "NO",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("%s: expected %s, but got %s", remote, expected, w.Body.String())
+		}
+	}
+}
+
+func TestRemoteACLCancelledCaller(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+	policy.block = make(chan struct{})
+
+	// Failing open makes a failed check distinguishable from the
+	// service's decision to deny the address.
+	acl, err := NewRemoteACL(srv.URL, time.Minute, true)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ip := mustParseIP(t, "192.0.2.2")
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := acl.PermittedCtx(ctx, ip)
+		first <- err
+	}()
+	waitFor(t, "the first request", func() bool { return policy.count("192.0.2.2") > 0 })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			permitted, err := acl.PermittedCtx(context.Background(), ip)
+			if err != nil || permitted {
+				t.Errorf("expected the service's decision, have (%v, %v)", permitted, err)
+			}
+		}()
+	}
+
+	// The first caller giving up doesn't cancel the shared request.
+	cancel()
+	if err = <-first; err != context.Canceled {
+		t.Fatalf("expected the first caller to be cancelled, have %v", err)
+	}
+
+	close(policy.block)
+	wg.Wait()
+
+	if n := policy.count("192.0.2.2"); n != 1 {
+		t.Fatalf("expected one upstream request, but have %d", n)
+	}
+}
+
+func TestRemoteACLTimeout(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+	policy.block = make(chan struct{})
+	defer close(policy.block)
+
+	acl, err := NewRemoteACL(srv.URL, time.Minute, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = acl.SetTimeout(0); err == nil {
+		t.Fatal("expected an error for a zero timeout")
+	}
+
+	if err = acl.SetTimeout(50 * time.Millisecond); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	permitted, err := acl.PermittedCtx(context.Background(), mustParseIP(t, "192.0.2.1"))
+	if err == nil || permitted {
+		t.Fatalf("expected the request to time out and fail closed, have (%v, %v)", permitted, err)
+	}
+}
+
+func TestRemoteACLBreaker(t *testing.T) {
+	policy, srv := newTestPolicyServer()
+	defer srv.Close()
+
+	acl, err := NewRemoteACLWithBreaker(srv.URL, BreakerConfig{
+		Timeout:   time.Second,
+		TTL:       time.Minute,
+		MaxStale:  time.Hour,
+		Threshold: 1,
+		Cooldown:  time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	acl.SetClock(clock)
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("expected the service's decision to be used")
+	}
+
+	// Once the service fails, the stale decision is served while
+	// it is asked again, and the breaker opens.
+	policy.lock.Lock()
+	delete(policy.decisions, "192.0.2.1")
+	policy.lock.Unlock()
+	clock.Advance(2 * time.Minute)
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("expected the stale decision to be served")
+	}
+	waitFor(t, "the breaker to open", func() bool {
+		return acl.BreakerStats().State == BreakerOpen
+	})
+
+	// While the breaker is open, the service isn't asked.
+	if checkIPString(acl, "192.0.2.2", t) {
+		t.Fatal("expected the failure policy's decision")
+	}
+
+	if n := policy.count("192.0.2.2"); n != 0 {
+		t.Fatalf("expected no requests while the breaker is open, but have %d", n)
+	}
+
+	if stats := acl.BreakerStats(); stats.Stale != 1 || stats.Defaulted != 1 {
+		t.Fatalf("unexpected breaker stats %+v", stats)
+	}
+}
@@ -0,0 +1,170 @@
+package netallow
+
+// This file contains change notification for host ACLs, and a
+// read-only replica ACL built on it, for applications where one
+// component owns an ACL and others only read it.
+
+import (
+	"net"
+	"sync"
+)
+
+// ChangeOp is the kind of change made to a host ACL.
+type ChangeOp int
+
+const (
+	// ChangeAdd means the address is now permitted.
+	ChangeAdd ChangeOp = iota
+
+	// ChangeRemove means the address is no longer permitted.
+	ChangeRemove
+
+	// ChangeReset means the permitted addresses were replaced by
+	// those in the change's Snapshot.
+	ChangeReset
+)
+
+// A Change describes a modification to a host ACL.
+type Change struct {
+	Op ChangeOp
+
+	// IP is the address that was added or removed.
+	IP net.IP
+
+	// Snapshot holds every permitted address for a reset.
+	Snapshot []net.IP
+}
+
+// A Publisher delivers the changes made to an ACL to subscribers.
+type Publisher interface {
+	// Subscribe calls fn with a reset holding the current
+	// contents of the ACL, and then with each change as it is
+	// made, until cancel is called. Changes are delivered in
+	// order.
+	Subscribe(fn func(Change)) (cancel func())
+}
+
+type listener struct {
+	id int
+	fn func(Change)
+}
+
+// Subscribe implements the Publisher interface. The listener is
+// called while the ACL is locked, so it must not call back into the
+// ACL, and should return quickly.
+func (acl *Basic) Subscribe(fn func(Change)) (cancel func()) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.nextListener++
+	id := acl.nextListener
+	acl.listeners = append(acl.listeners, listener{id: id, fn: fn})
+	fn(acl.resetChange())
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			acl.lock.Lock()
+			defer acl.lock.Unlock()
+			for i := range acl.listeners {
+				if acl.listeners[i].id == id {
+					acl.listeners = append(acl.listeners[:i], acl.listeners[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// resetChange returns a reset holding the permitted addresses. The
+// caller must hold the lock.
+func (acl *Basic) resetChange() Change {
+	change := Change{Op: ChangeReset}
+	for addr, enabled := range acl.allowed {
+		if enabled {
+			change.Snapshot = append(change.Snapshot, net.ParseIP(addr))
+		}
+	}
+	return change
+}
+
+// notify delivers a change to the listeners. The caller must hold
+// the lock.
+func (acl *Basic) notify(op ChangeOp, addr string) {
+	if len(acl.listeners) == 0 {
+		return
+	}
+
+	change := Change{Op: op, IP: net.ParseIP(addr)}
+	for _, l := range acl.listeners {
+		l.fn(change)
+	}
+}
+
+// notifyReset delivers a reset to the listeners. The caller must
+// hold the lock.
+func (acl *Basic) notifyReset() {
+	if len(acl.listeners) == 0 {
+		return
+	}
+
+	change := acl.resetChange()
+	for _, l := range acl.listeners {
+		l.fn(change)
+	}
+}
+
+// ReplicaACL is a read-only copy of a host ACL that is kept up to
+// date by subscribing to the primary's changes. Changes are applied
+// as the primary makes them, so the replica never lags behind, and
+// checks only take a read lock on the replica rather than contending
+// with writers on the primary.
+type ReplicaACL struct {
+	lock    *sync.RWMutex
+	allowed map[string]bool
+	cancel  func()
+}
+
+// NewReplicaACL returns a replica of the primary's ACL.
+func NewReplicaACL(primary Publisher) *ReplicaACL {
+	r := &ReplicaACL{
+		lock:    new(sync.RWMutex),
+		allowed: map[string]bool{},
+	}
+	r.cancel = primary.Subscribe(r.apply)
+	return r
+}
+
+// apply applies a change from the primary.
+func (r *ReplicaACL) apply(change Change) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch change.Op {
+	case ChangeAdd:
+		r.allowed[change.IP.String()] = true
+	case ChangeRemove:
+		delete(r.allowed, change.IP.String())
+	case ChangeReset:
+		r.allowed = make(map[string]bool, len(change.Snapshot))
+		for _, ip := range change.Snapshot {
+			r.allowed[ip.String()] = true
+		}
+	}
+}
+
+// Permitted returns true if the primary permitted the IP as of its
+// last change.
+func (r *ReplicaACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.allowed[ip.String()]
+}
+
+// Close stops the replica following the primary; it keeps the
+// addresses it had.
+func (r *ReplicaACL) Close() {
+	r.cancel()
+}
@@ -0,0 +1,77 @@
+package netallow
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// testReplicaMatches checks that the replica permits the same
+// addresses as the primary.
+func testReplicaMatches(primary *Basic, replica *ReplicaACL, t *testing.T) {
+	for i := 1; i <= 10; i++ {
+		addr := fmt.Sprintf("10.0.0.%d", i)
+		if checkIPString(primary, addr, t) != checkIPString(replica, addr, t) {
+			t.Fatalf("replica disagrees with primary on %s", addr)
+		}
+	}
+}
+
+func TestReplicaACL(t *testing.T) {
+	primary := NewBasic()
+	addIPString(primary, "10.0.0.1", t)
+	addIPString(primary, "10.0.0.2", t)
+
+	// The replica starts with the primary's contents.
+	replica := NewReplicaACL(primary)
+	testReplicaMatches(primary, replica, t)
+
+	addIPString(primary, "10.0.0.3", t)
+	delIPString(primary, "10.0.0.1", t)
+	primary.Disable(mustParseIP(t, "10.0.0.2"))
+	primary.AddFromSource(mustParseIP(t, "10.0.0.4"), "feed")
+	testReplicaMatches(primary, replica, t)
+	if !checkIPString(replica, "10.0.0.3", t) || checkIPString(replica, "10.0.0.2", t) {
+		t.Fatal("replica should have followed the primary's changes")
+	}
+
+	primary.Enable(mustParseIP(t, "10.0.0.2"))
+	primary.RemoveBySource("feed")
+	testReplicaMatches(primary, replica, t)
+
+	if err := json.Unmarshal([]byte(`"10.0.0.7,!10.0.0.8"`), primary); err != nil {
+		t.Fatalf("%v", err)
+	}
+	testReplicaMatches(primary, replica, t)
+	if !checkIPString(replica, "10.0.0.7", t) || checkIPString(replica, "10.0.0.3", t) {
+		t.Fatal("replica should have been reset with the primary")
+	}
+
+	// After closing, the replica keeps its contents but stops
+	// following.
+	replica.Close()
+	replica.Close()
+	addIPString(primary, "10.0.0.9", t)
+	if checkIPString(replica, "10.0.0.9", t) || !checkIPString(replica, "10.0.0.7", t) {
+		t.Fatal("closed replica should not follow the primary")
+	}
+}
+
+func TestBasicSubscribers(t *testing.T) {
+	acl := NewBasic()
+	var first, second []Change
+	cancel := acl.Subscribe(func(c Change) { first = append(first, c) })
+	acl.Subscribe(func(c Change) { second = append(second, c) })
+
+	addIPString(acl, "10.0.0.1", t)
+	cancel()
+	delIPString(acl, "10.0.0.1", t)
+
+	if len(first) != 2 || first[0].Op != ChangeReset || first[1].Op != ChangeAdd {
+		t.Fatalf("unexpected changes %+v", first)
+	}
+
+	if len(second) != 3 || second[2].Op != ChangeRemove || second[2].IP.String() != "10.0.0.1" {
+		t.Fatalf("unexpected changes %+v", second)
+	}
+}
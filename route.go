@@ -0,0 +1,112 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RouteACL chooses an ACL by the request's URL path, so that, for
+// example, admin endpoints can have a stricter ACL than public ones
+// behind a single Handler. Each route is a path prefix; the longest
+// prefix matching the path wins, and paths no route matches are
+// checked against the default ACL. Prefixes match whole path
+// segments: "/admin" matches "/admin" and "/admin/users" but not
+// "/administrator".
+//
+// A RouteACL only routes requests when used with a Handler. Checks
+// made with Permitted alone have no path and use the default ACL.
+type RouteACL struct {
+	lock   *sync.RWMutex
+	def    ACL
+	routes map[string]ACL
+}
+
+// NewRouteACL returns a RouteACL with no routes. Paths that no route
+// matches are checked against def; if def is nil, they are denied.
+func NewRouteACL(def ACL) *RouteACL {
+	return &RouteACL{
+		lock:   new(sync.RWMutex),
+		def:    def,
+		routes: map[string]ACL{},
+	}
+}
+
+// Route checks paths under prefix against acl, replacing any ACL
+// already routed there. The prefix must begin with a slash.
+func (r *RouteACL) Route(prefix string, acl ACL) error {
+	if !strings.HasPrefix(prefix, "/") {
+		return errors.New("netallow: route must begin with a slash")
+	}
+
+	if acl == nil {
+		return errors.New("netallow: ACL cannot be nil")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.routes[prefix] = acl
+	return nil
+}
+
+// RemoveRoute removes the route for prefix; paths under it fall back
+// to the next longest route or the default ACL.
+func (r *RouteACL) RemoveRoute(prefix string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.routes, prefix)
+}
+
+// routeMatches returns true if prefix covers path.
+func routeMatches(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") ||
+		path[len(prefix)] == '/'
+}
+
+// ACLFor returns the ACL that requests for path are checked against,
+// which is nil if no route matches and there is no default ACL.
+func (r *RouteACL) ACLFor(path string) ACL {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	acl, longest := r.def, -1
+	for prefix, routed := range r.routes {
+		if len(prefix) > longest && routeMatches(prefix, path) {
+			acl, longest = routed, len(prefix)
+		}
+	}
+	return acl
+}
+
+// Permitted checks the IP against the default ACL.
+func (r *RouteACL) Permitted(ip net.IP) bool {
+	r.lock.RLock()
+	def := r.def
+	r.lock.RUnlock()
+
+	return def != nil && def.Permitted(ip)
+}
+
+// PermittedRequest checks the IP against the ACL routed to the
+// request's path. ACLs that use more of the request, such as a
+// MethodACL, are given it as they would be by a Handler.
+func (r *RouteACL) PermittedRequest(ip net.IP, req *http.Request) bool {
+	_, permitted, _ := r.checkRequest(req, ip)
+	return permitted
+}
+
+// checkRequest checks the request against the ACL routed to its
+// path, as a Handler would check it against that ACL.
+func (r *RouteACL) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	acl := r.ACLFor(requestPath(req))
+	if acl == nil {
+		return req, false, ""
+	}
+	return checkRequest(acl, req, ip)
+}
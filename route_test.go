@@ -0,0 +1,168 @@
+package netallow
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteACL(t *testing.T) {
+	adminACL := NewBasic()
+	addIPString(adminACL, "127.0.0.1", t)
+
+	publicACL := NewBasicNet()
+	testAddNet(publicACL, "0.0.0.0/0", t)
+
+	writeACL := NewMethodACL()
+	writeACL.AddForMethods(mustParseIP(t, "192.0.2.1"), "POST")
+
+	acl := NewRouteACL(nil)
+	for prefix, routed := range map[string]ACL{
+		"/admin":       adminACL,
+		"/":            publicACL,
+		"/admin/write": writeACL,
+	} {
+		if err := acl.Route(prefix, routed); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		method   string
+		path     string
+		remote   string
+		expected string
+	}{
+		{"GET", "/", "192.0.2.1:4141", "OK"},
+		{"GET", "/index.html", "192.0.2.1:4141", "OK"},
+		{"GET", "/admin", "192.0.2.1:4141", "NO"},
+		{"GET", "/admin", "127.0.0.1:4141", "OK"},
+		{"GET", "/admin/users", "192.0.2.1:4141", "NO"},
+		{"GET", "/admin/users", "127.0.0.1:4141", "OK"},
+		{"GET", "/administrator", "192.0.2.1:4141", "OK"},
+		{"POST", "/admin/write", "192.0.2.1:4141", "OK"},
+		{"GET", "/admin/write", "192.0.2.1:4141", "NO"},
+		{"POST", "/admin/write", "127.0.0.1:4141", "NO"},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.RemoteAddr = tc.remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != tc.expected {
+			t.Fatalf("%s %s from %s: expected %s, but got %s",
+				tc.method, tc.path, tc.remote, tc.expected, w.Body.String())
+		}
+	}
+
+	acl.RemoveRoute("/admin/write")
+	if acl.ACLFor("/admin/write") != ACL(adminACL) {
+		t.Fatal("removed route should fall back to the next longest prefix")
+	}
+}
+
+func TestRouteACLDefault(t *testing.T) {
+	def := NewBasic()
+	addIPString(def, "192.0.2.1", t)
+
+	acl := NewRouteACL(def)
+	if err := acl.Route("/admin", NewBasic()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/public", nil)
+	if !acl.PermittedRequest(mustParseIP(t, "192.0.2.1"), req) {
+		t.Fatal("unmatched paths should use the default ACL")
+	}
+
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("Permitted should use the default ACL")
+	}
+
+	req = httptest.NewRequest("GET", "/admin", nil)
+	if acl.PermittedRequest(mustParseIP(t, "192.0.2.1"), req) {
+		t.Fatal("routed paths shouldn't use the default ACL")
+	}
+
+	noDefault := NewRouteACL(nil)
+	if noDefault.PermittedRequest(mustParseIP(t, "192.0.2.1"), httptest.NewRequest("GET", "/", nil)) ||
+		checkIPString(noDefault, "192.0.2.1", t) {
+		t.Fatal("unmatched paths should be denied without a default ACL")
+	}
+
+	if err := acl.Route("admin", NewBasic()); err == nil {
+		t.Fatal("Route should reject a prefix without a leading slash")
+	}
+
+	if err := acl.Route("/admin", nil); err == nil {
+		t.Fatal("Route should reject a nil ACL")
+	}
+}
+
+func TestRouteACLRequestDetails(t *testing.T) {
+	geo, err := NewGeoACL(testGeo)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	geo.AddCountry("NZ")
+
+	files := NewBasicNet()
+	testAddNet(files, "192.0.2.0/24", t)
+
+	acl := NewRouteACL(nil)
+	if err = acl.Route("/geo", geo); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = acl.Route("/files", files); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var country string
+	allow := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		country, _ = CountryFromContext(req.Context())
+	})
+
+	h, err := NewACLHandler(allow, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	sink, err := NewAuditSink(buf, AuditJSON)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.SetAudit(sink)
+
+	// A routed GeoACL's location reaches the allow handler.
+	req := httptest.NewRequest("GET", "/geo", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if country != "NZ" {
+		t.Fatalf("expected the country to be in the request context, have %q", country)
+	}
+
+	// A routed ACL's matching rule reaches the audit record.
+	buf.Reset()
+	req = httptest.NewRequest("GET", "/files/a.txt", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var rec map[string]string
+	if err = json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if rec["rule"] != "192.0.2.0/24" {
+		t.Fatalf("expected the routed ACL's rule to be audited, have %s", buf.String())
+	}
+}
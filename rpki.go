@@ -0,0 +1,172 @@
+package netallow
+
+// This file contains an ACL built from RPKI validated prefix data,
+// permitting the prefixes that given autonomous systems are
+// authorised to originate. Fetching and validating the RPKI data is
+// left to the caller, e.g. an RPKI-to-router cache or a validator's
+// JSON export.
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// A VRP is a validated ROA payload: a prefix that an autonomous
+// system is authorised to originate, as produced by an RPKI
+// validator.
+type VRP struct {
+	Prefix    *net.IPNet
+	MaxLength int
+	ASN       uint32
+}
+
+// A VRPFetcher returns the current set of validated ROA payloads.
+type VRPFetcher func(ctx context.Context) ([]VRP, error)
+
+// LoadVRPs returns a network ACL permitting the prefixes that any of
+// the autonomous systems is authorised to originate. MaxLength only
+// permits more specific announcements of a prefix, so it doesn't
+// change which addresses are permitted. The prefixes are copied and
+// stored by their network address, as BasicNet's Add stores them;
+// invalid prefixes are skipped.
+func LoadVRPs(vrps []VRP, asns ...uint32) *BasicNet {
+	wanted := map[uint32]bool{}
+	for _, asn := range asns {
+		wanted[asn] = true
+	}
+
+	var nets []*net.IPNet
+	for _, vrp := range vrps {
+		if !wanted[vrp.ASN] {
+			continue
+		}
+
+		if n := canonicalNet(vrp.Prefix); n != nil {
+			nets = append(nets, n)
+		}
+	}
+
+	acl := NewBasicNet()
+	acl.allowed = dropCovered(nets)
+	return acl
+}
+
+// RPKIACL permits the prefixes that a set of autonomous systems is
+// authorised to originate, according to RPKI data from a fetcher.
+// Until the first successful Refresh, every address is denied; if a
+// refresh fails, the previous prefixes are kept.
+type RPKIACL struct {
+	fetch VRPFetcher
+	asns  []uint32
+
+	lock    *sync.Mutex
+	clock   Clock
+	acl     *BasicNet
+	updated time.Time
+}
+
+// NewRPKIACL returns an RPKIACL for the autonomous systems, using
+// fetch to get RPKI data. Refresh must be called to load the data.
+func NewRPKIACL(fetch VRPFetcher, asns ...uint32) (*RPKIACL, error) {
+	if fetch == nil {
+		return nil, errors.New("netallow: fetcher cannot be nil")
+	}
+
+	if len(asns) == 0 {
+		return nil, errors.New("netallow: at least one ASN is required")
+	}
+
+	return &RPKIACL{
+		fetch: fetch,
+		asns:  asns,
+		lock:  new(sync.Mutex),
+		clock: SystemClock,
+		acl:   NewBasicNet(),
+	}, nil
+}
+
+// SetClock sets the clock used to timestamp refreshes. A nil clock
+// selects the system clock.
+func (r *RPKIACL) SetClock(clock Clock) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.clock = clockOrSystem(clock)
+}
+
+// Refresh fetches the current RPKI data and replaces the permitted
+// prefixes. If the fetch fails, the previous prefixes are kept.
+func (r *RPKIACL) Refresh(ctx context.Context) error {
+	vrps, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	acl := LoadVRPs(vrps, r.asns...)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.acl = acl
+	r.updated = r.clock.Now()
+	return nil
+}
+
+// Updated returns the time of the last successful refresh, or the
+// zero time if there hasn't been one.
+func (r *RPKIACL) Updated() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.updated
+}
+
+// DefaultRPKIRefreshInterval is the interval used by StartRefresher
+// when it is given an interval that isn't positive.
+const DefaultRPKIRefreshInterval = 30 * time.Minute
+
+// StartRefresher calls Refresh every interval in a new goroutine,
+// logging failures, until the returned stop function is called. An
+// interval that isn't positive is replaced by
+// DefaultRPKIRefreshInterval.
+func (r *RPKIACL) StartRefresher(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultRPKIRefreshInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Refresh(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("netallow: failed to refresh RPKI data: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// current returns the ACL built from the last successful refresh.
+func (r *RPKIACL) current() *BasicNet {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.acl
+}
+
+// MatchRule returns true and the prefix containing the IP if it is
+// permitted.
+func (r *RPKIACL) MatchRule(ip net.IP) (string, bool) {
+	return r.current().MatchRule(ip)
+}
+
+// Permitted returns true if the IP is in a prefix that one of the
+// autonomous systems is authorised to originate.
+func (r *RPKIACL) Permitted(ip net.IP) bool {
+	return r.current().Permitted(ip)
+}
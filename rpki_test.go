@@ -0,0 +1,175 @@
+package netallow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testVRPSource is a fake source of validated prefix data.
+type testVRPSource struct {
+	lock *sync.Mutex
+	vrps []VRP
+	err  error
+}
+
+func (s *testVRPSource) set(vrps []VRP, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.vrps, s.err = vrps, err
+}
+
+func (s *testVRPSource) Fetch(ctx context.Context) ([]VRP, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.vrps, s.err
+}
+
+func testVRPs(t *testing.T) []VRP {
+	return []VRP{
+		{Prefix: mustParseNet(t, "192.0.2.0/24"), MaxLength: 24, ASN: 64500},
+		{Prefix: mustParseNet(t, "192.0.2.128/25"), MaxLength: 25, ASN: 64500},
+		{Prefix: mustParseNet(t, "2001:db8::/32"), MaxLength: 48, ASN: 64500},
+		{Prefix: mustParseNet(t, "198.51.100.0/24"), MaxLength: 24, ASN: 64501},
+		{Prefix: mustParseNet(t, "203.0.113.0/24"), MaxLength: 24, ASN: 64502},
+	}
+}
+
+func TestLoadVRPs(t *testing.T) {
+	acl := LoadVRPs(testVRPs(t), 64500, 64501)
+	for addr, expected := range map[string]bool{
+		"192.0.2.1":    true,
+		"192.0.2.200":  true,
+		"2001:db8::1":  true,
+		"198.51.100.1": true,
+		"203.0.113.1":  false,
+		"192.168.1.1":  false,
+		"2001:db9::1":  false,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	// The covered /25 is dropped.
+	if len(acl.allowed) != 3 {
+		t.Fatalf("expected 3 prefixes, but have %d", len(acl.allowed))
+	}
+}
+
+func TestLoadVRPsCanonical(t *testing.T) {
+	// A 4-in-6 prefix with host bits set, as a careless caller
+	// might build it.
+	prefix := &net.IPNet{IP: net.ParseIP("192.0.2.5"), Mask: net.CIDRMask(24, 32)}
+	acl := LoadVRPs([]VRP{{Prefix: prefix, MaxLength: 24, ASN: 64500}}, 64500)
+	if entries := acl.entries(); len(entries) != 1 || entries[0] != "192.0.2.0/24" {
+		t.Fatalf("expected the prefix to be stored as 192.0.2.0/24, have %v", entries)
+	}
+
+	// Changing the caller's prefix doesn't change the ACL.
+	copy(prefix.IP, net.ParseIP("198.51.100.5"))
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("ACL should not share the caller's prefix")
+	}
+
+	acl.Remove(mustParseNet(t, "192.0.2.0/24"))
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("prefix should have been removed")
+	}
+}
+
+func TestRPKIACL(t *testing.T) {
+	src := &testVRPSource{lock: new(sync.Mutex)}
+	src.set(testVRPs(t), nil)
+
+	acl, err := NewRPKIACL(src.Fetch, 64501)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	acl.SetClock(clock)
+	if checkIPString(acl, "198.51.100.1", t) || !acl.Updated().IsZero() {
+		t.Fatal("ACL should deny everything before the first refresh")
+	}
+
+	if err = acl.Refresh(context.Background()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(acl, "198.51.100.1", t) || checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("ACL should only permit prefixes originated by AS64501")
+	}
+
+	if !acl.Updated().Equal(clock.Now()) {
+		t.Fatal("refresh time should have been recorded")
+	}
+
+	// A failed refresh keeps the previous prefixes.
+	clock.Advance(time.Hour)
+	src.set(nil, errors.New("validator unavailable"))
+	if err = acl.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh should return the fetcher's error")
+	}
+
+	if !checkIPString(acl, "198.51.100.1", t) || acl.Updated().Equal(clock.Now()) {
+		t.Fatal("failed refresh should keep the previous prefixes")
+	}
+
+	// The ROA is withdrawn.
+	src.set(testVRPs(t)[:3], nil)
+	if err = acl.Refresh(context.Background()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if checkIPString(acl, "198.51.100.1", t) {
+		t.Fatal("ACL should deny prefix whose ROA was withdrawn")
+	}
+}
+
+func TestRPKIRefresher(t *testing.T) {
+	src := &testVRPSource{lock: new(sync.Mutex)}
+	src.set(testVRPs(t), nil)
+	acl, err := NewRPKIACL(src.Fetch, 64502)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	stop := acl.StartRefresher(time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !checkIPString(acl, "203.0.113.1", t) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the refresher")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRPKIRefresherInterval(t *testing.T) {
+	src := &testVRPSource{lock: new(sync.Mutex)}
+	src.set(testVRPs(t), nil)
+	acl, err := NewRPKIACL(src.Fetch, 64502)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A bad interval is replaced rather than panicking.
+	stop := acl.StartRefresher(0)
+	stop()
+}
+
+func TestNewRPKIACLFails(t *testing.T) {
+	if _, err := NewRPKIACL(nil, 64500); err == nil {
+		t.Fatal("NewRPKIACL should fail with a nil fetcher")
+	}
+
+	src := &testVRPSource{lock: new(sync.Mutex)}
+	if _, err := NewRPKIACL(src.Fetch); err == nil {
+		t.Fatal("NewRPKIACL should fail without an ASN")
+	}
+}
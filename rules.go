@@ -0,0 +1,228 @@
+package netallow
+
+// This file contains an ACL made up of allow and deny rules, so that
+// exceptions can be carved out of larger networks.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// A Rule allows or denies access to a network. In a LayeredACL, a
+// rule with a nil network applies to every address.
+type Rule struct {
+	Allow bool
+	Net   *net.IPNet
+}
+
+// String returns the rule as it is written in a rules file, e.g.
+// "deny 10.0.0.0/8". A rule for every address is written as "allow
+// all" or "deny all".
+func (r Rule) String() string {
+	target := "all"
+	if r.Net != nil {
+		target = r.Net.String()
+	}
+
+	if r.Allow {
+		return "allow " + target
+	}
+	return "deny " + target
+}
+
+// contains returns true if the rule applies to the IP.
+func (r Rule) contains(ip net.IP) bool {
+	return r.Net == nil || r.Net.Contains(ip)
+}
+
+// RuleSet is a network ACL of allow and deny rules. The decision for
+// an address comes from the most specific rule (the one with the
+// longest prefix) containing it; if an allow rule and a deny rule
+// are equally specific, the deny rule wins. Addresses that no rule
+// contains are denied.
+//
+// For example, with the rules
+//
+//	allow 10.0.0.0/8
+//	deny 10.6.6.0/24
+//	allow 10.6.6.1/32
+//
+// 10.1.2.3 and 10.6.6.1 are permitted, but 10.6.6.2 is not.
+type RuleSet struct {
+	lock  *sync.Mutex
+	rules []Rule
+}
+
+// NewRuleSet returns a new, empty rule set.
+func NewRuleSet() *RuleSet {
+	return &RuleSet{
+		lock: new(sync.Mutex),
+	}
+}
+
+// addRule adds a rule for a canonical network, replacing any existing
+// rule for the same network. The caller must hold the lock.
+func (rs *RuleSet) addRule(r Rule) {
+	for i := range rs.rules {
+		if rs.rules[i].Net.String() == r.Net.String() {
+			rs.rules[i] = r
+			return
+		}
+	}
+	rs.rules = append(rs.rules, r)
+}
+
+// Allow adds a rule permitting the network, replacing any existing
+// rule for it. As with BasicNet, the network address is stored, so
+// 10.0.0.5/24 is the same network as 10.0.0.0/24.
+func (rs *RuleSet) Allow(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.addRule(Rule{Allow: true, Net: n})
+}
+
+// Deny adds a rule denying the network, replacing any existing rule
+// for it.
+func (rs *RuleSet) Deny(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.addRule(Rule{Allow: false, Net: n})
+}
+
+// Add adds a rule permitting the network; it is the same as Allow,
+// and allows a RuleSet to be used as a NetACL.
+func (rs *RuleSet) Add(n *net.IPNet) {
+	rs.Allow(n)
+}
+
+// Remove drops the rule for the network, whether it allows or denies
+// it.
+func (rs *RuleSet) Remove(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	for i := range rs.rules {
+		if rs.rules[i].Net.String() == n.String() {
+			rs.rules = append(rs.rules[:i], rs.rules[i+1:]...)
+			return
+		}
+	}
+}
+
+// Rules returns a copy of the rules, in the order they were added.
+func (rs *RuleSet) Rules() []Rule {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rules := make([]Rule, len(rs.rules))
+	copy(rules, rs.rules)
+	return rules
+}
+
+// match returns the most specific rule containing the IP.
+func (rs *RuleSet) match(ip net.IP) (Rule, bool) {
+	var best Rule
+	bestOnes := -1
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	for _, r := range rs.rules {
+		if !r.Net.Contains(ip) {
+			continue
+		}
+
+		ones, _ := r.Net.Mask.Size()
+		if ones > bestOnes || (ones == bestOnes && !r.Allow) {
+			best, bestOnes = r, ones
+		}
+	}
+
+	return best, bestOnes >= 0
+}
+
+// MatchRule returns true and the most specific rule containing the
+// IP if it is permitted.
+func (rs *RuleSet) MatchRule(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+
+	r, ok := rs.match(ip)
+	if !ok || !r.Allow {
+		return "", false
+	}
+	return r.String(), true
+}
+
+// Permitted returns true if the most specific rule containing the IP
+// allows it.
+func (rs *RuleSet) Permitted(ip net.IP) bool {
+	_, permitted := rs.MatchRule(ip)
+	return permitted
+}
+
+// LoadRules loads a rule set from a byte slice. Each line contains
+// a rule: the word "allow" or "deny" followed by a network in CIDR
+// notation or a single IP address. Blank lines and lines beginning
+// with '#' are ignored. The order of the rules doesn't matter; see
+// RuleSet for how they are applied.
+func LoadRules(in []byte) (*RuleSet, error) {
+	rs := NewRuleSet()
+	for i, line := range strings.Split(string(in), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("netallow: invalid rule on line %d", i+1)
+		}
+
+		n, err := parseNet(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("netallow: invalid network on line %d: %v", i+1, err)
+		}
+
+		switch fields[0] {
+		case "allow":
+			rs.Allow(n)
+		case "deny":
+			rs.Deny(n)
+		default:
+			return nil, errors.New("netallow: unknown rule action " + fields[0])
+		}
+	}
+
+	return rs, nil
+}
+
+// DumpRules returns the rule set in the format read by LoadRules,
+// one rule per line.
+func DumpRules(rs *RuleSet) []byte {
+	var buf bytes.Buffer
+	for i, r := range rs.Rules() {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(r.String())
+	}
+	return buf.Bytes()
+}
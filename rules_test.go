@@ -0,0 +1,144 @@
+package netallow
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+var testRules = []byte(`# The 10/8 network is allowed, except for one /16.
+allow 10.0.0.0/8
+deny  10.5.0.0/16
+
+# ... which has one subnet carved back out.
+allow 10.5.1.0/24
+deny 2001:db8::/32
+allow 2001:db8:1::/48
+`)
+
+func TestLoadRules(t *testing.T) {
+	rs, err := LoadRules(testRules)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.1.2.3":      true,
+		"10.5.0.1":      false,
+		"10.5.1.1":      true,
+		"10.5.2.1":      false,
+		"192.168.1.1":   false,
+		"2001:db8::1":   false,
+		"2001:db8:1::1": true,
+	} {
+		if checkIPString(rs, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	rule, ok := rs.MatchRule(mustParseIP(t, "10.5.1.1"))
+	if !ok || rule != "allow 10.5.1.0/24" {
+		t.Fatalf("expected match with allow 10.5.1.0/24, but have %q", rule)
+	}
+
+	loaded, err := LoadRules(DumpRules(rs))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(DumpRules(rs), DumpRules(loaded)) {
+		t.Fatal("dump -> load failed")
+	}
+}
+
+func TestRuleSetPrecedence(t *testing.T) {
+	rs := NewRuleSet()
+	testAddNet(rs, "10.0.0.0/8", t)
+	if !checkIPString(rs, "10.1.1.1", t) {
+		t.Fatal("rule set should have permitted address")
+	}
+
+	// A deny rule for the same network replaces the allow rule.
+	rs.Deny(mustParseNet(t, "10.0.0.0/8"))
+	if checkIPString(rs, "10.1.1.1", t) {
+		t.Fatal("rule set should have denied address")
+	}
+
+	if len(rs.Rules()) != 1 {
+		t.Fatalf("expected 1 rule, but have %d", len(rs.Rules()))
+	}
+
+	testDelNet(rs, "10.0.0.0/8", t)
+	if len(rs.Rules()) != 0 {
+		t.Fatalf("expected no rules, but have %d", len(rs.Rules()))
+	}
+}
+
+func TestLoadRulesFails(t *testing.T) {
+	for _, in := range []string{
+		"allow",
+		"permit 10.0.0.0/8",
+		"allow 10.0.0.0/33",
+		"deny 10.0.0.0/8 extra",
+	} {
+		if _, err := LoadRules([]byte(in)); err == nil {
+			t.Fatalf("LoadRules should fail on %q", in)
+		}
+	}
+}
+
+func TestRuleSetHoles(t *testing.T) {
+	// An allowed network with a denied hole.
+	rs := NewRuleSet()
+	rs.Allow(mustParseNet(t, "10.0.0.0/8"))
+	rs.Deny(mustParseNet(t, "10.6.6.0/24"))
+
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":    true,
+		"10.6.5.255":  true,
+		"10.6.6.1":    false,
+		"10.6.7.0":    true,
+		"192.168.1.1": false,
+	} {
+		if checkIPString(rs, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	// A denied network with an allowed hole; rules for everything
+	// else must be explicit, as addresses no rule contains are
+	// denied.
+	rs = NewRuleSet()
+	rs.Allow(mustParseNet(t, "0.0.0.0/0"))
+	rs.Deny(mustParseNet(t, "192.168.0.0/16"))
+	rs.Allow(mustParseNet(t, "192.168.10.0/24"))
+
+	for addr, expected := range map[string]bool{
+		"203.0.113.1":  true,
+		"192.168.1.1":  false,
+		"192.168.10.9": true,
+		"2001:db8::1":  false,
+	} {
+		if checkIPString(rs, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+}
+
+func TestRuleSetCanonical(t *testing.T) {
+	// Host bits don't make a different network: the deny rule
+	// replaces the allow rule, and removal matches either form.
+	rs := NewRuleSet()
+	rs.Allow(&net.IPNet{IP: net.IP{10, 6, 6, 5}, Mask: net.CIDRMask(24, 32)})
+	rs.Deny(mustParseNet(t, "10.6.6.0/24"))
+
+	rules := rs.Rules()
+	if len(rules) != 1 || rules[0].String() != "deny 10.6.6.0/24" {
+		t.Fatalf("expected a single deny 10.6.6.0/24 rule, have %v", rules)
+	}
+
+	rs.Remove(&net.IPNet{IP: net.IP{10, 6, 6, 77}, Mask: net.CIDRMask(24, 32)})
+	if len(rs.Rules()) != 0 {
+		t.Fatalf("expected no rules, but have %v", rs.Rules())
+	}
+}
@@ -0,0 +1,119 @@
+package netallow
+
+// This file contains an ACL decorator that records when each
+// permitted client was seen, so that dormant entries can be found.
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A SeenEntry records when a permitted address was first and last
+// seen.
+type SeenEntry struct {
+	IP    net.IP
+	First time.Time
+	Last  time.Time
+}
+
+// SeenACL is an ACL that records the first and last time each
+// address was permitted by the ACL it wraps. Denied addresses aren't
+// recorded. If a limit is set, the address that was seen least
+// recently is forgotten to make room for a new one.
+type SeenACL struct {
+	acl   ACL
+	max   int
+	lock  *sync.Mutex
+	clock Clock
+	seen  map[string]*list.Element
+	order *list.List // of *SeenEntry, most recently seen first
+}
+
+// NewSeenACL returns a SeenACL wrapping acl, remembering at most max
+// addresses. A max of 0 means there is no limit.
+func NewSeenACL(acl ACL, max int) *SeenACL {
+	return &SeenACL{
+		acl:   acl,
+		max:   max,
+		lock:  new(sync.Mutex),
+		clock: SystemClock,
+		seen:  map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+// SetClock sets the clock used to timestamp addresses. A nil clock
+// selects the system clock.
+func (s *SeenACL) SetClock(clock Clock) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clock = clockOrSystem(clock)
+}
+
+// record notes that the IP was permitted.
+func (s *SeenACL) record(ip net.IP) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.clock.Now()
+	addr := ip.String()
+	if elem, ok := s.seen[addr]; ok {
+		elem.Value.(*SeenEntry).Last = now
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	if s.max > 0 && s.order.Len() >= s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.seen, oldest.Value.(*SeenEntry).IP.String())
+	}
+
+	entry := &SeenEntry{
+		IP:    append(net.IP(nil), ip...),
+		First: now,
+		Last:  now,
+	}
+	s.seen[addr] = s.order.PushFront(entry)
+}
+
+// MatchRule checks the IP against the wrapped ACL, recording it if
+// it is permitted.
+func (s *SeenACL) MatchRule(ip net.IP) (string, bool) {
+	permitted, rule := matchRule(s.acl, ip)
+	if permitted {
+		s.record(ip)
+	}
+	return rule, permitted
+}
+
+// Permitted returns true if the wrapped ACL permits the IP,
+// recording it if so.
+func (s *SeenACL) Permitted(ip net.IP) bool {
+	_, permitted := s.MatchRule(ip)
+	return permitted
+}
+
+// checkRequest passes the request to the wrapped ACL, recording the
+// IP if it is permitted.
+func (s *SeenACL) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	req, permitted, rule := checkRequest(s.acl, req, ip)
+	if permitted {
+		s.record(ip)
+	}
+	return req, permitted, rule
+}
+
+// Stats returns a copy of the recorded addresses, least recently
+// seen first.
+func (s *SeenACL) Stats() []SeenEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entries := make([]SeenEntry, 0, s.order.Len())
+	for elem := s.order.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, *elem.Value.(*SeenEntry))
+	}
+	return entries
+}
@@ -0,0 +1,64 @@
+package netallow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeenACL(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	addIPString(acl, "10.0.0.2", t)
+
+	seen := NewSeenACL(acl, 0)
+	clock := newTestClock()
+	seen.SetClock(clock)
+	start := clock.Now()
+
+	checkIPString(seen, "10.0.0.1", t)
+	clock.Advance(time.Minute)
+	checkIPString(seen, "10.0.0.2", t)
+	clock.Advance(time.Minute)
+	checkIPString(seen, "10.0.0.1", t)
+	if checkIPString(seen, "10.0.0.3", t) {
+		t.Fatal("ACL should have denied address")
+	}
+
+	stats := seen.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 recorded addresses, but have %d", len(stats))
+	}
+
+	// The least recently seen address comes first.
+	if stats[0].IP.String() != "10.0.0.2" || !stats[0].First.Equal(start.Add(time.Minute)) ||
+		!stats[0].Last.Equal(start.Add(time.Minute)) {
+		t.Fatalf("unexpected entry %+v", stats[0])
+	}
+
+	if stats[1].IP.String() != "10.0.0.1" || !stats[1].First.Equal(start) ||
+		!stats[1].Last.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("unexpected entry %+v", stats[1])
+	}
+}
+
+func TestSeenACLLimit(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		addIPString(acl, addr, t)
+	}
+
+	seen := NewSeenACL(acl, 2)
+	clock := newTestClock()
+	seen.SetClock(clock)
+
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		checkIPString(seen, addr, t)
+		clock.Advance(time.Second)
+	}
+
+	// 10.0.0.2 was seen least recently, so it was evicted.
+	stats := seen.Stats()
+	if len(stats) != 2 || stats[0].IP.String() != "10.0.0.1" || stats[1].IP.String() != "10.0.0.3" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,83 @@
+package netallow
+
+// This file contains support for binding sessions to the network
+// they were established from, to limit the use of stolen session
+// tokens.
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// A SessionBinding requires that requests belonging to a session come
+// from the same network as the one the session was established from.
+type SessionBinding struct {
+	// SessionIP returns the address the request's session was
+	// established from, such as from a signed cookie or a JWT
+	// claim. It returns nil if the request has no session, in
+	// which case the binding isn't checked.
+	SessionIP func(req *http.Request) net.IP
+
+	// V4Bits and V6Bits are the lengths of the prefixes that the
+	// session and request addresses must share; for example,
+	// with V4Bits set to 24, a session established from
+	// 192.0.2.1 may be used from anywhere in 192.0.2.0/24. Zero
+	// requires an exact match.
+	V4Bits int
+	V6Bits int
+}
+
+// Matches returns true if the request address is in the same
+// network as the session address. Addresses of different families
+// never match.
+func (b *SessionBinding) Matches(session, ip net.IP) bool {
+	if !validIP(session) || !validIP(ip) {
+		return false
+	}
+
+	s4, ip4 := session.To4(), ip.To4()
+	switch {
+	case s4 != nil && ip4 != nil:
+		return samePrefix(s4, ip4, b.V4Bits, 32)
+	case s4 == nil && ip4 == nil:
+		return samePrefix(session, ip, b.V6Bits, 128)
+	default:
+		return false
+	}
+}
+
+// samePrefix returns true if a and b share their first ones bits;
+// ones outside (0, bits] requires them to be equal.
+func samePrefix(a, b net.IP, ones, bits int) bool {
+	if ones <= 0 || ones > bits {
+		ones = bits
+	}
+
+	mask := net.CIDRMask(ones, bits)
+	return a.Mask(mask).Equal(b.Mask(mask))
+}
+
+// permits returns true if the request is not part of a session, or
+// if it comes from the session's network.
+func (b *SessionBinding) permits(req *http.Request, ip net.IP) bool {
+	session := b.SessionIP(req)
+	if session == nil {
+		return true
+	}
+	return b.Matches(session, ip)
+}
+
+// BindSessions denies requests whose session was established from a
+// different network, in addition to the ACL check. The binding must
+// have a SessionIP function. Passing nil removes the binding.
+func (h *Handler) BindSessions(b *SessionBinding) error {
+	if b != nil && b.SessionIP == nil {
+		return errors.New("netallow: session binding requires a SessionIP function")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.sessions = b
+	return nil
+}
@@ -0,0 +1,88 @@
+package netallow
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionBindingMatches(t *testing.T) {
+	exact := &SessionBinding{}
+	subnet := &SessionBinding{V4Bits: 24, V6Bits: 64}
+
+	tv := []struct {
+		b        *SessionBinding
+		session  string
+		ip       string
+		expected bool
+	}{
+		{exact, "192.0.2.1", "192.0.2.1", true},
+		{exact, "192.0.2.1", "::ffff:192.0.2.1", true},
+		{exact, "192.0.2.1", "192.0.2.2", false},
+		{subnet, "192.0.2.1", "192.0.2.200", true},
+		{subnet, "192.0.2.1", "192.0.3.1", false},
+		{subnet, "2001:db8::1", "2001:db8::ffff:1", true},
+		{subnet, "2001:db8::1", "2001:db8:0:1::1", false},
+		{subnet, "192.0.2.1", "2001:db8::1", false},
+	}
+
+	for _, tc := range tv {
+		if tc.b.Matches(net.ParseIP(tc.session), net.ParseIP(tc.ip)) != tc.expected {
+			t.Fatalf("expected Matches(%s, %s) with %d/%d bits to be %v",
+				tc.session, tc.ip, tc.b.V4Bits, tc.b.V6Bits, tc.expected)
+		}
+	}
+}
+
+func TestHandlerSessionBinding(t *testing.T) {
+	acl := NewBasicNet()
+	testAddNet(acl, "192.0.2.0/24", t)
+	h, err := NewACLHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = h.BindSessions(&SessionBinding{}); err == nil {
+		t.Fatal("BindSessions should reject a binding without SessionIP")
+	}
+
+	err = h.BindSessions(&SessionBinding{
+		SessionIP: func(req *http.Request) net.IP {
+			c, err := req.Cookie("session-ip")
+			if err != nil {
+				return nil
+			}
+			return net.ParseIP(c.Value)
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		remote   string
+		session  string
+		expected string
+	}{
+		{"192.0.2.1:4141", "192.0.2.1", "OK"},
+		{"192.0.2.1:4141", "192.0.2.2", "NO"},
+		{"192.0.2.1:4141", "", "OK"},
+		{"198.51.100.1:4141", "198.51.100.1", "NO"},
+	}
+
+	for _, tc := range tv {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.session != "" {
+			req.AddCookie(&http.Cookie{Name: "session-ip", Value: tc.session})
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != tc.expected {
+			t.Fatalf("%s with session %q: expected %s, but got %s",
+				tc.remote, tc.session, tc.expected, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package netallow
+
+// This file contains an ACL for services that shard their clients
+// across instances.
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+)
+
+// ShardOf returns the shard, in the range [0, shards), that the IP
+// is assigned to. The assignment is stable across releases and
+// platforms, so that every instance agrees on it:
+//
+// The key is the 64-bit FNV-1a hash of the address, using the 4-byte
+// form for IPv4 addresses (including IPv4-mapped IPv6 addresses) and
+// the 16-byte form otherwise. The key is mapped to a shard with the
+// jump consistent hash of Lamping and Veach ("A Fast, Minimal Memory,
+// Consistent Hash Algorithm", 2014), so that when the number of
+// shards grows from n to n+1 only 1/(n+1) of the addresses move.
+//
+// ShardOf returns -1 if the IP is invalid or shards is less than 1.
+func ShardOf(ip net.IP, shards int) int {
+	if !validIP(ip) || shards < 1 {
+		return -1
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	h := fnv.New64a()
+	h.Write(ip)
+	return jumpHash(h.Sum64(), shards)
+}
+
+// jumpHash implements the jump consistent hash.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// ShardACL permits the addresses assigned to one shard of a
+// client-sharded service; see ShardOf for how addresses are
+// assigned.
+type ShardACL struct {
+	shard  int
+	shards int
+}
+
+// NewShardACL returns an ACL that permits addresses assigned to
+// shard, which must be in the range [0, shards).
+func NewShardACL(shard, shards int) (*ShardACL, error) {
+	if shards < 1 {
+		return nil, errors.New("netallow: there must be at least one shard")
+	}
+
+	if shard < 0 || shard >= shards {
+		return nil, errors.New("netallow: shard is out of range")
+	}
+
+	return &ShardACL{
+		shard:  shard,
+		shards: shards,
+	}, nil
+}
+
+// Permitted returns true if the IP is assigned to the ACL's shard.
+func (acl *ShardACL) Permitted(ip net.IP) bool {
+	return ShardOf(ip, acl.shards) == acl.shard
+}
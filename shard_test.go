@@ -0,0 +1,90 @@
+package netallow
+
+import (
+	"net"
+	"testing"
+)
+
+func TestShardOf(t *testing.T) {
+	// These assignments must not change between releases, or
+	// instances running different versions will disagree.
+	tv := []struct {
+		addr  string
+		shard int
+	}{
+		{"10.0.0.1", 9},
+		{"::ffff:10.0.0.1", 9},
+		{"192.168.1.1", 10},
+		{"2001:db8::1", 9},
+	}
+
+	for _, tc := range tv {
+		if shard := ShardOf(net.ParseIP(tc.addr), 16); shard != tc.shard {
+			t.Fatalf("expected %s to be assigned to shard %d, but have %d",
+				tc.addr, tc.shard, shard)
+		}
+	}
+
+	if ShardOf(nil, 16) != -1 || ShardOf(net.ParseIP("10.0.0.1"), 0) != -1 {
+		t.Fatal("ShardOf should fail with invalid arguments")
+	}
+}
+
+func TestShardOfGrowth(t *testing.T) {
+	// Growing from 10 to 11 shards should only move addresses
+	// to the new shard.
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		ip := net.IPv4(10, 0, byte(i>>8), byte(i))
+		before, after := ShardOf(ip, 10), ShardOf(ip, 11)
+		if before != after {
+			if after != 10 {
+				t.Fatalf("%s moved from shard %d to %d", ip, before, after)
+			}
+			moved++
+		}
+	}
+
+	if moved < 500 || moved > 1400 {
+		t.Fatalf("expected about 1/11 of addresses to move, but %d did", moved)
+	}
+}
+
+func TestShardACL(t *testing.T) {
+	const shards = 4
+	var acls []*ShardACL
+	for i := 0; i < shards; i++ {
+		acl, err := NewShardACL(i, shards)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		acls = append(acls, acl)
+	}
+
+	// Every address is permitted by exactly one shard.
+	for i := 0; i < 1000; i++ {
+		ip := net.IPv4(192, 168, byte(i>>8), byte(i))
+		owners := 0
+		for _, acl := range acls {
+			if acl.Permitted(ip) {
+				owners++
+			}
+		}
+
+		if owners != 1 {
+			t.Fatalf("%s is permitted by %d shards", ip, owners)
+		}
+	}
+
+	if acls[0].Permitted(nil) {
+		t.Fatal("ACL should have denied invalid address")
+	}
+}
+
+func TestShardACLFails(t *testing.T) {
+	for _, tc := range [][2]int{{0, 0}, {-1, 4}, {4, 4}} {
+		if _, err := NewShardACL(tc[0], tc[1]); err == nil {
+			t.Fatalf("NewShardACL(%d, %d) should fail", tc[0], tc[1])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package netallow
+
+// This file contains a host ACL that spreads its addresses across
+// several locks, for ACLs that are changed while under heavy load.
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+// DefaultShardCount is the number of shards used by a ShardedBasic
+// that is unmarshaled without being created by NewShardedBasic.
+const DefaultShardCount = 16
+
+// ShardedBasic is a host ACL made of several Basic ACLs, each with
+// its own lock, with each address stored in a shard chosen by a hash
+// of the address. A Basic's writers block all of its readers; spreading
+// the addresses out means that an Add or Remove only blocks checks
+// of addresses in the same shard. Operations on the whole ACL, such
+// as dumping it, visit the shards one at a time, so they see a
+// consistent view of each shard but not necessarily of the whole
+// ACL.
+type ShardedBasic struct {
+	shards []*Basic
+}
+
+// NewShardedBasic returns an empty host ACL with the given number of
+// shards, which must be at least 1.
+func NewShardedBasic(shards int) (*ShardedBasic, error) {
+	if shards < 1 {
+		return nil, errors.New("netallow: there must be at least one shard")
+	}
+
+	acl := &ShardedBasic{shards: make([]*Basic, shards)}
+	for i := range acl.shards {
+		acl.shards[i] = NewBasic()
+	}
+	return acl, nil
+}
+
+// shardIndex returns the index, in the range [0, shards), of the
+// shard holding a valid IP. It is the 32-bit FNV-1a hash of the
+// address, in the same form Basic stores it in, modulo the number of
+// shards; unlike ShardOf, the assignment only needs to be stable
+// within a process, so it favours speed over consistent hashing.
+func shardIndex(ip net.IP, shards int) int {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	h := uint32(2166136261)
+	for _, b := range ip {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return int(h % uint32(shards))
+}
+
+// shard returns the shard holding a valid IP.
+func (acl *ShardedBasic) shard(ip net.IP) *Basic {
+	return acl.shards[shardIndex(ip, len(acl.shards))]
+}
+
+// Permitted returns true if the IP is allowed access.
+func (acl *ShardedBasic) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+	return acl.shard(ip).Permitted(ip)
+}
+
+// MatchRule returns true and the address as it is stored in the ACL
+// if the IP is allowed access.
+func (acl *ShardedBasic) MatchRule(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+	return acl.shard(ip).MatchRule(ip)
+}
+
+// Add permits access to the IP.
+func (acl *ShardedBasic) Add(ip net.IP) {
+	if validIP(ip) {
+		acl.shard(ip).Add(ip)
+	}
+}
+
+// Remove removes access by the IP.
+func (acl *ShardedBasic) Remove(ip net.IP) {
+	if validIP(ip) {
+		acl.shard(ip).Remove(ip)
+	}
+}
+
+// Count returns the number of addresses in the ACL, including
+// disabled addresses.
+func (acl *ShardedBasic) Count() int {
+	var count int
+	for _, shard := range acl.shards {
+		count += shard.Count()
+	}
+	return count
+}
+
+// entries returns a sorted copy of the addresses in every shard, in
+// the same form as Basic's entries.
+func (acl *ShardedBasic) entries() []string {
+	var addrs []string
+	for _, shard := range acl.shards {
+		addrs = append(addrs, shard.entries()...)
+	}
+
+	sort.Strings(addrs)
+	return addrs
+}
+
+// String returns a summary of the ACL's contents, in the same form
+// as Basic's.
+func (acl *ShardedBasic) String() string {
+	return describeEntries("ShardedBasic", "host", acl.entries())
+}
+
+// replace swaps the addresses in entries, which are in the form read
+// by LoadBasic, into the shards. Nothing is changed if any entry is
+// invalid.
+func (acl *ShardedBasic) replace(entries []string) error {
+	fresh := make([]*Basic, len(acl.shards))
+	for i := range fresh {
+		fresh[i] = NewBasic()
+	}
+
+	for _, entry := range entries {
+		ip, enabled := parseEntry(entry)
+		if ip == nil {
+			return errors.New("netallow: invalid address " + entry)
+		}
+		fresh[shardIndex(ip, len(fresh))].allowed[ip.String()] = enabled
+	}
+
+	for i, shard := range acl.shards {
+		shard.replace(fresh[i])
+	}
+	return nil
+}
+
+// MarshalJSON serialises the ACL in the same form as Basic.
+func (acl *ShardedBasic) MarshalJSON() ([]byte, error) {
+	out := []byte(`"` + strings.Join(acl.entries(), ",") + `"`)
+	return out, nil
+}
+
+// UnmarshalJSON replaces the contents of the ACL with a serialised
+// host ACL, in any of the forms read by Basic's UnmarshalJSON. The
+// entries are all checked before any shard is changed. A ShardedBasic
+// that wasn't created with NewShardedBasic gets DefaultShardCount
+// shards.
+func (acl *ShardedBasic) UnmarshalJSON(in []byte) error {
+	entries, err := jsonEntries(in)
+	if err != nil {
+		return err
+	}
+
+	if acl.shards == nil {
+		fresh, _ := NewShardedBasic(DefaultShardCount)
+		acl.shards = fresh.shards
+	}
+	return acl.replace(entries)
+}
+
+// DumpShardedBasic returns the ACL in the format written by
+// DumpBasic.
+func DumpShardedBasic(acl *ShardedBasic) []byte {
+	return []byte(strings.Join(acl.entries(), "\n"))
+}
+
+// LoadShardedBasic loads a host ACL with the given number of shards
+// from a byte slice in the format read by LoadBasic.
+func LoadShardedBasic(in []byte, shards int) (*ShardedBasic, error) {
+	acl, err := NewShardedBasic(shards)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(in), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+
+	if err = acl.replace(entries); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
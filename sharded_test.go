@@ -0,0 +1,168 @@
+package netallow
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestShardedBasic(t *testing.T) {
+	if _, err := NewShardedBasic(0); err == nil {
+		t.Fatal("expected an error for zero shards")
+	}
+
+	acl, err := NewShardedBasic(8)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ips := benchmarkIPs(1000)
+	for _, ip := range ips {
+		acl.Add(ip)
+	}
+	addIPString(acl, "::1", t)
+
+	if acl.Count() != 1001 {
+		t.Fatalf("expected 1001 addresses, have %d", acl.Count())
+	}
+
+	for i, shard := range acl.shards {
+		if shard.Count() == 0 {
+			t.Fatalf("shard %d is empty", i)
+		}
+	}
+
+	for _, ip := range ips {
+		if !acl.Permitted(ip) {
+			t.Fatalf("expected %s to be permitted", ip)
+		}
+	}
+
+	// IPv4-mapped addresses are stored with their IPv4 form.
+	if rule, ok := acl.MatchRule(mustParseIP(t, "::ffff:10.0.0.5")); !ok || rule != "10.0.0.5" {
+		t.Fatalf("expected match with 10.0.0.5, have %q", rule)
+	}
+
+	for _, ip := range ips {
+		acl.Remove(ip)
+	}
+	delIPString(acl, "::1", t)
+
+	if acl.Count() != 0 || acl.Permitted(ips[0]) || acl.Permitted(nil) {
+		t.Fatalf("expected an empty ACL, have %s", acl)
+	}
+}
+
+func TestShardedBasicDumpLoad(t *testing.T) {
+	basic := NewBasic()
+	for _, addr := range []string{"127.0.0.1", "192.0.2.7", "::1", "2001:db8::5"} {
+		addIPString(basic, addr, t)
+	}
+	basic.Disable(mustParseIP(t, "192.0.2.7"))
+
+	acl, err := LoadShardedBasic(DumpBasic(basic), 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(DumpShardedBasic(acl)) != string(DumpBasic(basic)) {
+		t.Fatalf("expected dump %q, have %q", DumpBasic(basic), DumpShardedBasic(acl))
+	}
+
+	if checkIPString(acl, "192.0.2.7", t) || !checkIPString(acl, "2001:db8::5", t) {
+		t.Fatal("disabled addresses should be loaded disabled")
+	}
+
+	if _, err = LoadShardedBasic([]byte("127.0.0.1\nnot-an-address"), 4); err == nil {
+		t.Fatal("expected an invalid address to fail")
+	}
+
+	if _, err = LoadShardedBasic(nil, 0); err == nil {
+		t.Fatal("expected an error for zero shards")
+	}
+}
+
+func TestShardedBasicJSON(t *testing.T) {
+	acl, err := NewShardedBasic(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	addIPString(acl, "127.0.0.1", t)
+	addIPString(acl, "::1", t)
+
+	out, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	basic := NewBasic()
+	if err = json.Unmarshal(out, basic); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(DumpBasic(basic)) != string(DumpShardedBasic(acl)) {
+		t.Fatalf("expected %s to match %s", basic, acl)
+	}
+
+	// A zero ShardedBasic gets the default number of shards.
+	var loaded ShardedBasic
+	if err = json.Unmarshal([]byte(`["10.0.0.1", "!10.0.0.2"]`), &loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(loaded.shards) != DefaultShardCount {
+		t.Fatalf("expected %d shards, have %d", DefaultShardCount, len(loaded.shards))
+	}
+
+	if !checkIPString(&loaded, "10.0.0.1", t) || checkIPString(&loaded, "10.0.0.2", t) {
+		t.Fatalf("unexpected contents %s", &loaded)
+	}
+
+	// A bad entry leaves every shard unchanged.
+	if err = json.Unmarshal([]byte(`"10.0.0.3,bogus"`), &loaded); err == nil {
+		t.Fatal("expected an invalid address to fail")
+	}
+
+	if loaded.Count() != 2 || checkIPString(&loaded, "10.0.0.3", t) {
+		t.Fatalf("invalid JSON changed the ACL to %s", &loaded)
+	}
+}
+
+// benchmarkMixed checks addresses from many goroutines while one in
+// every 16 operations adds or removes an address. The difference
+// between Basic and ShardedBasic shows with several CPUs, e.g. with
+// -cpu 8; on one CPU there is no contention to spread.
+func benchmarkMixed(b *testing.B, acl HostACL) {
+	ips := benchmarkIPs(4096)
+	for _, ip := range ips[:2048] {
+		acl.Add(ip)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			ip := ips[i%len(ips)]
+			switch i % 16 {
+			case 0:
+				acl.Add(ip)
+			case 8:
+				acl.Remove(ip)
+			default:
+				acl.Permitted(ip)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkBasicMixed(b *testing.B) {
+	benchmarkMixed(b, NewBasic())
+}
+
+func BenchmarkShardedBasicMixed(b *testing.B) {
+	acl, err := NewShardedBasic(DefaultShardCount)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	benchmarkMixed(b, acl)
+}
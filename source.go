@@ -0,0 +1,142 @@
+package netallow
+
+// This file contains support for tracking which feed each entry in a
+// host ACL came from, so that a feed's entries can be removed when
+// it is retired.
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+// AddFromSource permits the IP, recording that it came from the
+// source named by tag. An address may come from several sources, and
+// stays in the ACL until every one of them has been removed.
+// Addresses added with Add are never removed by RemoveBySource.
+func (acl *Basic) AddFromSource(ip net.IP, tag string) {
+	if !validIP(ip) || acl.checkPolicy(ip) != nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.tagSource(ip.String(), tag)
+	acl.updateSingle()
+}
+
+// tagSource permits addr, recording that it came from the source
+// named by tag. The caller must hold the lock, and update the
+// single-entry fast path afterwards.
+func (acl *Basic) tagSource(addr, tag string) {
+	if acl.sources == nil {
+		acl.sources = map[string]map[string]bool{}
+	}
+
+	tags, ok := acl.sources[addr]
+	if !ok {
+		tags = map[string]bool{}
+		if _, added := acl.allowed[addr]; added {
+			// Already added without a source; keep it that way.
+			tags[""] = true
+		}
+		acl.sources[addr] = tags
+	}
+
+	tags[tag] = true
+	acl.allowed[addr] = true
+	acl.notify(ChangeAdd, addr)
+}
+
+// addSource records that addr was added without a source if its
+// sources are being tracked. The caller must hold the lock.
+func (acl *Basic) addSource(addr string) {
+	if tags, ok := acl.sources[addr]; ok {
+		tags[""] = true
+	}
+}
+
+// RemoveBySource drops the source named by tag from every address,
+// removing addresses that no longer have any source. It returns the
+// number of addresses removed.
+func (acl *Basic) RemoveBySource(tag string) int {
+	if tag == "" {
+		return 0
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	defer acl.updateSingle()
+	removed := 0
+	for addr, tags := range acl.sources {
+		if !tags[tag] {
+			continue
+		}
+
+		delete(tags, tag)
+		if len(tags) == 0 {
+			delete(acl.sources, addr)
+			delete(acl.allowed, addr)
+			acl.notify(ChangeRemove, addr)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Sources returns the sorted tags of the sources the IP was added
+// from. It is empty if the IP was only added with Add.
+func (acl *Basic) Sources(ip net.IP) []string {
+	if !validIP(ip) {
+		return nil
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	var tags []string
+	for tag := range acl.sources[ip.String()] {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
+// LoadSource adds the addresses in in, one per line, tagging each
+// with the source tag. Blank lines and lines starting with '#' are
+// skipped, as they are by LoadBasic. The addresses are added at
+// once, so that checks never see part of the list. If any address is
+// invalid, nothing is added.
+func (acl *Basic) LoadSource(in []byte, tag string) error {
+	if tag == "" {
+		return errors.New("netallow: source tag cannot be empty")
+	}
+
+	var addrs []string
+	for _, addr := range strings.Split(string(in), "\n") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || strings.HasPrefix(addr, "#") {
+			continue
+		}
+
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return errors.New("netallow: invalid address " + addr)
+		}
+
+		if acl.checkPolicy(ip) == nil {
+			addrs = append(addrs, ip.String())
+		}
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, addr := range addrs {
+		acl.tagSource(addr, tag)
+	}
+	acl.updateSingle()
+	return nil
+}
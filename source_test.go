@@ -0,0 +1,103 @@
+package netallow
+
+import (
+	"testing"
+)
+
+func TestRemoveBySource(t *testing.T) {
+	acl := NewBasic()
+	if err := acl.LoadSource([]byte("10.0.0.1\n10.0.0.2\n\n"), "feed-a"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := acl.LoadSource([]byte("10.0.0.2\n10.0.0.3\n"), "feed-b"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	addIPString(acl, "10.0.0.3", t)
+	addIPString(acl, "10.0.0.4", t)
+
+	sources := acl.Sources(mustParseIP(t, "10.0.0.2"))
+	if len(sources) != 2 || sources[0] != "feed-a" || sources[1] != "feed-b" {
+		t.Fatalf("unexpected sources %v", sources)
+	}
+
+	if n := acl.RemoveBySource("feed-b"); n != 0 {
+		t.Fatalf("expected no addresses to be removed, but %d were", n)
+	}
+
+	// 10.0.0.3 was also added by hand, so it stays.
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		if !checkIPString(acl, addr, t) {
+			t.Fatalf("ACL should have permitted %s", addr)
+		}
+	}
+
+	if n := acl.RemoveBySource("feed-a"); n != 2 {
+		t.Fatalf("expected 2 addresses to be removed, but %d were", n)
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.0.0.1": false,
+		"10.0.0.2": false,
+		"10.0.0.3": true,
+		"10.0.0.4": true,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if len(acl.Sources(mustParseIP(t, "10.0.0.3"))) != 0 {
+		t.Fatal("hand-added address should have no sources left")
+	}
+}
+
+func TestAddFromSourceAfterAdd(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "10.0.0.1", t)
+	acl.AddFromSource(mustParseIP(t, "10.0.0.1"), "feed")
+	acl.RemoveBySource("feed")
+	if !checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("hand-added address should survive removing its source")
+	}
+
+	acl.AddFromSource(mustParseIP(t, "10.0.0.5"), "feed")
+	delIPString(acl, "10.0.0.5", t)
+	if acl.RemoveBySource("feed") != 0 || len(acl.Sources(mustParseIP(t, "10.0.0.5"))) != 0 {
+		t.Fatal("Remove should drop an address's sources")
+	}
+}
+
+func TestLoadSourceFails(t *testing.T) {
+	acl := NewBasic()
+	if err := acl.LoadSource([]byte("10.0.0.1\nbogus\n"), "feed"); err == nil {
+		t.Fatal("LoadSource should fail with an invalid address")
+	}
+
+	if checkIPString(acl, "10.0.0.1", t) {
+		t.Fatal("failed load should not add any addresses")
+	}
+
+	if err := acl.LoadSource([]byte("10.0.0.1\n"), ""); err == nil {
+		t.Fatal("LoadSource should fail with an empty tag")
+	}
+}
+
+func TestLoadSourceComments(t *testing.T) {
+	acl := NewBasic()
+	in := []byte("# feed of partner addresses\n10.0.0.1\n\n  # trailing comment\n10.0.0.2\n")
+	if err := acl.LoadSource(in, "feed"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2"} {
+		if !checkIPString(acl, addr, t) {
+			t.Fatalf("expected %s to have been loaded", addr)
+		}
+	}
+
+	if acl.RemoveBySource("feed") != 2 {
+		t.Fatal("expected both addresses to be tagged with the source")
+	}
+}
@@ -0,0 +1,35 @@
+package netallow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kisom/netallow"
+	"github.com/kisom/netallow/netallowtest"
+)
+
+const stressDuration = 100 * time.Millisecond
+
+func TestStressBasic(t *testing.T) {
+	netallowtest.StressACL(t, netallow.NewBasic(), stressDuration)
+}
+
+func TestStressBasicNet(t *testing.T) {
+	netallowtest.StressACL(t, netallow.NewBasicNet(), stressDuration)
+}
+
+func TestStressRuleSet(t *testing.T) {
+	netallowtest.StressACL(t, netallow.NewRuleSet(), stressDuration)
+}
+
+func TestStressMethodACL(t *testing.T) {
+	netallowtest.StressACL(t, netallow.NewMethodACL(), stressDuration)
+}
+
+func TestStressPrefixCache(t *testing.T) {
+	cache, err := netallow.NewPrefixCache(netallow.NewBasicNet(), 24, 64, time.Minute)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	netallowtest.StressACL(t, cache, stressDuration)
+}
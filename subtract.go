@@ -0,0 +1,62 @@
+package netallow
+
+import (
+	"net"
+)
+
+// NetSubtract returns a network ACL permitting the addresses that a
+// permits and b doesn't, such as for "allow this block except this
+// sub-block". Networks in a that partially overlap a network in b
+// are split into the fewest prefixes covering the remainder; for
+// example, 10.0.0.0/24 minus 10.0.0.0/26 is 10.0.0.64/26 and
+// 10.0.0.128/25. IPv4 and IPv6 networks never affect each other.
+// The result is sorted, and neither ACL is modified.
+func NetSubtract(a, b *BasicNet) *BasicNet {
+	a.lock.RLock()
+	remaining := dropCovered(a.allowed)
+	a.lock.RUnlock()
+
+	b.lock.RLock()
+	carve := make([]*net.IPNet, len(b.allowed))
+	copy(carve, b.allowed)
+	b.lock.RUnlock()
+
+	for _, m := range carve {
+		var next []*net.IPNet
+		for _, n := range remaining {
+			next = append(next, subtractNet(n, m)...)
+		}
+		remaining = next
+	}
+
+	sortNets(remaining)
+	acl := NewBasicNet()
+	acl.allowed = remaining
+	return acl
+}
+
+// subtractNet returns the prefixes covering the addresses in n that
+// aren't in m.
+func subtractNet(n, m *net.IPNet) []*net.IPNet {
+	if covers(m, n) {
+		return nil
+	}
+
+	if !covers(n, m) {
+		return []*net.IPNet{n}
+	}
+
+	// m lies inside n: walking down from n towards m, keep the
+	// half at each level that doesn't contain m.
+	_, ones, bits := prefixOf(n)
+	mIP, mOnes, _ := prefixOf(m)
+	var out []*net.IPNet
+	for i := ones; i < mOnes; i++ {
+		sibling := mIP.Mask(net.CIDRMask(i, bits))
+		if bitAt(mIP, i) == 0 {
+			sibling = setBit(sibling, i)
+		}
+		out = append(out, &net.IPNet{IP: sibling, Mask: net.CIDRMask(i+1, bits)})
+	}
+	return out
+}
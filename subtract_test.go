@@ -0,0 +1,112 @@
+package netallow
+
+import (
+	"testing"
+)
+
+func testNetList(acl *BasicNet) []string {
+	var nets []string
+	for _, n := range acl.allowed {
+		nets = append(nets, n.String())
+	}
+	return nets
+}
+
+func TestNetSubtract(t *testing.T) {
+	tv := []struct {
+		name     string
+		a, b     []string
+		expected []string
+	}{
+		{
+			"nested",
+			[]string{"10.0.0.0/24"},
+			[]string{"10.0.0.0/26"},
+			[]string{"10.0.0.64/26", "10.0.0.128/25"},
+		},
+		{
+			"nested in the middle",
+			[]string{"10.0.0.0/24"},
+			[]string{"10.0.0.64/26"},
+			[]string{"10.0.0.0/26", "10.0.0.128/25"},
+		},
+		{
+			"host",
+			[]string{"192.168.1.0/30"},
+			[]string{"192.168.1.2/32"},
+			[]string{"192.168.1.0/31", "192.168.1.3/32"},
+		},
+		{
+			"covered",
+			[]string{"10.1.0.0/16", "192.168.0.0/16"},
+			[]string{"10.0.0.0/8"},
+			[]string{"192.168.0.0/16"},
+		},
+		{
+			"partial",
+			[]string{"10.0.0.0/24", "10.0.1.0/24"},
+			[]string{"10.0.0.128/25", "10.0.1.0/24"},
+			[]string{"10.0.0.0/25"},
+		},
+		{
+			"disjoint",
+			[]string{"10.0.0.0/8"},
+			[]string{"192.168.0.0/16"},
+			[]string{"10.0.0.0/8"},
+		},
+		{
+			"families",
+			[]string{"10.0.0.0/8", "2001:db8::/32"},
+			[]string{"2001:db8:8000::/33", "0.0.0.0/0"},
+			[]string{"2001:db8::/33"},
+		},
+	}
+
+	for _, tc := range tv {
+		a, b := NewBasicNet(), NewBasicNet()
+		for _, n := range tc.a {
+			testAddNet(a, n, t)
+		}
+		for _, n := range tc.b {
+			testAddNet(b, n, t)
+		}
+
+		nets := testNetList(NetSubtract(a, b))
+		if len(nets) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, but have %v", tc.name, tc.expected, nets)
+		}
+
+		for i := range nets {
+			if nets[i] != tc.expected[i] {
+				t.Fatalf("%s: expected %v, but have %v", tc.name, tc.expected, nets)
+			}
+		}
+
+		if len(testNetList(a)) != len(tc.a) {
+			t.Fatalf("%s: NetSubtract modified its input", tc.name)
+		}
+	}
+}
+
+func TestNetSubtractMembership(t *testing.T) {
+	a, b := NewBasicNet(), NewBasicNet()
+	testAddNet(a, "172.16.0.0/12", t)
+	testAddNet(b, "172.20.5.0/24", t)
+	testAddNet(b, "172.31.255.255/32", t)
+
+	diff := NetSubtract(a, b)
+	for addr, expected := range map[string]bool{
+		"172.16.0.1":     true,
+		"172.20.4.255":   true,
+		"172.20.5.0":     false,
+		"172.20.5.255":   false,
+		"172.20.6.0":     true,
+		"172.31.255.254": true,
+		"172.31.255.255": false,
+		"172.32.0.0":     false,
+	} {
+		if checkIPString(diff, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+}
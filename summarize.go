@@ -0,0 +1,82 @@
+package netallow
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// Summarize groups the hosts in b into networks, returning a network
+// ACL covering every enabled host in b. It is intended for reporting
+// and export, where a long list of hosts is hard to read.
+//
+// maxPrefixGap controls how much precision may be given up: it is
+// the largest number of addresses that aren't in b that any one
+// summarized network may contain. With a gap of 0 the summary is
+// exact, and only runs of hosts that fill an entire network are
+// merged; a larger gap allows sparser runs of hosts to be merged at
+// the cost of also covering the addresses between them. The largest
+// network meeting the gap is always chosen.
+func Summarize(b *Basic, maxPrefixGap int) *BasicNet {
+	if maxPrefixGap < 0 {
+		maxPrefixGap = 0
+	}
+
+	var v4, v6 []net.IP
+	b.lock.RLock()
+	for addr, enabled := range b.allowed {
+		if !enabled {
+			continue
+		}
+
+		ip := net.ParseIP(addr)
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4)
+		} else if ip != nil {
+			v6 = append(v6, ip)
+		}
+	}
+	b.lock.RUnlock()
+
+	acl := NewBasicNet()
+	for _, ips := range [][]net.IP{v4, v6} {
+		if len(ips) == 0 {
+			continue
+		}
+
+		sort.Slice(ips, func(i, j int) bool {
+			return bytes.Compare(ips[i], ips[j]) < 0
+		})
+
+		prefix := make(net.IP, len(ips[0]))
+		acl.allowed = append(acl.allowed,
+			summarize(ips, prefix, 0, len(prefix)*8, uint64(maxPrefixGap))...)
+	}
+	return acl
+}
+
+// summarize returns the networks covering the sorted addresses in ips,
+// all of which are in the network prefix/ones.
+func summarize(ips []net.IP, prefix net.IP, ones, bits int, gap uint64) []*net.IPNet {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	// A network with 2^63 or more addresses can never meet the
+	// gap, since it is an int.
+	if hostBits := uint(bits - ones); hostBits < 63 {
+		size := uint64(1) << hostBits
+		if size-uint64(len(ips)) <= gap {
+			return []*net.IPNet{{IP: prefix, Mask: net.CIDRMask(ones, bits)}}
+		}
+	}
+
+	// The addresses are sorted, so those with a zero at this bit
+	// come before those with a one.
+	split := sort.Search(len(ips), func(i int) bool {
+		return bitAt(ips[i], ones) == 1
+	})
+
+	nets := summarize(ips[:split], prefix, ones+1, bits, gap)
+	return append(nets, summarize(ips[split:], setBit(prefix, ones), ones+1, bits, gap)...)
+}
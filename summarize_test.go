@@ -0,0 +1,74 @@
+package netallow
+
+import (
+	"sort"
+	"testing"
+)
+
+func testSummary(acl *BasicNet) []string {
+	var ss []string
+	for _, n := range acl.allowed {
+		ss = append(ss, n.String())
+	}
+	sort.Strings(ss)
+	return ss
+}
+
+func TestSummarize(t *testing.T) {
+	acl := NewBasic()
+	for _, addr := range []string{
+		"192.168.1.0", "192.168.1.1", "192.168.1.2", "192.168.1.3",
+		"192.168.1.4", "192.168.1.6",
+		"10.0.0.1",
+		"2001:db8::", "2001:db8::1",
+	} {
+		addIPString(acl, addr, t)
+	}
+
+	tv := []struct {
+		gap      int
+		expected []string
+	}{
+		{0, []string{
+			"10.0.0.1/32", "192.168.1.0/30", "192.168.1.4/32",
+			"192.168.1.6/32", "2001:db8::/127",
+		}},
+		{1, []string{
+			"10.0.0.0/31", "192.168.1.0/30", "192.168.1.4/31",
+			"192.168.1.6/31", "2001:db8::/127",
+		}},
+		{2, []string{
+			"10.0.0.0/31", "192.168.1.0/29", "2001:db8::/126",
+		}},
+	}
+
+	for _, tc := range tv {
+		summary := testSummary(Summarize(acl, tc.gap))
+		if len(summary) != len(tc.expected) {
+			t.Fatalf("gap %d: expected %v, but have %v", tc.gap, tc.expected, summary)
+		}
+
+		for i := range summary {
+			if summary[i] != tc.expected[i] {
+				t.Fatalf("gap %d: expected %v, but have %v", tc.gap, tc.expected, summary)
+			}
+		}
+	}
+
+	summary := Summarize(acl, 0)
+	for _, addr := range []string{"192.168.1.3", "192.168.1.6", "2001:db8::1"} {
+		if !checkIPString(summary, addr, t) {
+			t.Fatalf("summary should permit %s", addr)
+		}
+	}
+
+	if checkIPString(summary, "192.168.1.5", t) {
+		t.Fatal("exact summary should not permit 192.168.1.5")
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	if len(Summarize(NewBasic(), 0).allowed) != 0 {
+		t.Fatal("summary of an empty ACL should be empty")
+	}
+}
@@ -0,0 +1,70 @@
+package netallow
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// DefaultTagHeader is the header a TagHandler sets if it isn't given
+// one.
+const DefaultTagHeader = "X-Netallow-Permitted"
+
+// TagHandler runs an ACL in observe mode: every request is passed to
+// the wrapped handler, but the ACL's decision is recorded as "true"
+// or "false" in a header, so that the requests an ACL would block can
+// be measured before it is enforced. The header is set on both the
+// request, for the wrapped handler and anything it calls, and the
+// response. Any value the client sent in the header is replaced.
+// Requests whose address can't be found are tagged "false".
+type TagHandler struct {
+	handler *Handler
+}
+
+// NewTagHandler returns a handler that passes every request to next,
+// tagging it with the ACL's decision in header. If header is empty,
+// DefaultTagHeader is used.
+func NewTagHandler(next http.Handler, acl ACL, header string) (*TagHandler, error) {
+	if next == nil {
+		return nil, errors.New("netallow: next cannot be nil")
+	}
+
+	if header == "" {
+		header = DefaultTagHeader
+	}
+
+	tag := func(permitted bool) http.Handler {
+		value := strconv.FormatBool(permitted)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.Header.Set(header, value)
+			w.Header().Set(header, value)
+			next.ServeHTTP(w, req)
+		})
+	}
+
+	h, err := NewACLHandler(tag(true), tag(false), acl)
+	if err != nil {
+		return nil, err
+	}
+	h.OnLookupError(FailClosed)
+
+	return &TagHandler{handler: h}, nil
+}
+
+// SetACL replaces the handler's ACL. It may be called while the
+// handler is serving requests.
+func (h *TagHandler) SetACL(acl ACL) error {
+	return h.handler.SetACL(acl)
+}
+
+// SetLookup sets how the client's address is found, as with
+// Handler.SetLookup.
+func (h *TagHandler) SetLookup(lookup Lookup) {
+	h.handler.SetLookup(lookup)
+}
+
+// ServeHTTP tags the request with the ACL's decision and passes it
+// on.
+func (h *TagHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.handler.ServeHTTP(w, req)
+}
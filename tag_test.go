@@ -0,0 +1,65 @@
+package netallow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTagHandler(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "192.0.2.1", t)
+
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = req.Header.Get("X-Rollout")
+		w.Write([]byte("OK"))
+	})
+
+	h, err := NewTagHandler(next, acl, "X-Rollout")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for remote, expected := range map[string]string{
+		"192.0.2.1:4141": "true",
+		"192.0.2.2:4141": "false",
+		"bad-address":    "false",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Rollout", "true")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Body.String() != "OK" {
+			t.Fatalf("%s: every request should be served, but got %s", remote, w.Body.String())
+		}
+
+		if seen != expected || w.Header().Get("X-Rollout") != expected {
+			t.Fatalf("%s: expected the request and response to be tagged %s, but have %q and %q",
+				remote, expected, seen, w.Header().Get("X-Rollout"))
+		}
+	}
+
+	h, err = NewTagHandler(next, acl, "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:4141"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get(DefaultTagHeader) != "true" {
+		t.Fatalf("expected the default header to be set")
+	}
+
+	if _, err = NewTagHandler(nil, acl, ""); err == nil {
+		t.Fatal("NewTagHandler should reject a nil handler")
+	}
+
+	if _, err = NewTagHandler(next, nil, ""); err == nil {
+		t.Fatal("NewTagHandler should reject a nil ACL")
+	}
+}
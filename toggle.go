@@ -0,0 +1,87 @@
+package netallow
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// ToggleACL wraps an ACL so that enforcement can be turned on and off
+// while it is in use, for a staged rollout: deploy it observing, check
+// what would be denied, and then turn on enforcement, for example from
+// an admin endpoint. While it isn't enforcing, every address is
+// permitted; addresses the wrapped ACL would deny are logged if a
+// Logger was given. While it is enforcing, the wrapped ACL decides.
+type ToggleACL struct {
+	enforcing int32 // accessed atomically
+	acl       ACL
+	logger    Logger
+}
+
+// NewToggleACL returns a ToggleACL wrapping acl that starts out not
+// enforcing. If logger is nil, addresses that would have been denied
+// aren't logged. It returns an error if acl is nil.
+func NewToggleACL(acl ACL, logger Logger) (*ToggleACL, error) {
+	if acl == nil {
+		return nil, errors.New("netallow: ACL cannot be nil")
+	}
+
+	return &ToggleACL{
+		acl:    acl,
+		logger: logger,
+	}, nil
+}
+
+// ACL returns the wrapped ACL.
+func (t *ToggleACL) ACL() ACL {
+	return t.acl
+}
+
+// SetEnforcing turns enforcement on or off. It may be called while
+// the ACL is being checked.
+func (t *ToggleACL) SetEnforcing(enforcing bool) {
+	if enforcing {
+		atomic.StoreInt32(&t.enforcing, 1)
+	} else {
+		atomic.StoreInt32(&t.enforcing, 0)
+	}
+}
+
+// Enforcing returns true if the wrapped ACL's decisions are being
+// enforced.
+func (t *ToggleACL) Enforcing() bool {
+	return atomic.LoadInt32(&t.enforcing) == 1
+}
+
+// Permitted returns the wrapped ACL's decision if enforcing, and true
+// otherwise.
+func (t *ToggleACL) Permitted(ip net.IP) bool {
+	if t.Enforcing() {
+		return t.acl.Permitted(ip)
+	}
+
+	if t.logger != nil && !t.acl.Permitted(ip) {
+		t.logger.Printf("netallow: not enforcing; %s would have been denied", ip)
+	}
+	return true
+}
+
+// checkRequest passes the request to the wrapped ACL, permitting it
+// regardless of the decision if not enforcing.
+func (t *ToggleACL) checkRequest(req *http.Request, ip net.IP) (*http.Request, bool, string) {
+	enforcing := t.Enforcing()
+	if !enforcing && t.logger == nil {
+		return req, true, ""
+	}
+
+	req, permitted, rule := checkRequest(t.acl, req, ip)
+	if enforcing {
+		return req, permitted, rule
+	}
+
+	if !permitted {
+		t.logger.Printf("netallow: not enforcing; %s would have been denied", ip)
+	}
+	return req, true, rule
+}
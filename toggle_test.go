@@ -0,0 +1,101 @@
+package netallow
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestToggleACL(t *testing.T) {
+	var buf bytes.Buffer
+	inner := NewBasic()
+	addIPString(inner, "127.0.0.1", t)
+	acl, err := NewToggleACL(inner, log.New(&buf, "", 0))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if acl.Enforcing() {
+		t.Fatal("ACL should start out not enforcing")
+	}
+
+	if !checkIPString(acl, "192.0.2.1", t) || !checkIPString(acl, "127.0.0.1", t) {
+		t.Fatal("ACL should permit everything while not enforcing")
+	}
+
+	if !strings.Contains(buf.String(), "192.0.2.1 would have been denied") {
+		t.Fatalf("expected the denial to be logged, have %q", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "127.0.0.1") {
+		t.Fatalf("permitted addresses shouldn't be logged, have %q", buf.String())
+	}
+
+	acl.SetEnforcing(true)
+	if !acl.Enforcing() {
+		t.Fatal("ACL should be enforcing")
+	}
+
+	buf.Reset()
+	if checkIPString(acl, "192.0.2.1", t) || !checkIPString(acl, "127.0.0.1", t) {
+		t.Fatal("ACL should enforce the wrapped ACL's decisions")
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("nothing should be logged while enforcing, have %q", buf.String())
+	}
+
+	acl.SetEnforcing(false)
+	if !checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("ACL should permit everything once enforcement is off")
+	}
+
+	// Without a logger, nothing is logged.
+	quiet, err := NewToggleACL(inner, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(quiet, "192.0.2.1", t) {
+		t.Fatal("ACL should permit everything while not enforcing")
+	}
+
+	if _, err = NewToggleACL(nil, nil); err == nil {
+		t.Fatal("NewToggleACL should reject a nil ACL")
+	}
+}
+
+func TestToggleACLConcurrent(t *testing.T) {
+	inner := NewBasic()
+	acl, err := NewToggleACL(inner, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ip := mustParseIP(t, "192.0.2.1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				acl.Permitted(ip)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				acl.SetEnforcing((i+j)%2 == 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	acl.SetEnforcing(true)
+	if acl.Permitted(ip) {
+		t.Fatal("ACL should deny once enforcing")
+	}
+}
@@ -0,0 +1,195 @@
+package netallow
+
+// This file contains an ACL that permits clients presenting a signed
+// token listing the networks they may connect from, which lets edge
+// nodes authorise clients without a central list.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestPermitter is implemented by ACLs that need more of the
+// request than the client address to make a decision.
+type requestPermitter interface {
+	PermittedRequest(ip net.IP, req *http.Request) bool
+}
+
+// A TokenSigner signs and verifies token payloads. It allows the
+// signature scheme used by a TokenACL to be replaced.
+type TokenSigner interface {
+	Sign(payload []byte) ([]byte, error)
+	Verify(payload, sig []byte) bool
+}
+
+type hmacSigner struct {
+	key []byte
+}
+
+func (s hmacSigner) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+func (s hmacSigner) Verify(payload, sig []byte) bool {
+	expected, _ := s.Sign(payload)
+	return hmac.Equal(expected, sig)
+}
+
+// NewHMACSigner returns a TokenSigner that signs payloads with
+// HMAC-SHA256 under the key.
+func NewHMACSigner(key []byte) TokenSigner {
+	k := make([]byte, len(key))
+	copy(k, key)
+	return hmacSigner{key: k}
+}
+
+// DefaultTokenHeader is the request header a TokenACL reads tokens
+// from if no other header is given.
+const DefaultTokenHeader = "X-Netallow-Token"
+
+type tokenPayload struct {
+	Prefixes []string `json:"prefixes"`
+	Expires  int64    `json:"exp"`
+}
+
+// TokenACL permits clients presenting a valid token that binds them
+// to the networks they may connect from. A token is the
+// base64url-encoded JSON payload and its base64url-encoded
+// signature, separated by a period; the payload lists the permitted
+// networks and the token's expiry time in seconds since the epoch.
+type TokenACL struct {
+	lock   *sync.Mutex
+	signer TokenSigner
+	header string
+	clock  Clock
+}
+
+// NewTokenACL returns a TokenACL that verifies tokens with signer,
+// reading them from the named request header. If header is empty,
+// DefaultTokenHeader is used.
+func NewTokenACL(signer TokenSigner, header string) (*TokenACL, error) {
+	if signer == nil {
+		return nil, errors.New("netallow: token signer cannot be nil")
+	}
+
+	if header == "" {
+		header = DefaultTokenHeader
+	}
+
+	return &TokenACL{
+		lock:   new(sync.Mutex),
+		signer: signer,
+		header: header,
+		clock:  SystemClock,
+	}, nil
+}
+
+// SetClock sets the clock used to check token expiry. A nil clock
+// selects the system clock.
+func (acl *TokenACL) SetClock(clock Clock) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.clock = clockOrSystem(clock)
+}
+
+func (acl *TokenACL) now() time.Time {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	return acl.clock.Now()
+}
+
+// Issue returns a token permitting clients in any of the networks
+// until it expires.
+func (acl *TokenACL) Issue(prefixes []*net.IPNet, expires time.Time) (string, error) {
+	if len(prefixes) == 0 {
+		return "", errors.New("netallow: token must permit at least one network")
+	}
+
+	payload := tokenPayload{Expires: expires.Unix()}
+	for _, n := range prefixes {
+		if n == nil {
+			return "", errors.New("netallow: invalid network in token")
+		}
+		payload.Prefixes = append(payload.Prefixes, n.String())
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := acl.signer.Sign(out)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(out) + "." +
+		base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// PermittedToken returns true if the token is validly signed, hasn't
+// expired, and permits a network containing the IP.
+func (acl *TokenACL) PermittedToken(ip net.IP, token string) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	if !acl.signer.Verify(payload, sig) {
+		return false
+	}
+
+	var tp tokenPayload
+	if err = json.Unmarshal(payload, &tp); err != nil {
+		return false
+	}
+
+	if !acl.now().Before(time.Unix(tp.Expires, 0)) {
+		return false
+	}
+
+	for _, prefix := range tp.Prefixes {
+		_, n, err := net.ParseCIDR(prefix)
+		if err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermittedRequest returns true if the request carries a token
+// permitting the IP.
+func (acl *TokenACL) PermittedRequest(ip net.IP, req *http.Request) bool {
+	return acl.PermittedToken(ip, req.Header.Get(acl.header))
+}
+
+// Permitted always returns false, as a token is required. It allows
+// a TokenACL to be used with a Handler, which will pass it the
+// request's token.
+func (acl *TokenACL) Permitted(ip net.IP) bool {
+	return false
+}
@@ -0,0 +1,123 @@
+package netallow
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTokenACL(t *testing.T) (*TokenACL, *testClock) {
+	acl, err := NewTokenACL(NewHMACSigner([]byte("test key")), "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	clock := newTestClock()
+	acl.SetClock(clock)
+	return acl, clock
+}
+
+func testIssueToken(acl *TokenACL, clock Clock, t *testing.T, cidrs ...string) string {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		nets = append(nets, n)
+	}
+
+	token, err := acl.Issue(nets, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return token
+}
+
+func TestTokenACL(t *testing.T) {
+	acl, clock := testTokenACL(t)
+	token := testIssueToken(acl, clock, t, "10.0.0.0/8", "2001:db8::/32")
+
+	for addr, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"2001:db8::1": true,
+		"192.168.1.1": false,
+	} {
+		if acl.PermittedToken(net.ParseIP(addr), token) != expected {
+			t.Fatalf("expected PermittedToken(%s) to be %v", addr, expected)
+		}
+	}
+
+	if acl.Permitted(net.ParseIP("10.1.2.3")) {
+		t.Fatal("ACL should deny addresses without a token")
+	}
+
+	clock.Advance(time.Hour)
+	if acl.PermittedToken(net.ParseIP("10.1.2.3"), token) {
+		t.Fatal("ACL should deny an expired token")
+	}
+}
+
+func TestTokenACLTampered(t *testing.T) {
+	acl, clock := testTokenACL(t)
+	token := testIssueToken(acl, clock, t, "10.0.0.0/8")
+	ip := net.ParseIP("192.168.1.1")
+
+	// Splice the signature from a valid token onto a payload
+	// for a different network.
+	other := testIssueToken(acl, clock, t, "192.168.0.0/16")
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(other, ".")
+	if acl.PermittedToken(ip, otherParts[0]+"."+parts[1]) {
+		t.Fatal("ACL should deny a tampered token")
+	}
+
+	otherACL, err := NewTokenACL(NewHMACSigner([]byte("other key")), "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	otherACL.SetClock(clock)
+	if otherACL.PermittedToken(net.ParseIP("10.1.2.3"), token) {
+		t.Fatal("ACL should deny a token signed with another key")
+	}
+
+	for _, bad := range []string{"", "abc", "a.b.c", "!!.!!", parts[0] + ".!!"} {
+		if acl.PermittedToken(ip, bad) {
+			t.Fatalf("ACL should deny malformed token %q", bad)
+		}
+	}
+}
+
+func TestTokenACLHandler(t *testing.T) {
+	acl, clock := testTokenACL(t)
+	token := testIssueToken(acl, clock, t, "127.0.0.0/8")
+
+	h, err := NewHandler(testAllowHandler, testDenyHandler, acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for tok, expected := range map[string]string{token: "OK", "": "NO"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		req.Header.Set(DefaultTokenHeader, tok)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("Expected %s, but got %s", expected, w.Body.String())
+		}
+	}
+}
+
+func TestTokenACLFails(t *testing.T) {
+	if _, err := NewTokenACL(nil, ""); err == nil {
+		t.Fatal("NewTokenACL should fail with a nil signer")
+	}
+
+	acl, _ := testTokenACL(t)
+	if _, err := acl.Issue(nil, time.Now()); err == nil {
+		t.Fatal("Issue should fail without any networks")
+	}
+}
@@ -0,0 +1,206 @@
+package netallow
+
+// This file contains a network ACL backed by a binary trie, for
+// ACLs with too many networks to scan on each check.
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type trieNode struct {
+	children [2]*trieNode
+	net      *net.IPNet // non-nil if a network ends at this node
+}
+
+// TrieNet is a network ACL that stores networks in a binary trie
+// keyed on their prefix bits, so that checking an address takes time
+// proportional to the address length rather than to the number of
+// networks. IPv4 and IPv6 networks are kept in separate tries; as
+// with BasicNet, IPv4 addresses never match IPv6 networks. It is a
+// drop-in replacement for BasicNet, and uses the same JSON format.
+type TrieNet struct {
+	lock *sync.RWMutex
+	v4   *trieNode
+	v6   *trieNode
+}
+
+// NewTrieNet returns a new, empty trie-backed network ACL.
+func NewTrieNet() *TrieNet {
+	return &TrieNet{
+		lock: new(sync.RWMutex),
+		v4:   &trieNode{},
+		v6:   &trieNode{},
+	}
+}
+
+// root returns the trie for addresses of the given length in bits.
+// The caller must hold the lock.
+func (acl *TrieNet) root(bits int) *trieNode {
+	if bits == 32 {
+		return acl.v4
+	}
+	return acl.v6
+}
+
+// Add permits the network.
+func (acl *TrieNet) Add(n *net.IPNet) {
+	ip, ones, bits := prefixOf(n)
+	if ip == nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	node := acl.root(bits)
+	for i := 0; i < ones; i++ {
+		b := bitAt(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = &trieNode{}
+		}
+		node = node.children[b]
+	}
+	node.net = &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, bits)}
+}
+
+// Remove drops the network from the ACL. Only a network that was
+// added is removed; removing part of a larger network has no effect.
+func (acl *TrieNet) Remove(n *net.IPNet) {
+	ip, ones, bits := prefixOf(n)
+	if ip == nil {
+		return
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	trieRemove(acl.root(bits), ip, 0, ones)
+}
+
+// trieRemove removes the network ending at depth ones below node,
+// pruning nodes that are left empty. It returns true if node is now
+// empty.
+func trieRemove(node *trieNode, ip net.IP, depth, ones int) bool {
+	if node == nil {
+		return false
+	}
+
+	if depth == ones {
+		node.net = nil
+	} else {
+		b := bitAt(ip, depth)
+		if trieRemove(node.children[b], ip, depth+1, ones) {
+			node.children[b] = nil
+		}
+	}
+
+	return node.net == nil && node.children[0] == nil && node.children[1] == nil
+}
+
+// match returns the shortest network containing the IP.
+func (acl *TrieNet) match(ip net.IP) *net.IPNet {
+	if !validIP(ip) {
+		return nil
+	}
+
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	node := acl.root(bits)
+	for i := 0; node != nil; i++ {
+		if node.net != nil {
+			return node.net
+		}
+
+		if i == bits {
+			break
+		}
+		node = node.children[bitAt(ip, i)]
+	}
+	return nil
+}
+
+// Permitted returns true if the IP is in a permitted network.
+func (acl *TrieNet) Permitted(ip net.IP) bool {
+	return acl.match(ip) != nil
+}
+
+// MatchRule returns true and the broadest network containing the IP
+// if the IP is permitted.
+func (acl *TrieNet) MatchRule(ip net.IP) (string, bool) {
+	n := acl.match(ip)
+	if n == nil {
+		return "", false
+	}
+	return n.String(), true
+}
+
+// collect appends the networks at or below node to nets.
+func (node *trieNode) collect(nets []string) []string {
+	if node == nil {
+		return nets
+	}
+
+	if node.net != nil {
+		nets = append(nets, node.net.String())
+	}
+	nets = node.children[0].collect(nets)
+	return node.children[1].collect(nets)
+}
+
+// entries returns a sorted copy of the networks in the ACL.
+func (acl *TrieNet) entries() []string {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	nets := acl.v4.collect(nil)
+	nets = acl.v6.collect(nets)
+	sort.Strings(nets)
+	return nets
+}
+
+// MarshalJSON serialises the ACL to a comma-separated list of
+// networks, in the same format as BasicNet.
+func (acl *TrieNet) MarshalJSON() ([]byte, error) {
+	out := []byte(`"` + strings.Join(acl.entries(), ",") + `"`)
+	return out, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, taking
+// any of the forms read by BasicNet's UnmarshalJSON: a comma-separated
+// string of networks, an array of networks, or null for an empty ACL.
+// The new networks are swapped in at once, and the ACL is left
+// unchanged if any of them is invalid.
+func (acl *TrieNet) UnmarshalJSON(in []byte) error {
+	entries, err := jsonEntries(in)
+	if err != nil {
+		return err
+	}
+
+	fresh := NewTrieNet()
+	for _, entry := range entries {
+		n, err := parseNet(entry)
+		if err != nil {
+			return err
+		}
+
+		if n = canonicalNet(n); n == nil {
+			return errors.New("netallow: invalid network " + entry)
+		}
+		fresh.Add(n)
+	}
+
+	if acl.lock == nil {
+		acl.lock = new(sync.RWMutex)
+	}
+
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	acl.v4, acl.v6 = fresh.v4, fresh.v6
+	return nil
+}
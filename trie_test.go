@@ -0,0 +1,210 @@
+package netallow
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestTrieNet(t *testing.T) {
+	acl := NewTrieNet()
+	acl.Add(nil)
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "10.1.0.0/16", t)
+	testAddNet(acl, "192.168.3.0/24", t)
+	testAddNet(acl, "2001:db8::/32", t)
+	testAddNet(acl, "0.0.0.0/0", t)
+	testDelNet(acl, "0.0.0.0/0", t)
+
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":           true,
+		"10.1.2.3":           true,
+		"192.168.3.255":      true,
+		"::ffff:192.168.3.1": true,
+		"192.168.4.1":        false,
+		"2001:db8::1":        true,
+		"2001:db9::1":        false,
+		"::ffff:10.0.0.1":    true,
+	} {
+		if checkIPString(acl, addr, t) != expected {
+			t.Fatalf("expected Permitted(%s) to be %v", addr, expected)
+		}
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("ACL should have denied invalid address")
+	}
+
+	rule, _ := acl.MatchRule(mustParseIP(t, "10.1.2.3"))
+	if rule != "10.0.0.0/8" {
+		t.Fatalf("expected match with 10.0.0.0/8, but have %s", rule)
+	}
+
+	// Removing the broader network leaves the narrower one.
+	testDelNet(acl, "10.0.0.0/8", t)
+	if checkIPString(acl, "10.0.0.1", t) || !checkIPString(acl, "10.1.2.3", t) {
+		t.Fatal("removing 10.0.0.0/8 should leave 10.1.0.0/16")
+	}
+
+	// Removing a network that was never added does nothing.
+	testDelNet(acl, "10.1.2.0/24", t)
+	if !checkIPString(acl, "10.1.2.3", t) {
+		t.Fatal("removing an unknown network should not change the ACL")
+	}
+
+	testDelNet(acl, "10.1.0.0/16", t)
+	testDelNet(acl, "192.168.3.0/24", t)
+	if acl.v4.children[0] != nil || acl.v4.children[1] != nil {
+		t.Fatal("empty trie nodes should have been pruned")
+	}
+}
+
+func TestTrieNetHost(t *testing.T) {
+	acl := NewTrieNet()
+	testAddNet(acl, "192.168.1.1/32", t)
+	testAddNet(acl, "::1/128", t)
+
+	if !checkIPString(acl, "192.168.1.1", t) || checkIPString(acl, "192.168.1.2", t) {
+		t.Fatal("ACL should only permit the host")
+	}
+
+	if !checkIPString(acl, "::1", t) || checkIPString(acl, "::2", t) {
+		t.Fatal("ACL should only permit the IPv6 host")
+	}
+}
+
+func TestTrieNetJSON(t *testing.T) {
+	acl := NewTrieNet()
+	testAddNet(acl, "192.168.7.0/24", t)
+	testAddNet(acl, "192.168.3.0/24", t)
+	testAddNet(acl, "2001:db8::/32", t)
+
+	out, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != `"192.168.3.0/24,192.168.7.0/24,2001:db8::/32"` {
+		t.Fatalf("unexpected JSON %s", out)
+	}
+
+	// The format is shared with BasicNet.
+	basic := NewBasicNet()
+	if err = json.Unmarshal(out, basic); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err = json.Marshal(basic)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var loaded TrieNet
+	if err = json.Unmarshal(out, &loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(&loaded, "192.168.3.1", t) || checkIPString(&loaded, "192.168.4.1", t) {
+		t.Fatal("loaded ACL doesn't match the original")
+	}
+
+	if err = loaded.UnmarshalJSON([]byte(`"192.168.3.1,127.0.0.256"`)); err == nil {
+		t.Fatal("Expected failure unmarshaling bad JSON input.")
+	}
+
+	if !checkIPString(&loaded, "192.168.3.1", t) {
+		t.Fatal("failed unmarshal should leave the ACL unchanged")
+	}
+}
+
+// TestTrieNetMatchesBasicNet checks random addresses against both
+// network ACLs.
+func TestTrieNetMatchesBasicNet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	trie, basic := NewTrieNet(), NewBasicNet()
+	for i := 0; i < 500; i++ {
+		ip := net.IPv4(10, byte(rng.Intn(256)), byte(rng.Intn(256)), 0)
+		n := &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(16+rng.Intn(17), 32)}
+		n.IP = n.IP.Mask(n.Mask)
+		trie.Add(n)
+		basic.Add(n)
+	}
+
+	for i := 0; i < 10000; i++ {
+		ip := net.IPv4(10, byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)))
+		if trie.Permitted(ip) != basic.Permitted(ip) {
+			t.Fatalf("TrieNet and BasicNet disagree on %s", ip)
+		}
+	}
+}
+
+func benchmarkNetACL(b *testing.B, acl NetACL) {
+	for i := 0; i < 10000; i++ {
+		acl.Add(&net.IPNet{
+			IP:   net.IP{10, byte(i >> 8), byte(i), 0},
+			Mask: net.CIDRMask(24, 32),
+		})
+	}
+
+	ip := net.IP{192, 168, 1, 1}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		acl.Permitted(ip)
+	}
+}
+
+func BenchmarkTrieNet(b *testing.B) {
+	benchmarkNetACL(b, NewTrieNet())
+}
+
+func BenchmarkBasicNet(b *testing.B) {
+	benchmarkNetACL(b, NewBasicNet())
+}
+
+func TestTrieNetJSONArray(t *testing.T) {
+	acl := NewTrieNet()
+	testAddNet(acl, "10.0.0.0/8", t)
+	testAddNet(acl, "2001:db8::/32", t)
+
+	out, err := MarshalJSONArray(acl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var loaded TrieNet
+	if err = json.Unmarshal(out, &loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if strings.Join(loaded.entries(), ",") != "10.0.0.0/8,2001:db8::/32" {
+		t.Fatalf("expected the array to round-trip, have %v", loaded.entries())
+	}
+
+	if err = json.Unmarshal([]byte(`["10.0.0.0/8", "192.0.2.5/24"]`), &loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(&loaded, "192.0.2.200", t) || checkIPString(&loaded, "2001:db8::1", t) {
+		t.Fatalf("unexpected contents %v", loaded.entries())
+	}
+
+	// null is an empty ACL.
+	if err = json.Unmarshal([]byte("null"), &loaded); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(loaded.entries()) != 0 || checkIPString(&loaded, "10.0.0.1", t) {
+		t.Fatalf("expected an empty ACL, have %v", loaded.entries())
+	}
+
+	out, err = json.Marshal(&loaded)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != `""` {
+		t.Fatalf("unexpected JSON %s", out)
+	}
+}
@@ -0,0 +1,102 @@
+package netallow
+
+// This file contains support for reloading an ACL when the file it
+// was loaded from changes.
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long WatchFile waits after the last change to
+// a file before reloading it, so that a file written in several
+// parts is only reloaded once.
+const watchDebounce = 100 * time.Millisecond
+
+// A Reloader is an ACL that can replace its contents from a file,
+// such as Basic and BasicNet.
+type Reloader interface {
+	ReloadFromFile(path string) error
+}
+
+// WatchFile reloads the ACL from the file at path whenever the file
+// changes, logging failed reloads to the log package's default
+// logger. See WatchFileWithLogger.
+func WatchFile(acl Reloader, path string) (stop func(), err error) {
+	return WatchFileWithLogger(acl, path, nil)
+}
+
+// WatchFileWithLogger reloads the ACL from the file at path whenever
+// the file changes. Changes are debounced, so a burst of writes
+// causes a single reload. The file's directory is watched rather
+// than the file itself, so files that are replaced by renaming a new
+// file over them, as editors and configuration management tools
+// often do, are still followed. A failed reload is logged to l, or
+// to the log package's default logger if l is nil, and the ACL is
+// left as it was. The ACL isn't loaded when the watch starts.
+//
+// Calling stop ends the watch and waits for any reload in progress
+// to finish; it may be called more than once.
+func WatchFileWithLogger(acl Reloader, path string, l Logger) (stop func(), err error) {
+	l = loggerOrDefault(l)
+	path = filepath.Clean(path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != path {
+					continue
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					reload = time.After(watchDebounce)
+				}
+			case <-reload:
+				reload = nil
+				if err := acl.ReloadFromFile(path); err != nil {
+					l.Printf("netallow: failed to reload %s: %v", path, err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				l.Printf("netallow: error watching %s: %v", path, err)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+			watcher.Close()
+		})
+	}
+	return stop, nil
+}
@@ -0,0 +1,108 @@
+package netallow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncLogger is a Logger that can be read while it is being written.
+type syncLogger struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (l *syncLogger) Printf(format string, v ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *syncLogger) count() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.lines)
+}
+
+// waitFor polls cond until it is true, failing the test if it takes
+// too long.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netallow")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "hosts", "192.0.2.1\n")
+	acl := NewBasic()
+	if err = acl.ReloadFromFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	logger := &syncLogger{}
+	stop, err := WatchFileWithLogger(acl, path, logger)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer stop()
+
+	writeTestFile(t, dir, "hosts", "192.0.2.2\n")
+	waitFor(t, "the rewritten file to be loaded", func() bool {
+		return checkIPString(acl, "192.0.2.2", t)
+	})
+
+	if checkIPString(acl, "192.0.2.1", t) {
+		t.Fatal("the old contents should have been replaced")
+	}
+
+	// Replacing the file by renaming another over it is followed.
+	tmp := writeTestFile(t, dir, "hosts.tmp", "192.0.2.3\n")
+	if err = os.Rename(tmp, path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	waitFor(t, "the renamed file to be loaded", func() bool {
+		return checkIPString(acl, "192.0.2.3", t)
+	})
+
+	// Other files in the directory are ignored, and an invalid
+	// file is logged without changing the ACL.
+	writeTestFile(t, dir, "other", "192.0.2.4\n")
+	writeTestFile(t, dir, "hosts", "192.0.2\n")
+	waitFor(t, "the failed reload to be logged", func() bool {
+		return logger.count() > 0
+	})
+
+	if !checkIPString(acl, "192.0.2.3", t) || checkIPString(acl, "192.0.2.4", t) {
+		t.Fatal("a failed reload shouldn't change the ACL")
+	}
+
+	stop()
+	stop()
+
+	writeTestFile(t, dir, "hosts", "192.0.2.5\n")
+	time.Sleep(3 * watchDebounce)
+	if checkIPString(acl, "192.0.2.5", t) {
+		t.Fatal("the file shouldn't be reloaded after the watch is stopped")
+	}
+}
+
+func TestWatchFileMissingDir(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "netallow-no-such-dir", "hosts")
+	if _, err := WatchFile(NewBasic(), path); err == nil {
+		t.Fatal("WatchFile should fail when the directory doesn't exist")
+	}
+}